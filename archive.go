@@ -0,0 +1,696 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Dateien bis zu dieser Größe werden von den Workern komplett gelesen und gehasht,
+// größere liest der Schreiber selbst, damit der Speicherbedarf begrenzt bleibt
+const smallFileLimit = 1 << 20
+
+var errArchiveAborted = errors.New("archivierung abgebrochen")
+
+type archiveJob struct {
+	path   string
+	name   string // Name im Archiv, mit "/" getrennt
+	info   os.FileInfo
+	meta   map[string]string // Angaben des Filterprogramms für das Manifest
+	result chan archiveResult
+}
+
+type archiveOptions struct {
+	Project      string
+	Excludes     []string
+	Workers      int
+	SpecialFiles string // Umgang mit Geräten, Sockets und FIFOs: "skip", "metadata" oder "fail"
+	Format       string // "tar", "zip" oder "snapshot"
+	Compression  *compressionFormat
+	Level        int
+	Store        string // gemeinsamer Speicher für Snapshots
+	// Verzeichnisse auf anderen Dateisystemen werden als leere Verzeichnisse gespeichert
+	OneFileSystem bool
+	MaxDepth      int // Verzeichnisse ab dieser Tiefe ohne Inhalt sichern, 0 = unbegrenzt
+	MaxPathLength int // längere Pfade auslassen, 0 = unbegrenzt
+	// Dateien ab SkipContentMinSize auslassen, deren Inhalt zu einer dieser Arten gehört
+	SkipContent        []string
+	SkipContentMinSize int64
+	Git                *GitInfo // Stand des Repositorys, wird in den Metadaten vermerkt
+	UnreadableFiles    string   // nicht lesbare Einträge: "skip" (melden und weiter) oder "fail"
+	NormalizeNames     string   // Unicode-Form der Namen im Archiv: "nfc", "nfd" oder "" (unverändert)
+	Filter             []string // Filterprogramm mit Argumenten, siehe filter.go
+	trace              *span    // übergeordneter Abschnitt für den Trace des Laufs
+	// Zwischenstand eines abgebrochenen Snapshots, der fortgesetzt wird
+	checkpoint snapshotCheckpoint
+}
+
+// archiveReport fasst zusammen, was beim Archivieren aufgefallen ist
+type archiveReport struct {
+	Files        []ManifestFile
+	Entries      []ManifestEntry // Verzeichnisse, Links und Spezialdateien
+	NameIssues   []string        // Einträge, deren Namen auf anderen Systemen Probleme machen können
+	SpecialFiles []string        // gefundene Geräte, Sockets und FIFOs mit der gewählten Behandlung
+	Limited      []string        // wegen Tiefe, Pfadlänge, Schleifen oder reservierter Namen ausgelassene Einträge
+	Skipped      []SkippedFile
+	Excluded     excludeStats // durch Ausschlussmuster nicht gesicherte Dateien je Gruppe
+	Unreadable   []string     // wegen fehlender Rechte nicht gesicherte Einträge
+	Filtered     []string     // vom Filterprogramm abgelehnte Einträge mit Begründung
+	Stored       int64        // bei Snapshots die neu in den Speicher aufgenommenen Bytes
+}
+
+type archiveResult struct {
+	data []byte // Inhalt kleiner Dateien; nil, wenn der Schreiber selbst liest
+	sum  string
+	err  error
+}
+
+// isExcluded prüft einen Pfad (relativ, mit "/" getrennt) gegen die Ausschlussmuster.
+// Muster ohne "/" gelten für jede Ebene, "dir/" nur für Verzeichnisse und
+// "**/muster" für beliebig tief verschachtelte Pfade.
+func isExcluded(rel string, isDir bool, patterns []string) bool {
+	return excludingPattern(rel, isDir, patterns) != ""
+}
+
+// excludingPattern liefert das erste Muster, das rel ausschließt, sonst ""
+func excludingPattern(rel string, isDir bool, patterns []string) string {
+	base := path.Base(rel)
+	for _, original := range patterns {
+		dirOnly := strings.HasSuffix(original, "/")
+		pattern := strings.TrimSuffix(original, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+
+		if !strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(pattern, base); ok {
+				return original
+			}
+			continue
+		}
+
+		if strings.HasPrefix(pattern, "**/") {
+			pattern = strings.TrimPrefix(pattern, "**/")
+			parts := strings.Split(rel, "/")
+			for i := range parts {
+				if ok, _ := path.Match(pattern, strings.Join(parts[i:], "/")); ok {
+					return original
+				}
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, rel); ok {
+			return original
+		}
+	}
+	return ""
+}
+
+func createBackup(sourceDir, backupFile string, opts archiveOptions) (*archiveReport, error) {
+	logMessage(LogInfo, "Erstelle Backup...")
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+
+	fmt.Fprintf(os.Stderr, "Erstelle Backup von %s\n", sourceDir)
+	fmt.Fprintf(os.Stderr, "Ausgeschlossene Dateien/Ordner: %s\n", strings.Join(opts.Excludes, ", "))
+	logMessage(LogDebug, "Lese Dateien mit %d Workern", opts.Workers)
+
+	startTime := time.Now()
+	var tw entryWriter
+	var out io.WriteCloser
+	var snapshot *snapshotWriter
+	var zipOut *zipWriter
+	switch opts.Format {
+	case "snapshot":
+		// Jede Datei landet unkomprimiert im gemeinsamen Speicher, siehe snapshot.go
+		var err error
+		if snapshot, err = newSnapshotWriter(backupFile, opts.Store, opts.checkpoint); err != nil {
+			return nil, err
+		}
+		tw = snapshot
+	case "zip":
+		// zip komprimiert jeden Eintrag selbst mit Deflate, bereits komprimierte gar nicht
+		file, err := os.Create(backupFile)
+		if err != nil {
+			return nil, err
+		}
+		level := flate.DefaultCompression
+		if opts.Compression.Name == "gzip" {
+			level = opts.Level
+		}
+		zipOut = newZipWriter(file, level)
+		out, tw = file, zipOut
+	default:
+		zw, err := opts.Compression.create(backupFile, opts.Level)
+		if err != nil {
+			return nil, err
+		}
+		out, tw = zw, tar.NewWriter(zw)
+	}
+
+	// Metadaten als erster Eintrag, damit spätere Versionen das Format erkennen
+	report := &archiveReport{}
+	meta := newArchiveMeta(opts.Project, sourceDir)
+	meta.Git = opts.Git
+	err := writeArchiveMeta(tw, meta)
+	if err == nil {
+		report, err = writeArchive(tw, sourceDir, opts)
+	}
+	if err == nil {
+		err = writeRestoreInfo(tw, backupFile, meta, report, opts)
+	}
+	if err == nil {
+		err = tw.Close()
+	}
+	if out != nil {
+		// Nach einem Fehler kein Archiv aus dem halben tar-Strom abschließen lassen
+		if err != nil {
+			abortWriter(out)
+		} else {
+			err = out.Close()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		report.Stored = snapshot.Stored
+	}
+	if zipOut != nil && zipOut.Stored > 0 {
+		logMessage(LogInfo, "%d bereits komprimierte Dateien unverändert gespeichert", zipOut.Stored)
+	}
+
+	duration := time.Since(startTime)
+	fmt.Fprintf(os.Stderr, "Backup-Erstellung abgeschlossen in %v\n", duration.Round(time.Second).String())
+	if len(report.NameIssues) > 0 {
+		logMessage(LogWarning, "%d Einträge mit Namen, die auf anderen Systemen Probleme machen können:", len(report.NameIssues))
+		for _, issue := range report.NameIssues {
+			fmt.Fprintf(os.Stderr, "  %s\n", issue)
+		}
+	}
+	if len(report.Limited) > 0 {
+		logMessage(LogWarning, "%d Einträge ausgelassen (MaxDepth, MaxPathLength, Schleifen oder reservierte Namen):", len(report.Limited))
+		for _, limited := range report.Limited {
+			fmt.Fprintf(os.Stderr, "  %s\n", limited)
+		}
+	}
+	if len(report.Filtered) > 0 {
+		logMessage(LogWarning, "%d Einträge vom Filterprogramm ausgelassen:", len(report.Filtered))
+		for _, filtered := range report.Filtered {
+			fmt.Fprintf(os.Stderr, "  %s\n", filtered)
+		}
+	}
+	if len(report.Skipped) > 0 {
+		logMessage(LogWarning, "%d Dateien wegen ihres Inhalts ausgelassen (SkipContent, im Manifest vermerkt):", len(report.Skipped))
+		for _, file := range report.Skipped {
+			fmt.Fprintf(os.Stderr, "  %q: %s, %s\n", file.Path, file.Kind, formatSize(file.Size))
+		}
+	}
+	if len(report.Unreadable) > 0 {
+		logMessage(LogWarning, "%d Einträge ohne Leserechte nicht gesichert (UnreadableFiles: fail bricht stattdessen ab):", len(report.Unreadable))
+		for _, name := range report.Unreadable {
+			fmt.Fprintf(os.Stderr, "  %q\n", name)
+		}
+	}
+	if len(report.SpecialFiles) > 0 {
+		logMessage(LogWarning, "%d Spezialdateien gefunden:", len(report.SpecialFiles))
+		for _, special := range report.SpecialFiles {
+			fmt.Fprintf(os.Stderr, "  %s\n", special)
+		}
+	}
+	return report, nil
+}
+
+// writeArchive durchläuft sourceDir und schreibt alle nicht ausgeschlossenen Einträge in tw.
+// Worker lesen und hashen die Dateien parallel, der Schreiber übernimmt die Ergebnisse
+// in der Reihenfolge des Durchlaufs.
+func writeArchive(tw entryWriter, sourceDir string, opts archiveOptions) (*archiveReport, error) {
+	jobs := make(chan *archiveJob, opts.Workers)
+	order := make(chan *archiveJob, opts.Workers*4)
+	stop := make(chan struct{})
+
+	for i := 0; i < opts.Workers; i++ {
+		go func() {
+			for job := range jobs {
+				archivePause.wait()
+				job.result <- readForArchive(job.path)
+			}
+		}()
+	}
+
+	var filter *entryFilter
+	if len(opts.Filter) > 0 {
+		var err error
+		if filter, err = startFilter(opts.Filter, sourceDir, opts.Project); err != nil {
+			close(jobs)
+			return nil, err
+		}
+	}
+
+	guard := newWalkGuard(sourceDir, opts)
+	// nur vom Durchlauf geschrieben, gelesen erst nach dessen Ende
+	var limited []string
+	var filtered []string
+	var skipped []SkippedFile
+	var unreadable []string
+	excluded := make(excludeStats)
+	names := newNameNormalizer(opts.NormalizeNames, func(rel, sibling string) bool {
+		other, err := os.Lstat(filepath.Join(sourceDir, filepath.FromSlash(sibling)))
+		if err != nil {
+			return false
+		}
+		// Auf macOS findet der normalisierte Name dieselbe Datei
+		self, err := os.Lstat(filepath.Join(sourceDir, filepath.FromSlash(rel)))
+		return err != nil || !os.SameFile(self, other)
+	})
+	walkErr := make(chan error, 1)
+	walkSpan := startSpan("walk", opts.trace)
+	go func() {
+		defer close(order)
+		defer close(jobs)
+		defer func() { walkSpan.finish(nil) }()
+		err := filepath.Walk(sourceDir, func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				// Nicht lesbare Verzeichnisse und Dateien melden statt den Lauf abzubrechen
+				if !errors.Is(err, fs.ErrPermission) || filePath == sourceDir || opts.UnreadableFiles == "fail" {
+					return err
+				}
+				rel, _ := filepath.Rel(sourceDir, filePath)
+				unreadable = append(unreadable, filepath.ToSlash(rel))
+				return nil
+			}
+			rel, err := filepath.Rel(sourceDir, filePath)
+			if err != nil || rel == "." {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if isToolEntry(rel) {
+				limited = append(limited, fmt.Sprintf("%q: Name ist für backup-tool reserviert", rel))
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if pattern := excludingPattern(rel, info.IsDir(), opts.Excludes); pattern != "" {
+				excluded.add(pattern, filePath, info)
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			reason, pruneContents := guard.check(rel, info)
+			if reason != "" {
+				limited = append(limited, fmt.Sprintf("%q: %s", rel, reason))
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if len(opts.SkipContent) > 0 && info.Mode().IsRegular() && info.Size() >= opts.SkipContentMinSize {
+				if kind := detectContentKind(filePath); kind != "" && containsString(opts.SkipContent, kind) {
+					skipped = append(skipped, SkippedFile{Path: rel, Size: info.Size(), Kind: kind})
+					return nil
+				}
+			}
+
+			job := &archiveJob{path: filePath, name: names.name(rel), info: info, result: make(chan archiveResult, 1)}
+			if filter != nil {
+				response, err := filter.check(job.name, info)
+				if err != nil {
+					return err
+				}
+				if response.Action == "skip" {
+					filtered = append(filtered, fmt.Sprintf("%q: %s", rel, response.Reason))
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				job.name, job.meta = response.Name, response.Metadata
+			}
+			// Dateien aus einem abgebrochenen Lauf nicht vorab lesen; ob sie übernommen
+			// werden, entscheidet der snapshotWriter erst beim Schreiben
+			if _, ok := opts.checkpoint.lookup(job.name, info.Size(), info.ModTime()); ok && info.Mode().IsRegular() {
+				job.result <- archiveResult{}
+			} else if info.Mode().IsRegular() && info.Size() <= smallFileLimit {
+				select {
+				case jobs <- job:
+				case <-stop:
+					return errArchiveAborted
+				}
+			} else {
+				job.result <- archiveResult{}
+			}
+
+			select {
+			case order <- job:
+			case <-stop:
+				return errArchiveAborted
+			}
+			// Wie tar --one-file-system: den Einhängepunkt sichern, seinen Inhalt nicht
+			if pruneContents {
+				if guard.foreign(info) {
+					logMessage(LogInfo, "Überspringe Inhalt von %s (anderes Dateisystem)", rel)
+				} else {
+					limited = append(limited, fmt.Sprintf("%q: Inhalt ausgelassen, MaxDepth %d erreicht", rel, opts.MaxDepth))
+				}
+				return filepath.SkipDir
+			}
+			return nil
+		})
+		if filter != nil {
+			if closeErr := filter.close(); err == nil {
+				err = closeErr
+			}
+		}
+		walkErr <- err
+	}()
+
+	// Nie nil: ein Manifest mit leerer Liste unterscheidet sich so von älteren ohne Entries
+	report := &archiveReport{Entries: []ManifestEntry{}}
+	folded := make(map[string]string) // kleingeschriebener Name -> erster Eintrag
+	var writeErr error
+	state := newEntryState()
+	if opts.Format == "zip" {
+		state.links = nil
+	}
+	for job := range order {
+		archivePause.wait()
+		result := <-job.result
+		if writeErr != nil {
+			continue
+		}
+		if isSpecialFile(job.info.Mode()) {
+			stored, err := specialFilePolicy(job, opts)
+			if err != nil {
+				writeErr = err
+				close(stop)
+				continue
+			}
+			handling := "Metadaten gespeichert"
+			if !stored {
+				handling = "übersprungen"
+			}
+			report.SpecialFiles = append(report.SpecialFiles, fmt.Sprintf("%q (%s): %s", job.name, specialFileKind(job.info.Mode()), handling))
+			if !stored {
+				continue
+			}
+		}
+		var size int64
+		if job.info.Mode().IsRegular() {
+			size = job.info.Size()
+		}
+		events.fileStart(job.name, size)
+		file, entry, err := writeEntry(tw, job, result, state)
+		events.fileDone(job.name, size, err)
+		// writeEntry liest die Quelle, bevor es den Header schreibt; das Archiv bleibt also intakt
+		if errors.Is(err, fs.ErrPermission) && opts.UnreadableFiles != "fail" {
+			report.Unreadable = append(report.Unreadable, job.name)
+			state.forget(job.name)
+			continue
+		}
+		if err != nil {
+			writeErr = fmt.Errorf("%s: %v", job.name, err)
+			close(stop)
+			continue
+		}
+		if file != nil {
+			report.Files = append(report.Files, *file)
+		}
+		if entry != nil {
+			report.Entries = append(report.Entries, *entry)
+		}
+		// PAX-Header speichern lange und ungewöhnliche Namen verlustfrei, gemeldet werden sie trotzdem
+		if issue := nameIssue(job.name); issue != "" {
+			report.NameIssues = append(report.NameIssues, fmt.Sprintf("%q: %s", job.name, issue))
+		}
+		key := strings.ToLower(job.name)
+		if other, ok := folded[key]; ok {
+			report.NameIssues = append(report.NameIssues, fmt.Sprintf(
+				"%q: kollidiert ohne Unterscheidung von Groß-/Kleinschreibung (Windows, macOS) mit %q, siehe restore --case-conflicts", job.name, other))
+		} else {
+			folded[key] = job.name
+		}
+	}
+
+	if err := <-walkErr; writeErr == nil && err != nil {
+		return nil, err
+	}
+	report.Limited = limited
+	report.Filtered = filtered
+	report.Skipped = skipped
+	report.Excluded = excluded
+	report.Unreadable = append(unreadable, report.Unreadable...)
+	report.NameIssues = append(report.NameIssues, names.Conflicts...)
+	return report, writeErr
+}
+
+// walkGuard begrenzt den Durchlauf der Quelle: andere Dateisysteme, zu tief
+// verschachtelte Bäume, überlange Pfade und Verzeichnisschleifen (z.B. durch Bind-Mounts)
+type walkGuard struct {
+	oneFileSystem bool
+	root          uint64
+	maxDepth      int
+	maxPathLength int
+	dirs          map[[2]uint64]string // Gerät/Inode -> bereits gesichertes Verzeichnis
+}
+
+func newWalkGuard(sourceDir string, opts archiveOptions) *walkGuard {
+	guard := &walkGuard{
+		maxDepth:      opts.MaxDepth,
+		maxPathLength: opts.MaxPathLength,
+		dirs:          make(map[[2]uint64]string),
+	}
+	if info, err := os.Stat(sourceDir); err == nil {
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			guard.dirs[[2]uint64{uint64(stat.Dev), uint64(stat.Ino)}] = "."
+			guard.oneFileSystem = opts.OneFileSystem
+			guard.root = uint64(stat.Dev)
+		}
+	}
+	return guard
+}
+
+// check liefert einen Grund, wenn der Eintrag ausgelassen wird, und ob bei einem
+// gesicherten Verzeichnis der Inhalt übersprungen werden soll
+func (g *walkGuard) check(rel string, info os.FileInfo) (reason string, pruneContents bool) {
+	if g.maxPathLength > 0 && len(rel) > g.maxPathLength {
+		return fmt.Sprintf("Pfad länger als %d Zeichen", g.maxPathLength), false
+	}
+	if !info.IsDir() {
+		return "", false
+	}
+	depth := strings.Count(rel, "/") + 1
+	if g.maxDepth > 0 && depth >= g.maxDepth {
+		return "", true
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		key := [2]uint64{uint64(stat.Dev), uint64(stat.Ino)}
+		if first, seen := g.dirs[key]; seen {
+			return fmt.Sprintf("Verzeichnisschleife, identisch mit %s", first), false
+		}
+		g.dirs[key] = rel
+	}
+	return "", g.foreign(info)
+}
+
+func (g *walkGuard) foreign(info os.FileInfo) bool {
+	if !g.oneFileSystem {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && uint64(stat.Dev) != g.root
+}
+
+func isSpecialFile(mode os.FileMode) bool {
+	return mode&(os.ModeDevice|os.ModeCharDevice|os.ModeNamedPipe|os.ModeSocket|os.ModeIrregular) != 0
+}
+
+func specialFileKind(mode os.FileMode) string {
+	switch {
+	case mode&os.ModeCharDevice != 0:
+		return "zeichenorientiertes Gerät"
+	case mode&os.ModeDevice != 0:
+		return "blockorientiertes Gerät"
+	case mode&os.ModeNamedPipe != 0:
+		return "FIFO"
+	case mode&os.ModeSocket != 0:
+		return "Socket"
+	default:
+		return "unbekannter Dateityp"
+	}
+}
+
+// specialFilePolicy entscheidet, ob eine Spezialdatei als Metadaten-Eintrag gespeichert wird
+func specialFilePolicy(job *archiveJob, opts archiveOptions) (bool, error) {
+	mode := job.info.Mode()
+	switch opts.SpecialFiles {
+	case "fail":
+		return false, fmt.Errorf("%s: %s gefunden (SpecialFiles: fail)", job.name, specialFileKind(mode))
+	case "skip":
+		return false, nil
+	default:
+		// Sockets und unbekannte Typen lassen sich in tar nicht abbilden, in zip gar keine Spezialdateien
+		return opts.Format != "zip" && mode&(os.ModeSocket|os.ModeIrregular) == 0, nil
+	}
+}
+
+func readForArchive(filePath string) archiveResult {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return archiveResult{err: err}
+	}
+	sum := sha256.Sum256(data)
+	return archiveResult{data: data, sum: hex.EncodeToString(sum[:])}
+}
+
+// entryState hält, was der Schreiber über alle Einträge hinweg braucht
+type entryState struct {
+	links  map[[2]uint64]string // Gerät/Inode -> erster Name für Hardlinks
+	users  map[int]string
+	groups map[int]string
+}
+
+func newEntryState() *entryState {
+	return &entryState{
+		links:  make(map[[2]uint64]string),
+		users:  make(map[int]string),
+		groups: make(map[int]string),
+	}
+}
+
+// forget entfernt einen nicht gesicherten Eintrag aus den Hardlink-Zielen
+func (s *entryState) forget(name string) {
+	for key, first := range s.links {
+		if first == name {
+			delete(s.links, key)
+		}
+	}
+}
+
+// ownerNames liefert Benutzer- und Gruppennamen, damit beim Wiederherstellen auf
+// einem anderen Rechner nach Namen statt nach numerischen IDs zugeordnet werden kann
+func (s *entryState) ownerNames(uid, gid int) (string, string) {
+	if _, ok := s.users[uid]; !ok {
+		if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+			s.users[uid] = u.Username
+		} else {
+			s.users[uid] = ""
+		}
+	}
+	if _, ok := s.groups[gid]; !ok {
+		if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+			s.groups[gid] = g.Name
+		} else {
+			s.groups[gid] = ""
+		}
+	}
+	return s.users[uid], s.groups[gid]
+}
+
+// writeEntry schreibt einen Eintrag und liefert den Manifest-Eintrag: bei regulären Dateien
+// mit Prüfsumme, sonst (Verzeichnisse, Links, Spezialdateien) nur Name und Art
+func writeEntry(tw entryWriter, job *archiveJob, result archiveResult, state *entryState) (*ManifestFile, *ManifestEntry, error) {
+	if result.err != nil {
+		return nil, nil, result.err
+	}
+	info := job.info
+	mode := info.Mode()
+
+	link := ""
+	if mode&os.ModeSymlink != 0 {
+		target, err := os.Readlink(job.path)
+		if err != nil {
+			return nil, nil, err
+		}
+		link = target
+	}
+
+	header, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Name = job.name
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	header.Uname, header.Gname = state.ownerNames(header.Uid, header.Gid)
+
+	// Mehrfach verlinkte Dateien nur einmal speichern, wie tar es auch tut; zip kennt keine Hardlinks
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && state.links != nil && mode.IsRegular() && stat.Nlink > 1 {
+		key := [2]uint64{uint64(stat.Dev), uint64(stat.Ino)}
+		if first, seen := state.links[key]; seen {
+			header.Typeflag = tar.TypeLink
+			header.Linkname = first
+			header.Size = 0
+			return nil, newManifestEntry(header), tw.WriteHeader(header)
+		}
+		state.links[key] = job.name
+	}
+
+	if !mode.IsRegular() {
+		return nil, newManifestEntry(header), tw.WriteHeader(header)
+	}
+
+	file := newManifestFile(job.name)
+	file.ModTime = info.ModTime().UTC()
+	file.Metadata = job.meta
+	if snapshot, ok := tw.(*snapshotWriter); ok && result.data == nil {
+		if sum, ok := snapshot.reuse(job.name, info.Size(), info.ModTime()); ok {
+			header.Size = info.Size()
+			file.Size = header.Size
+			file.SHA256 = sum
+			return file, nil, tw.WriteHeader(header)
+		}
+	}
+	if result.data != nil {
+		header.Size = int64(len(result.data))
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, nil, err
+		}
+		if _, err := io.Copy(tw, bytes.NewReader(result.data)); err != nil {
+			return nil, nil, err
+		}
+		file.Size = header.Size
+		file.SHA256 = result.sum
+		return file, nil, nil
+	}
+
+	// Große Dateien direkt in das Archiv streamen und dabei hashen
+	f, err := os.Open(job.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	current, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Size = current.Size()
+	if err := tw.WriteHeader(header); err != nil {
+		return nil, nil, err
+	}
+	hash := sha256.New()
+	if _, err := io.CopyN(tw, io.TeeReader(f, hash), header.Size); err != nil {
+		return nil, nil, fmt.Errorf("datei hat sich während des Lesens geändert: %v", err)
+	}
+	file.Size = header.Size
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return file, nil, nil
+}
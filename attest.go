@@ -0,0 +1,367 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Mit AttestationKey legt jedes Backup eine signierte Bestätigung <backup>.attestation.json
+// neben das Archiv. Sie lässt sich ohne backup-tool prüfen:
+//
+//	jq -r .Payload X.attestation.json | base64 -d > payload.json
+//	jq -r .Signature X.attestation.json | base64 -d > payload.sig
+//	openssl pkeyutl -verify -pubin -inkey attestation.pub -rawin -in payload.json -sigfile payload.sig
+//	sha256sum ARCHIV   # muss ArchiveSHA256 in payload.json entsprechen
+//
+// SourceRoot ist die Wurzel eines Hash-Baums nach RFC 6962 über die gesicherten Dateien:
+// Blätter sind "Pfad\x00SHA256-hex" in Byte-Reihenfolge sortiert, Blatt-Hash
+// SHA256(0x00 || Blatt), innerer Knoten SHA256(0x01 || links || rechts).
+
+const attestationType = "backup-tool-attestation/v1"
+
+type Attestation struct {
+	Type          string
+	Project       string
+	Archive       string
+	ArchiveSHA256 string `json:",omitempty"` // fehlt bei Snapshots, die kein einzelnes Archiv haben (dort hilft nur --deep)
+	ArchiveSize   int64
+	SourceRoot    string // Hash-Baum über Pfade und Prüfsummen der gesicherten Dateien
+	SourceFiles   int
+	SourceSize    int64
+	TreeRoot      string `json:",omitempty"` // Wurzel des Hash-Baums im Manifest (merkle.go)
+	Created       time.Time
+	ToolVersion   string
+	Host          string
+	RunID         string `json:",omitempty"`
+}
+
+// signedAttestation ist der Inhalt der Datei; signiert sind genau die Bytes in Payload
+type signedAttestation struct {
+	Algorithm string // "ed25519"
+	KeyID     string // die ersten 16 Hex-Zeichen von SHA256 über den öffentlichen Schlüssel
+	Payload   string // Base64 der Attestation als JSON
+	Signature string // Base64
+}
+
+func attestationPath(archivePath string) string {
+	return strings.TrimSuffix(archivePath, archiveExtension(archivePath)) + ".attestation.json"
+}
+
+// sourceRoot berechnet die Wurzel des Hash-Baums über die Dateien eines Manifests
+func sourceRoot(files []ManifestFile) string {
+	leaves := make([]string, 0, len(files))
+	for _, file := range files {
+		leaves = append(leaves, file.name()+"\x00"+file.SHA256)
+	}
+	sort.Strings(leaves)
+	hashes := make([][]byte, len(leaves))
+	for i, leaf := range leaves {
+		sum := sha256.Sum256(append([]byte{0}, leaf...))
+		hashes[i] = sum[:]
+	}
+	return hex.EncodeToString(merkleRoot(hashes))
+}
+
+func merkleRoot(hashes [][]byte) []byte {
+	switch len(hashes) {
+	case 0:
+		sum := sha256.Sum256(nil)
+		return sum[:]
+	case 1:
+		return hashes[0]
+	}
+	// Linker Teilbaum mit der größten Zweierpotenz kleiner als n Blättern
+	split := 1
+	for split*2 < len(hashes) {
+		split *= 2
+	}
+	node := append([]byte{1}, merkleRoot(hashes[:split])...)
+	sum := sha256.Sum256(append(node, merkleRoot(hashes[split:])...))
+	return sum[:]
+}
+
+// writeAttestation signiert die Angaben zu einem fertigen Backup mit dem Schlüssel aus keyFile
+func writeAttestation(keyFile, archivePath string, manifest *Manifest, archiveSum string) error {
+	key, err := loadAttestationKey(keyFile)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	statement := Attestation{
+		Type:          attestationType,
+		Project:       manifest.Project,
+		Archive:       manifest.Archive,
+		ArchiveSHA256: archiveSum,
+		SourceRoot:    sourceRoot(manifest.Files),
+		SourceFiles:   len(manifest.Files),
+		TreeRoot:      manifest.Tree[""],
+		Created:       time.Now().UTC(),
+		ToolVersion:   toolVersion,
+		Host:          host,
+		RunID:         runID,
+	}
+	if info, err := os.Stat(archivePath); err == nil && !info.IsDir() {
+		statement.ArchiveSize = info.Size()
+	}
+	for _, file := range manifest.Files {
+		statement.SourceSize += file.Size
+	}
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return err
+	}
+	signed := signedAttestation{
+		Algorithm: "ed25519",
+		KeyID:     keyID(key.Public().(ed25519.PublicKey)),
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}
+	data, err := json.MarshalIndent(signed, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(attestationPath(archivePath), data, 0644)
+}
+
+func keyID(public ed25519.PublicKey) string {
+	sum := sha256.Sum256(public)
+	return hex.EncodeToString(sum[:8])
+}
+
+func loadAttestationKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: kein PEM-Schlüssel", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: kein Ed25519-Schlüssel", path)
+	}
+	return private, nil
+}
+
+func loadPublicKey(path string) (ed25519.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: kein PEM-Schlüssel", path)
+	}
+	// Auch der private Schlüssel ist erlaubt, der öffentliche steckt darin
+	if private, err := loadAttestationKey(path); err == nil {
+		return private.Public().(ed25519.PublicKey), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	public, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: kein Ed25519-Schlüssel", path)
+	}
+	return public, nil
+}
+
+// runAttest erzeugt Schlüssel und prüft Bestätigungen
+func runAttest(args []string) error {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Verwendung: backup-tool attest keygen SCHLÜSSELDATEI")
+		fmt.Fprintln(os.Stderr, "       backup-tool attest verify [--key ÖFFENTLICHER-SCHLÜSSEL] [--deep] BACKUP...")
+	}
+	if len(args) == 0 {
+		usage()
+		return fmt.Errorf("kein Unterbefehl angegeben")
+	}
+	switch args[0] {
+	case "keygen":
+		if len(args) != 2 {
+			usage()
+			return fmt.Errorf("keine Schlüsseldatei angegeben")
+		}
+		return generateAttestationKey(args[1])
+	case "verify":
+		return runAttestVerify(args[1:])
+	}
+	usage()
+	return fmt.Errorf("unbekannter Unterbefehl: %s", args[0])
+}
+
+// generateAttestationKey schreibt einen neuen privaten Schlüssel nach path und den
+// öffentlichen für die Prüfer nach path.pub
+func generateAttestationKey(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s existiert bereits", path)
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER}), 0600)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("Privater Schlüssel: %s (\"AttestationKey\" in config.json)\n", path)
+	fmt.Printf("Öffentlicher Schlüssel für die Prüfung: %s.pub (Schlüssel-ID %s)\n", path, keyID(public))
+	return nil
+}
+
+func runAttestVerify(args []string) error {
+	flags := flag.NewFlagSet("attest verify", flag.ExitOnError)
+	keyFlag := flags.String("key", "", "öffentlicher Schlüssel (Standard: AttestationKey aus config.json)")
+	deep := flags.Bool("deep", false, "Hash-Baum aus dem Inhalt des Archivs neu berechnen statt aus dem Manifest")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return fmt.Errorf("kein Backup angegeben")
+	}
+
+	var config *Config
+	var projectName string
+	project := func() error {
+		if config != nil {
+			return nil
+		}
+		var err error
+		config, _, projectName, err = loadProject()
+		return err
+	}
+	keyFile := *keyFlag
+	if keyFile == "" {
+		if err := project(); err != nil {
+			return err
+		}
+		if config.AttestationKey == "" {
+			return fmt.Errorf("kein Schlüssel angegeben (--key oder AttestationKey in config.json)")
+		}
+		keyFile = config.AttestationKey
+	}
+	public, err := loadPublicKey(keyFile)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, backup := range flags.Args() {
+		path := backup
+		if _, err := os.Stat(path); err != nil {
+			if err := project(); err != nil {
+				return err
+			}
+			if path, err = selectBackup(config.BackupDir, projectName, "", backup); err != nil {
+				return err
+			}
+		}
+		statement, err := verifyAttestation(path, public, *deep)
+		if err != nil {
+			failed++
+			fmt.Printf("✗ %s: %v\n", backup, err)
+			continue
+		}
+		fmt.Printf("✓ %s: %d Dateien, Wurzel %s, signiert am %s auf %s\n", statement.Archive, statement.SourceFiles,
+			statement.SourceRoot[:16], formatDateTime(statement.Created), statement.Host)
+		if statement.ArchiveSHA256 == "" && !*deep {
+			fmt.Println("  Hinweis: Snapshot ohne Archiv-Prüfsumme, geprüft ist nur die Dateiliste im Manifest; --deep prüft auch den Inhalt")
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d von %d Bestätigungen ungültig", failed, flags.NArg())
+	}
+	return nil
+}
+
+// verifyAttestation prüft Signatur, Archiv und Dateiliste eines Backups
+func verifyAttestation(archivePath string, public ed25519.PublicKey, deep bool) (*Attestation, error) {
+	data, err := os.ReadFile(attestationPath(archivePath))
+	if err != nil {
+		return nil, err
+	}
+	var signed signedAttestation
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("fehler beim Lesen der Bestätigung: %v", err)
+	}
+	if signed.Algorithm != "ed25519" {
+		return nil, fmt.Errorf("unbekanntes Verfahren %q", signed.Algorithm)
+	}
+	payload, err := base64.StdEncoding.DecodeString(signed.Payload)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.StdEncoding.DecodeString(signed.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if !ed25519.Verify(public, payload, signature) {
+		return nil, fmt.Errorf("signatur ungültig (Schlüssel-ID %s, erwartet %s)", signed.KeyID, keyID(public))
+	}
+	var statement Attestation
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, err
+	}
+	if statement.Type != attestationType {
+		return nil, fmt.Errorf("unbekannter Typ %q", statement.Type)
+	}
+
+	if statement.ArchiveSHA256 != "" {
+		sum, err := hashFile(archivePath)
+		if err != nil {
+			return nil, err
+		}
+		if sum != statement.ArchiveSHA256 {
+			return nil, fmt.Errorf("archiv wurde verändert (SHA256 %s statt %s)", sum[:16], statement.ArchiveSHA256[:16])
+		}
+	}
+	var manifest *Manifest
+	if deep {
+		// Bei Snapshots liest das die Dateien aus dem Speicher, deren Inhalt sonst ungeprüft bliebe
+		if manifest, err = buildManifest(archivePath, statement.Project); err != nil {
+			return nil, err
+		}
+		// Metadaten und Wiederherstellungshilfe stehen nicht in der Dateiliste
+		var files []ManifestFile
+		for _, file := range manifest.Files {
+			if !isToolEntry(file.name()) {
+				files = append(files, file)
+			}
+		}
+		manifest.Files = files
+	} else if manifest, err = loadManifest(archivePath); err != nil {
+		return nil, fmt.Errorf("manifest fehlt (--deep liest das Archiv selbst): %v", err)
+	}
+	if root := sourceRoot(manifest.Files); root != statement.SourceRoot {
+		return nil, fmt.Errorf("dateiliste weicht ab (%d statt %d Dateien, Wurzel %s statt %s)",
+			len(manifest.Files), statement.SourceFiles, root[:16], statement.SourceRoot[:16])
+	}
+	return &statement, nil
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttestationDeepChecksSnapshotContent(t *testing.T) {
+	src := t.TempDir()
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("alpha"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backupDir := t.TempDir()
+	opts := archiveOptions{Project: "p", Format: "snapshot", Store: filepath.Join(backupDir, snapshotStoreDir), Workers: 1}
+	snapshot := filepath.Join(backupDir, "p_backup_2024-01-01_12-00-00"+snapshotExtension)
+	report, err := createBackup(src, snapshot, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := newManifest(snapshot, "p", report.Files)
+	if err := saveManifest(snapshot, manifest); err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "attestation.key")
+	if err := generateAttestationKey(keyFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAttestation(keyFile, snapshot, manifest, ""); err != nil {
+		t.Fatal(err)
+	}
+	key, err := loadAttestationKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public := key.Public().(ed25519.PublicKey)
+	if _, err := verifyAttestation(snapshot, public, true); err != nil {
+		t.Fatalf("unveränderter Snapshot nicht bestätigt: %v", err)
+	}
+
+	// Inhalt im Snapshot austauschen; das Manifest bleibt unverändert
+	file := filepath.Join(snapshot, "a.txt")
+	os.Remove(file)
+	if err := os.WriteFile(file, []byte("alphx"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verifyAttestation(snapshot, public, false); err != nil {
+		t.Errorf("ohne --deep wird nur das Manifest geprüft, trotzdem Fehler: %v", err)
+	}
+	if _, err := verifyAttestation(snapshot, public, true); err == nil {
+		t.Error("veränderter Inhalt mit --deep nicht erkannt")
+	}
+}
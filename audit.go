@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const auditFileName = "audit.log"
+
+// AuditEntry ist eine Zeile im Audit-Log. Das Log wird nur ergänzt, nie gekürzt.
+type AuditEntry struct {
+	Time    time.Time
+	Action  string // "delete" oder "restore-overwrite"
+	Path    string
+	Reason  string   `json:",omitempty"`
+	Files   []string `json:",omitempty"` // bei Wiederherstellungen die überschriebenen Dateien
+	Command string   // auslösende Kommandozeile
+}
+
+// auditDir ist das Backup-Verzeichnis des aktuellen Projekts, gesetzt von loadProject
+var auditDir string
+
+// audit vermerkt eine zerstörende Aktion im Audit-Log des Backup-Verzeichnisses.
+// Fehler beim Schreiben werden gemeldet, halten die Aktion aber nicht auf.
+func audit(action, path, reason string, files ...string) {
+	if auditDir == "" {
+		return
+	}
+	entry := AuditEntry{
+		Time:    time.Now().UTC(),
+		Action:  action,
+		Path:    path,
+		Reason:  reason,
+		Files:   files,
+		Command: strings.Join(os.Args, " "),
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	f, err := os.OpenFile(filepath.Join(auditDir, auditFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		logMessage(LogWarning, "Konnte %s nicht schreiben: %v", auditFileName, err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"syscall"
+)
+
+// I/O-Klasse "idle": Zugriffe des Backups kommen nur zum Zug, wenn sonst niemand liest oder schreibt
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3 << 13
+)
+
+// enterBackground senkt CPU- und I/O-Priorität aller Threads; neue Threads und das
+// Kompressionsprogramm erben beide
+func enterBackground() error {
+	if err := applyPriority(19); err != nil {
+		return err
+	}
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return setIOPriority(0)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := setIOPriority(tid); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setIOPriority(tid int) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), ioprioClassIdle)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !windows
+
+package main
+
+// enterBackground senkt die CPU-Priorität; eine I/O-Priorität lässt sich hier nicht setzen
+func enterBackground() error {
+	return applyPriority(19)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "syscall"
+
+const (
+	idlePriorityClass          = 0x00000040
+	processModeBackgroundBegin = 0x00100000
+)
+
+var procSetPriorityClass = syscall.NewLazyDLL("kernel32.dll").NewProc("SetPriorityClass")
+
+// enterBackground setzt die Prioritätsklasse "idle", die auch das Kompressionsprogramm
+// erbt, und schaltet den Prozess zusätzlich in den Hintergrundmodus mit niedriger I/O-
+// und Speicherpriorität
+func enterBackground() error {
+	process, err := syscall.GetCurrentProcess()
+	if err != nil {
+		return err
+	}
+	for _, class := range []uintptr{idlePriorityClass, processModeBackgroundBegin} {
+		if ok, _, err := procSetPriorityClass.Call(uintptr(process), class); ok == 0 {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+type benchResult struct {
+	format   *compressionFormat
+	level    int
+	size     int64
+	duration time.Duration
+}
+
+func (r benchResult) speed(sampleSize int) int64 {
+	if r.duration <= 0 {
+		return 0
+	}
+	return int64(float64(sampleSize) / r.duration.Seconds())
+}
+
+// runBench komprimiert eine Stichprobe des Projekts mit allen verfügbaren Formaten und
+// Stufen und empfiehlt die kleinste Einstellung, die noch schnell genug ist
+func runBench(args []string) error {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	sampleFlag := flags.String("sample", "32MB", "Größe der Stichprobe")
+	minSpeedFlag := flags.String("min-speed", "20MB", "Mindestgeschwindigkeit pro Sekunde für die Empfehlung")
+	write := flags.Bool("write", false, "Empfehlung als Compression/CompressionLevel in config.json speichern")
+	flags.Parse(args)
+
+	sampleSize, err := parseSize(*sampleFlag)
+	if err != nil {
+		return err
+	}
+	minSpeed, err := parseSize(*minSpeedFlag)
+	if err != nil {
+		return err
+	}
+
+	config, sourceDir, _, err := loadProject()
+	if err != nil {
+		return err
+	}
+	excludes, _ := configExcludes(config)
+	source, err := benchSample(sourceDir, archiveOptions{Excludes: excludes}, sampleSize)
+	if err != nil {
+		return fmt.Errorf("fehler beim Lesen der Stichprobe: %v", err)
+	}
+	if len(source.Data) == 0 {
+		return fmt.Errorf("keine Dateien für die Stichprobe gefunden")
+	}
+	sample := source.Data
+	fmt.Printf("Stichprobe: %d von %d Dateien, %s\n\n", source.SampleFiles, source.Files, formatSize(int64(len(sample))))
+	fmt.Printf("%-8s %5s %12s %8s %10s %12s\n", "Format", "Stufe", "Größe", "Anteil", "Zeit", "Tempo")
+
+	tmpDir, err := os.MkdirTemp("", "backup-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var results []benchResult
+	for _, format := range compressionFormats {
+		if err := format.available(); err != nil {
+			fmt.Printf("%-8s nicht verfügbar: %v\n", format.Name, err)
+			continue
+		}
+		for _, level := range format.BenchLevels {
+			result, err := benchCompress(format, level, sample, tmpDir)
+			if err != nil {
+				logMessage(LogWarning, "%s Stufe %d fehlgeschlagen: %v", format.Name, level, err)
+				continue
+			}
+			results = append(results, result)
+			fmt.Printf("%-8s %5d %12s %7.1f%% %10v %10s/s\n", format.Name, level, formatSize(result.size),
+				float64(result.size)/float64(len(sample))*100, result.duration.Round(time.Millisecond),
+				formatSize(result.speed(len(sample))))
+		}
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("kein Kompressionsformat verfügbar")
+	}
+
+	best := recommendCompression(results, len(sample), minSpeed)
+	fmt.Printf("\nEmpfehlung: %s Stufe %d (kleinstes Ergebnis mit mindestens %s/s)\n",
+		best.format.Name, best.level, formatSize(minSpeed))
+
+	if *write {
+		err := saveConfigValues(configPath(), map[string]interface{}{
+			"Compression":      best.format.Name,
+			"CompressionLevel": best.level,
+		})
+		if err != nil {
+			return fmt.Errorf("fehler beim Speichern der Konfiguration: %v", err)
+		}
+		fmt.Println("✓ Empfehlung in config.json gespeichert")
+	}
+	return nil
+}
+
+// recommendCompression wählt das kleinste Ergebnis, das minSpeed erreicht, bei weniger
+// als 1% Unterschied das schnellere; schafft keines minSpeed, das schnellste
+func recommendCompression(results []benchResult, sampleSize int, minSpeed int64) benchResult {
+	var best *benchResult
+	for i, result := range results {
+		if result.speed(sampleSize) < minSpeed {
+			continue
+		}
+		if best == nil || result.size < best.size*99/100 ||
+			(result.size <= best.size*101/100 && result.duration < best.duration) {
+			best = &results[i]
+		}
+	}
+	if best != nil {
+		return *best
+	}
+	fastest := results[0]
+	for _, result := range results[1:] {
+		if result.duration < fastest.duration {
+			fastest = result
+		}
+	}
+	return fastest
+}
+
+func benchCompress(format *compressionFormat, level int, sample []byte, tmpDir string) (benchResult, error) {
+	target := filepath.Join(tmpDir, fmt.Sprintf("bench-%s-%d%s", format.Name, level, format.Extension))
+	defer os.Remove(target)
+
+	start := time.Now()
+	zw, err := format.create(target, level)
+	if err != nil {
+		return benchResult{}, err
+	}
+	if _, err := zw.Write(sample); err != nil {
+		abortWriter(zw)
+		return benchResult{}, err
+	}
+	if err := zw.Close(); err != nil {
+		return benchResult{}, err
+	}
+	duration := time.Since(start)
+	info, err := os.Stat(target)
+	if err != nil {
+		return benchResult{}, err
+	}
+	return benchResult{format: format, level: level, size: info.Size(), duration: duration}, nil
+}
+
+// sourceSample ist eine Stichprobe des Projekts samt Gesamtumfang
+type sourceSample struct {
+	Data        []byte // ausgewählte Dateien als tar
+	SampleFiles int
+	Files       int
+	Size        int64 // Gesamtgröße aller nicht ausgeschlossenen Dateien
+}
+
+// benchSample packt eine über das Projekt verteilte Auswahl von Dateien als tar in den
+// Speicher. Von großen Dateien wird nur der Anfang verwendet, damit eine einzelne
+// Datei die Stichprobe nicht dominiert.
+func benchSample(sourceDir string, opts archiveOptions, limit int64) (*sourceSample, error) {
+	type candidate struct {
+		path string
+		rel  string
+		size int64
+	}
+	var files []candidate
+	var total int64
+	guard := newWalkGuard(sourceDir, opts)
+	err := filepath.WalkDir(sourceDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == sourceDir {
+			return nil
+		}
+		rel, _ := filepath.Rel(sourceDir, path)
+		rel = filepath.ToSlash(rel)
+		if isExcluded(rel, d.IsDir(), opts.Excludes) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if reason, pruneContents := guard.check(rel, info); reason != "" || pruneContents {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		// Nicht lesbare Dateien werden nicht gesichert und zählen nicht zur Schätzung
+		if syscall.Access(path, 4 /* R_OK */) != nil {
+			return nil
+		}
+		files = append(files, candidate{path, rel, info.Size()})
+		total += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Bei großen Projekten jede n-te Datei, damit alle Bereiche vertreten sind
+	step := 1
+	if total > limit && limit > 0 {
+		step = int(total / limit)
+	}
+	perFile := limit / 8
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	count := 0
+	for i := 0; i < len(files) && int64(buf.Len()) < limit; i += step {
+		f, err := os.Open(files[i].path)
+		if err != nil {
+			continue
+		}
+		data, err := io.ReadAll(io.LimitReader(f, perFile))
+		f.Close()
+		if err != nil {
+			continue
+		}
+		tw.WriteHeader(&tar.Header{Name: files[i].rel, Mode: 0644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		tw.Write(data)
+		count++
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &sourceSample{Data: buf.Bytes(), SampleFiles: count, Files: len(files), Size: total}, nil
+}
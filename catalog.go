@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const catalogFileName = "catalog.json"
+
+type CatalogEntry struct {
+	Project   string
+	File      string    // Dateiname relativ zum Backup-Verzeichnis
+	Created   time.Time // wird immer in UTC gespeichert
+	Size      int64
+	SourceDir string
+	Tag       string `json:",omitempty"`
+	SameAs    string `json:",omitempty"` // Markierung ohne eigenes Archiv: Inhalt identisch mit diesem Backup
+
+	SourceSize  int64         `json:",omitempty"` // unkomprimierte Größe der gesicherten Dateien
+	Compression string        `json:",omitempty"`
+	Warnings    []string      `json:",omitempty"` // Warnungen während des Laufs
+	Git         *GitInfo      `json:",omitempty"` // Stand des Repositorys bei RecordGit
+	Duration    time.Duration `json:",omitempty"` // Dauer von Archivierung und Prüfung
+
+	// Archiv samt Dateinamen verschlüsselt; das Manifest verlässt dann den Rechner nicht
+	Encrypted bool `json:",omitempty"`
+
+	SHA256   string    `json:",omitempty"` // Prüfsumme des Archivs beim Erstellen
+	TreeRoot string    `json:",omitempty"` // Wurzel des Hash-Baums im Manifest, für verify --path
+	Verified time.Time `json:",omitempty"` // letzte erfolgreiche Prüfung durch scrub
+}
+
+// archiveFile liefert das Archiv, das den Stand dieses Eintrags enthält
+func (e CatalogEntry) archiveFile() string {
+	if e.SameAs != "" {
+		return e.SameAs
+	}
+	return e.File
+}
+
+type Catalog struct {
+	Backups []CatalogEntry
+	// Aliases ordnet frühere Projektnamen dem aktuellen zu (alt -> neu)
+	Aliases map[string]string `json:",omitempty"`
+}
+
+func loadCatalog(backupDir string) (*Catalog, error) {
+	catalog := &Catalog{}
+	data, err := os.ReadFile(filepath.Join(backupDir, catalogFileName))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, catalog); err != nil {
+			return nil, fmt.Errorf("fehler beim Lesen des Katalogs: %v", err)
+		}
+	}
+	if err := mergeCatalogEntryFiles(backupDir, catalog); err != nil {
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// Verzeichnis für einzeln gespeicherte Katalogeinträge auf Remote-Zielen mit RemoteAppendOnly
+const catalogEntriesDir = "catalog.d"
+
+// addCatalogEntryFile legt einen Katalogeintrag als eigene Datei an, ohne Vorhandenes zu ändern
+func addCatalogEntryFile(dir string, entry CatalogEntry) error {
+	if err := os.MkdirAll(filepath.Join(dir, catalogEntriesDir), 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(entry, "", "    ")
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, catalogEntriesDir, entry.File+".json"), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// mergeCatalogEntryFiles übernimmt die Einträge aus catalog.d, die catalog.json noch nicht kennt
+func mergeCatalogEntryFiles(dir string, catalog *Catalog) error {
+	files, err := filepath.Glob(filepath.Join(dir, catalogEntriesDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var entry CatalogEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("fehler beim Lesen von %s: %v", file, err)
+		}
+		if _, ok := catalog.find(entry.File); !ok {
+			catalog.Backups = append(catalog.Backups, entry)
+		}
+	}
+	return nil
+}
+
+// loadLayoutCatalogs fasst die Kataloge aller Projektverzeichnisse des Layouts "project" zusammen
+func loadLayoutCatalogs(root string) (*Catalog, error) {
+	dirs, err := filepath.Glob(filepath.Join(root, "*", catalogFileName))
+	if err != nil {
+		return nil, err
+	}
+	merged := &Catalog{}
+	for _, path := range dirs {
+		catalog, err := loadCatalog(filepath.Dir(path))
+		if err != nil {
+			return nil, err
+		}
+		merged.Backups = append(merged.Backups, catalog.Backups...)
+	}
+	return merged, nil
+}
+
+func saveCatalog(backupDir string, catalog *Catalog) error {
+	data, err := json.MarshalIndent(catalog, "", "    ")
+	if err != nil {
+		return err
+	}
+	// Erst in temporäre Datei schreiben, damit ein Abbruch den Katalog nicht zerstört
+	path := filepath.Join(backupDir, catalogFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// updateCatalog lädt den Katalog, wendet change an und speichert ihn wieder. Die Sperre
+// verhindert, dass parallele Backups in dasselbe Verzeichnis Einträge verlieren.
+func updateCatalog(backupDir string, change func(c *Catalog)) error {
+	return withLock(filepath.Join(backupDir, catalogFileName), func() error {
+		catalog, err := loadCatalog(backupDir)
+		if err != nil {
+			return err
+		}
+		change(catalog)
+		if err := checkLease(backupDir); err != nil {
+			return err
+		}
+		return saveCatalog(backupDir, catalog)
+	})
+}
+
+// withLock führt fn mit einer exklusiven Sperre auf path+".lock" aus
+func withLock(path string, fn func() error) error {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+	return fn()
+}
+
+func (c *Catalog) add(entry CatalogEntry) {
+	c.remove(entry.File)
+	c.Backups = append(c.Backups, entry)
+}
+
+func (c *Catalog) remove(file string) {
+	kept := c.Backups[:0]
+	for _, entry := range c.Backups {
+		if entry.File != file {
+			kept = append(kept, entry)
+		}
+	}
+	c.Backups = kept
+}
+
+// removeArchive entfernt ein Archiv samt aller Markierungen, die darauf verweisen
+func (c *Catalog) removeArchive(file string) {
+	kept := c.Backups[:0]
+	for _, entry := range c.Backups {
+		if entry.File != file && entry.SameAs != file {
+			kept = append(kept, entry)
+		}
+	}
+	c.Backups = kept
+}
+
+func (c *Catalog) find(file string) (CatalogEntry, bool) {
+	for _, entry := range c.Backups {
+		if entry.File == file {
+			return entry, true
+		}
+	}
+	return CatalogEntry{}, false
+}
+
+// forProject liefert die Backups eines Projekts, älteste zuerst
+func (c *Catalog) forProject(project string) []CatalogEntry {
+	var entries []CatalogEntry
+	for _, entry := range c.Backups {
+		if entry.Project == project {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Created.Before(entries[j].Created)
+	})
+	return entries
+}
+
+// latestBefore liefert das neueste Backup, das zum Zeitpunkt t oder davor erstellt wurde
+func (c *Catalog) latestBefore(project string, t time.Time) (CatalogEntry, bool) {
+	entries := c.forProject(project)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].Created.After(t) {
+			return entries[i], true
+		}
+	}
+	return CatalogEntry{}, false
+}
+
+// Anzahl der letzten Backups, deren Kompressionsverhältnis in die Platzprüfung eingeht
+const ratioHistory = 5
+
+// compressionRatio liefert das ungünstigste Verhältnis von Archiv- zu Quellgröße der
+// letzten Backups eines Projekts mit derselben Kompression
+func (c *Catalog) compressionRatio(project, compression string) (float64, bool) {
+	entries := c.forProject(project)
+	worst, found := 0.0, 0
+	for i := len(entries) - 1; i >= 0 && found < ratioHistory; i-- {
+		entry := entries[i]
+		if entry.SameAs != "" || entry.Size == 0 || entry.SourceSize == 0 || entry.Compression != compression {
+			continue
+		}
+		if ratio := float64(entry.Size) / float64(entry.SourceSize); ratio > worst {
+			worst = ratio
+		}
+		found++
+	}
+	return worst, found > 0
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const (
+	colorRed    = "\033[31m"
+	colorYellow = "\033[33m"
+	colorGreen  = "\033[32m"
+	colorReset  = "\033[0m"
+)
+
+// colorEnabled gilt für die Meldungen auf stderr
+var colorEnabled bool
+
+// setColorMode wertet --color aus; bei "auto" nur auf einem Terminal und ohne NO_COLOR
+func setColorMode(mode string) error {
+	switch mode {
+	case "always":
+		colorEnabled = true
+	case "never":
+		colorEnabled = false
+	case "", "auto":
+		_, noColor := os.LookupEnv("NO_COLOR")
+		colorEnabled = !noColor && os.Getenv("TERM") != "dumb" && isTerminal(os.Stderr)
+	default:
+		return fmt.Errorf("ungültiger Wert für --color: %q (möglich: auto, always, never)", mode)
+	}
+	return nil
+}
+
+func colorize(color, s string) string {
+	if !colorEnabled {
+		return s
+	}
+	return color + s + colorReset
+}
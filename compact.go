@@ -0,0 +1,91 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+)
+
+// runCompact dünnt alte Backups aus: Von allem, was älter als --older-than Tage ist,
+// bleibt je Monat (bzw. Woche oder Jahr) nur das neueste Backup. Jüngere Backups bleiben
+// unberührt, so bleibt der grobe Verlauf erhalten, ohne dass sich Archive häufen.
+func runCompact(args []string) error {
+	flags := flag.NewFlagSet("compact", flag.ExitOnError)
+	olderThan := flags.Int("older-than", 90, "nur Backups ausdünnen, die älter als so viele Tage sind")
+	per := flags.String("per", "month", "je Zeitraum ein Backup behalten: week, month oder year")
+	fromRemote := flags.Bool("remote", false, "Remote-Ziel statt des lokalen Backup-Verzeichnisses ausdünnen")
+	all := flags.Bool("all", false, "alle Projekte ausdünnen")
+	dryRun := flags.Bool("dry-run", false, "nur anzeigen, was gelöscht würde")
+	flags.Parse(args)
+
+	if *olderThan < 0 {
+		return fmt.Errorf("--older-than darf nicht negativ sein")
+	}
+	if !containsString([]string{"week", "month", "year"}, *per) {
+		return fmt.Errorf("ungültiger Zeitraum %q (week, month oder year)", *per)
+	}
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	dir := config.BackupDir
+	if *fromRemote {
+		remote, err := openRemote(config)
+		if err != nil {
+			return err
+		}
+		if remote.appendOnly {
+			return fmt.Errorf("das Remote-Ziel ist RemoteAppendOnly, dort räumt nur \"prune --remote\" auf")
+		}
+		dir = remote.root
+		if !*dryRun {
+			release, err := acquireLease(dir)
+			if err != nil {
+				return err
+			}
+			defer release()
+		}
+	}
+	catalog, err := loadCatalog(dir)
+	if err != nil {
+		return err
+	}
+	projects := []string{projectName}
+	if *all {
+		projects = catalog.projects()
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -*olderThan)
+	var removed []string
+	for _, project := range projects {
+		var old []CatalogEntry
+		for _, entry := range catalog.forProject(project) {
+			if entry.Created.Before(cutoff) {
+				old = append(old, entry)
+			}
+		}
+		// Dieselbe Auswahl wie bei Retention, nur auf die alten Backups angewandt
+		var policy retentionPolicy
+		switch *per {
+		case "week":
+			policy.Weekly = len(old)
+		case "month":
+			policy.Monthly = len(old)
+		case "year":
+			policy.Yearly = len(old)
+		}
+		for _, entry := range policy.removals(old) {
+			fmt.Printf("Lösche %s vom %s\n", entry.File, formatDateTime(entry.Created))
+			removed = append(removed, entry.File)
+		}
+	}
+	if *dryRun {
+		fmt.Printf("%d Backups würden gelöscht\n", len(removed))
+		return nil
+	}
+	if err := deleteArchives(dir, removed, fmt.Sprintf("compact, älter als %d Tage, eines je %s", *olderThan, *per)); err != nil {
+		return err
+	}
+	fmt.Printf("✓ %d Backups in %s gelöscht\n", len(removed), dir)
+	return nil
+}
@@ -0,0 +1,620 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// compressionFormat beschreibt, wie Archive komprimiert und gelesen werden. Formate
+// ohne Go-Implementierung nutzen wie bisher tar ein externes Programm.
+type compressionFormat struct {
+	Name         string
+	Extension    string // Dateiendung des Archivs, z.B. ".tar.gz"
+	Binary       string // externes Programm; leer = Go-Standardbibliothek
+	DefaultLevel int
+	MaxLevel     int
+	BenchLevels  []int // Stufen, die bench ausprobiert
+
+	alternatives   []string // weitere Namen des Programms
+	magic          []byte
+	compressArgs   func(level int) []string
+	decompressArgs []string
+	memory         func(level int) int64 // ungefährer Speicherbedarf je Thread
+
+	// Container wie 7z lassen sich nicht als Datenstrom schreiben; das Programm
+	// erhält stattdessen den Pfad des Archivs
+	createArgs  func(archivePath string, level int, encrypted bool) []string
+	extractArgs func(archivePath string, encrypted bool) []string
+}
+
+var compressionFormats = []*compressionFormat{
+	{
+		Name: "gzip", Extension: ".tar.gz",
+		DefaultLevel: 6, MaxLevel: gzip.BestCompression, BenchLevels: []int{1, 6, 9},
+		magic: []byte{0x1f, 0x8b},
+	},
+	{
+		Name: "zstd", Extension: ".tar.zst", Binary: "zstd",
+		DefaultLevel: 3, MaxLevel: 19, BenchLevels: []int{1, 3, 9, 19},
+		magic: []byte{0x28, 0xb5, 0x2f, 0xfd},
+		compressArgs: func(level int) []string {
+			return []string{"-q", "-c", fmt.Sprintf("-T%d", compressorThreadCount(zstdMemory(level))), fmt.Sprintf("-%d", level)}
+		},
+		decompressArgs: []string{"-q", "-d", "-c"},
+		memory:         zstdMemory,
+	},
+	{
+		// Für Langzeitarchive, bei denen die Größe mehr zählt als die Dauer
+		Name: "xz", Extension: ".tar.xz", Binary: "xz",
+		DefaultLevel: 6, MaxLevel: 9, BenchLevels: []int{1, 6, 9},
+		magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00},
+		compressArgs: func(level int) []string {
+			return []string{"-q", "-c", fmt.Sprintf("-T%d", compressorThreadCount(lzmaMemory(level))), fmt.Sprintf("-%d", level)}
+		},
+		decompressArgs: []string{"-q", "-d", "-c", "-T0"},
+		memory:         lzmaMemory,
+	},
+	{
+		// Für lokale Schnappschüsse, bei denen nur die Geschwindigkeit zählt
+		Name: "lz4", Extension: ".tar.lz4", Binary: "lz4",
+		DefaultLevel: 1, MaxLevel: 12, BenchLevels: []int{1, 9},
+		magic: []byte{0x04, 0x22, 0x4d, 0x18},
+		compressArgs: func(level int) []string {
+			return []string{"-q", "-c", fmt.Sprintf("-%d", level)}
+		},
+		decompressArgs: []string{"-q", "-d", "-c"},
+	},
+	{
+		// Höchste Kompression für Uploads auf bezahlten Speicher; brotli hat keine
+		// Kennung im Dateikopf und wird an der Endung erkannt
+		Name: "brotli", Extension: ".tar.br", Binary: "brotli",
+		DefaultLevel: 9, MaxLevel: 11, BenchLevels: []int{5, 9, 11},
+		compressArgs: func(level int) []string {
+			return []string{"-c", "-q", strconv.Itoa(level)}
+		},
+		decompressArgs: []string{"-d", "-c"},
+	},
+	{
+		// Der tar-Strom wird als einzelner Eintrag gespeichert und damit solid komprimiert.
+		// Mit BACKUP_7Z_PASSWORD werden Inhalt und Namen verschlüsselt.
+		Name: "7z", Extension: ".tar.7z", Binary: "7z", alternatives: []string{"7zz", "7za"},
+		DefaultLevel: 5, MaxLevel: 9, BenchLevels: []int{1, 5, 9},
+		magic: []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c},
+		createArgs: func(archivePath string, level int, encrypted bool) []string {
+			name := strings.TrimSuffix(filepath.Base(archivePath), ".7z")
+			args := []string{"a", "-t7z", "-bso0", "-bsp0", "-y", "-ms=on", fmt.Sprintf("-mx=%d", level)}
+			if threads := compressorThreadCount(lzmaMemory(level)); threads > 0 {
+				args = append(args, fmt.Sprintf("-mmt=%d", threads))
+			}
+			if !encrypted {
+				return append(args, "-si"+name, archivePath)
+			}
+			// Ohne Wert fragt 7z das Passwort auf stdin ab; der tar-Strom kommt dann über
+			// die benannte Pipe name im Arbeitsverzeichnis (siehe passwordWriter)
+			return append(args, "-p", "-mhe=on", archivePath, name)
+		},
+		memory: lzmaMemory,
+		extractArgs: func(archivePath string, encrypted bool) []string {
+			args := []string{"e", "-so", "-bsp0", "-y"}
+			if encrypted {
+				args = append(args, "-p")
+			}
+			return append(args, archivePath)
+		},
+	},
+}
+
+// encrypted meldet, ob Archive dieses Formats verschlüsselt werden (7z mit Passwort)
+func (f *compressionFormat) encrypted() bool {
+	return f.Name == "7z" && sevenZipPassword() != ""
+}
+
+// sevenZipPassword liefert das Passwort für 7z-Archive aus BACKUP_7Z_PASSWORD
+func sevenZipPassword() string {
+	return os.Getenv("BACKUP_7Z_PASSWORD")
+}
+
+// compressionByName liefert das konfigurierte Format; leer bedeutet gzip
+func compressionByName(name string) (*compressionFormat, error) {
+	if name == "" {
+		name = "gzip"
+	}
+	var names []string
+	for _, format := range compressionFormats {
+		if format.Name == strings.ToLower(name) {
+			return format, nil
+		}
+		names = append(names, format.Name)
+	}
+	return nil, fmt.Errorf("unbekannte Kompression %q (möglich: %s)", name, strings.Join(names, ", "))
+}
+
+// available prüft, ob das benötigte externe Programm installiert ist
+func (f *compressionFormat) available() error {
+	if f.Binary == "" {
+		return nil
+	}
+	_, err := f.command()
+	return err
+}
+
+// command sucht das externe Programm unter allen bekannten Namen
+func (f *compressionFormat) command() (string, error) {
+	for _, name := range append([]string{f.Binary}, f.alternatives...) {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s wird für die Kompression %s benötigt, ist aber nicht installiert", f.Binary, f.Name)
+}
+
+// level prüft die gewünschte Stufe; 0 bedeutet die Standardstufe des Formats
+func (f *compressionFormat) level(level int) (int, error) {
+	if level == 0 {
+		return f.DefaultLevel, nil
+	}
+	if level < 1 || level > f.MaxLevel {
+		return 0, fmt.Errorf("kompressionsstufe %d für %s ungültig (1-%d)", level, f.Name, f.MaxLevel)
+	}
+	return level, nil
+}
+
+// create legt das Archiv an und liefert einen Writer für den tar-Strom
+func (f *compressionFormat) create(archivePath string, level int) (io.WriteCloser, error) {
+	return f.createWithPassword(archivePath, level, sevenZipPassword())
+}
+
+// createWithPassword ist create mit einem ausdrücklich angegebenen 7z-Passwort; leer
+// bedeutet unverschlüsselt, andere Formate ignorieren es
+func (f *compressionFormat) createWithPassword(archivePath string, level int, password string) (io.WriteCloser, error) {
+	if f.createArgs != nil {
+		bin, err := f.command()
+		if err != nil {
+			return nil, err
+		}
+		if password != "" {
+			return newPasswordWriter(f, bin, archivePath, level, password)
+		}
+		return startExternal(exec.Command(bin, f.createArgs(archivePath, level, false)...), f.Binary)
+	}
+	out, err := os.Create(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	zw, err := f.newWriter(out, level)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	return &compressedWriter{zw: zw, file: out}, nil
+}
+
+func (f *compressionFormat) newWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	if f.Binary == "" {
+		return gzip.NewWriterLevel(w, level)
+	}
+	bin, err := f.command()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(bin, f.compressArgs(level)...)
+	cmd.Stdout = w
+	return startExternal(cmd, f.Binary)
+}
+
+// open liefert den entpackten tar-Strom eines Archivs
+func (f *compressionFormat) open(archivePath string) (io.ReadCloser, error) {
+	return f.openWithPassword(archivePath, sevenZipPassword())
+}
+
+// openWithPassword ist open mit einem ausdrücklich angegebenen 7z-Passwort
+func (f *compressionFormat) openWithPassword(archivePath, password string) (io.ReadCloser, error) {
+	if f.extractArgs != nil {
+		bin, err := f.command()
+		if err != nil {
+			return nil, err
+		}
+		cmd := exec.Command(bin, f.extractArgs(archivePath, password != "")...)
+		if password != "" {
+			passwordInput(cmd, password)
+		}
+		return startReader(cmd, f.Binary)
+	}
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	r, err := f.newReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &archiveFile{file: file, r: r}, nil
+}
+
+func (f *compressionFormat) newReader(r io.Reader) (io.ReadCloser, error) {
+	if f.Binary == "" {
+		return gzip.NewReader(r)
+	}
+	bin, err := f.command()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(bin, f.decompressArgs...)
+	cmd.Stdin = r
+	return startReader(cmd, f.Binary)
+}
+
+// detectCompression erkennt das Format eines Archivs an den ersten Bytes, bei Formaten
+// ohne Kennung an der Endung des Dateinamens
+func detectCompression(r *bufio.Reader, name string) (*compressionFormat, error) {
+	for _, format := range compressionFormats {
+		if format.magic == nil {
+			continue
+		}
+		head, err := r.Peek(len(format.magic))
+		if err == nil && bytes.Equal(head, format.magic) {
+			return format, nil
+		}
+	}
+	for _, format := range compressionFormats {
+		if format.magic == nil && strings.HasSuffix(name, format.Extension) {
+			return format, nil
+		}
+	}
+	return nil, fmt.Errorf("unbekanntes Archivformat")
+}
+
+// detectArchiveExtension liefert die passende Endung für eine vorhandene Archivdatei
+func detectArchiveExtension(archivePath string) (string, error) {
+	if isZipFile(archivePath) {
+		return zipExtension, nil
+	}
+	format, err := fileCompression(archivePath)
+	if err != nil {
+		return "", err
+	}
+	return format.Extension, nil
+}
+
+// fileCompression ermittelt das Format einer Archivdatei
+func fileCompression(archivePath string) (*compressionFormat, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return detectCompression(bufio.NewReader(f), archivePath)
+}
+
+// archiveExtension liefert die Endung eines Archivnamens oder "", wenn es keiner ist
+func archiveExtension(name string) string {
+	if strings.HasSuffix(name, zipExtension) {
+		return zipExtension
+	}
+	if strings.HasSuffix(name, snapshotExtension) {
+		return snapshotExtension
+	}
+	for _, format := range compressionFormats {
+		if strings.HasSuffix(name, format.Extension) {
+			return format.Extension
+		}
+	}
+	return ""
+}
+
+// projectArchives findet alle Archive eines Projekts im Backup-Verzeichnis, unabhängig vom Format
+func projectArchives(backupDir, projectName string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(backupDir, projectName+"_backup_*"))
+	if err != nil {
+		return nil, err
+	}
+	var archives []string
+	for _, match := range matches {
+		if archiveExtension(match) != "" {
+			archives = append(archives, match)
+		}
+	}
+	return archives, nil
+}
+
+// externalWriter leitet die Daten an ein externes Kompressionsprogramm weiter
+type externalWriter struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *bytes.Buffer
+	name   string
+}
+
+func startExternal(cmd *exec.Cmd, name string) (*externalWriter, error) {
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s konnte nicht gestartet werden: %v", name, err)
+	}
+	return &externalWriter{cmd: cmd, stdin: stdin, stderr: stderr, name: name}, nil
+}
+
+func (w *externalWriter) Write(p []byte) (int, error) {
+	n, err := w.stdin.Write(p)
+	if err != nil {
+		w.cmd.Wait()
+		return n, fmt.Errorf("%s: %v %s", w.name, err, strings.TrimSpace(w.stderr.String()))
+	}
+	return n, nil
+}
+
+func (w *externalWriter) Close() error {
+	w.stdin.Close()
+	if err := w.cmd.Wait(); err != nil {
+		return fmt.Errorf("%s: %v %s", w.name, err, strings.TrimSpace(w.stderr.String()))
+	}
+	return nil
+}
+
+// passwordWriter übergibt den tar-Strom eines verschlüsselten 7z-Archivs über eine
+// benannte Pipe in einem privaten Verzeichnis neben dem Archiv. Auf der Kommandozeile
+// wäre das Passwort für jeden Benutzer in ps sichtbar, und stdin ist bei -si schon mit
+// dem tar-Strom belegt; so bleibt stdin für das Passwort frei, und der unverschlüsselte
+// Inhalt landet nie auf der Platte.
+type passwordWriter struct {
+	pipe   *os.File
+	cmd    *exec.Cmd
+	dir    string
+	stderr *bytes.Buffer
+	done   chan error // Ergebnis von cmd.Wait
+	closed bool
+}
+
+// passwordDirPrefix beginnt die Namen der Verzeichnisse mit der Pipe; dahinter steht die
+// PID des Backups, damit removeStalePasswordDirs Reste abgestürzter Läufe erkennt
+const passwordDirPrefix = ".7z-"
+
+func newPasswordWriter(f *compressionFormat, bin, archivePath string, level int, password string) (*passwordWriter, error) {
+	archivePath, err := filepath.Abs(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	// MkdirTemp legt das Verzeichnis mit 0700 an
+	dir, err := os.MkdirTemp(filepath.Dir(archivePath), fmt.Sprintf("%s%d-", passwordDirPrefix, os.Getpid()))
+	if err != nil {
+		return nil, err
+	}
+	// 7z übernimmt den Dateinamen als Namen des Eintrags, wie bei -si
+	fifo := filepath.Join(dir, strings.TrimSuffix(filepath.Base(archivePath), ".7z"))
+	if err := syscall.Mkfifo(fifo, 0600); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	cmd := exec.Command(bin, f.createArgs(archivePath, level, true)...)
+	cmd.Dir = dir
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	passwordInput(cmd, password)
+	if err := cmd.Start(); err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("%s konnte nicht gestartet werden: %v", f.Binary, err)
+	}
+	w := &passwordWriter{cmd: cmd, dir: dir, stderr: stderr, done: make(chan error, 1)}
+	go func() { w.done <- cmd.Wait() }()
+
+	// Das Öffnen wartet, bis 7z die Pipe liest; beendet sich 7z vorher, gibt ein eigener
+	// Leser das Öffnen wieder frei
+	opened := make(chan error, 1)
+	go func() {
+		var err error
+		w.pipe, err = os.OpenFile(fifo, os.O_WRONLY, 0)
+		opened <- err
+	}()
+	select {
+	case err := <-opened:
+		if err != nil {
+			w.abort()
+			return nil, err
+		}
+		return w, nil
+	case err := <-w.done:
+		if r, openErr := os.OpenFile(fifo, os.O_RDONLY|syscall.O_NONBLOCK, 0); openErr == nil {
+			defer r.Close()
+		}
+		if <-opened == nil {
+			w.pipe.Close()
+		}
+		os.RemoveAll(dir)
+		if err == nil {
+			err = fmt.Errorf("eingabe nicht gelesen")
+		}
+		return nil, w.error(err)
+	}
+}
+
+func (w *passwordWriter) error(err error) error {
+	return fmt.Errorf("%s: %v %s", filepath.Base(w.cmd.Path), err, strings.TrimSpace(w.stderr.String()))
+}
+
+func (w *passwordWriter) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, fmt.Errorf("%s wurde abgebrochen", filepath.Base(w.cmd.Path))
+	}
+	n, err := w.pipe.Write(p)
+	if err != nil {
+		w.abort()
+		return n, w.error(err)
+	}
+	return n, nil
+}
+
+// Close beendet den tar-Strom; erst dann schließt 7z das Archiv ab
+func (w *passwordWriter) Close() error {
+	if w.closed {
+		return fmt.Errorf("%s wurde abgebrochen", filepath.Base(w.cmd.Path))
+	}
+	w.closed = true
+	defer os.RemoveAll(w.dir)
+	closeErr := w.pipe.Close()
+	if err := <-w.done; err != nil {
+		return w.error(err)
+	}
+	return closeErr
+}
+
+// abort beendet 7z, ohne aus dem bisher geschriebenen Teil ein Archiv zu machen
+func (w *passwordWriter) abort() {
+	if w.closed {
+		return
+	}
+	w.closed = true
+	// Eigene Sitzung (passwordInput): die Prozessgruppe hat die PID von 7z
+	syscall.Kill(-w.cmd.Process.Pid, syscall.SIGKILL)
+	if w.pipe != nil {
+		w.pipe.Close()
+	}
+	<-w.done
+	os.RemoveAll(w.dir)
+}
+
+// aborter erfüllen Writer, die beim Schließen das Archiv abschließen; nach einem Fehler
+// bricht abortWriter sie ab, statt ein unvollständiges Archiv entstehen zu lassen
+type aborter interface {
+	abort()
+}
+
+// abortWriter gibt w nach einem Fehler auf; Writer ohne abort werden nur geschlossen
+func abortWriter(w io.Closer) {
+	if a, ok := w.(aborter); ok {
+		a.abort()
+		return
+	}
+	w.Close()
+}
+
+// removeStalePasswordDirs entfernt beim Start Verzeichnisse von passwordWriter, deren
+// Backup nicht mehr läuft
+func removeStalePasswordDirs(backupDir string) {
+	matches, _ := filepath.Glob(filepath.Join(backupDir, passwordDirPrefix+"*"))
+	for _, match := range matches {
+		var pid int
+		_, err := fmt.Sscanf(filepath.Base(match), passwordDirPrefix+"%d-", &pid)
+		if err == nil && pid > 0 && syscall.Kill(pid, 0) != syscall.ESRCH {
+			continue
+		}
+		logMessage(LogInfo, "Entferne Rest eines abgebrochenen 7z-Laufs: %s", match)
+		if err := os.RemoveAll(match); err != nil {
+			logMessage(LogWarning, "%v", err)
+		}
+	}
+}
+
+// passwordInput übergibt das Passwort auf stdin. In einer eigenen Sitzung ohne Terminal
+// liest auch p7zip dort statt von /dev/tty; die zweite Zeile beantwortet die Rückfrage,
+// die manche Versionen beim Anlegen stellen.
+func passwordInput(cmd *exec.Cmd, password string) {
+	cmd.Stdin = strings.NewReader(password + "\n" + password + "\n")
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// compressedWriter schließt nach dem Kompressor auch die Archivdatei
+type compressedWriter struct {
+	zw   io.WriteCloser
+	file *os.File
+}
+
+func (w *compressedWriter) Write(p []byte) (int, error) {
+	return w.zw.Write(p)
+}
+
+func (w *compressedWriter) Close() error {
+	err := w.zw.Close()
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// archiveFile schließt nach dem Entpacker auch die Archivdatei
+type archiveFile struct {
+	file *os.File
+	r    io.ReadCloser
+}
+
+func (a *archiveFile) Read(p []byte) (int, error) {
+	return a.r.Read(p)
+}
+
+func (a *archiveFile) Close() error {
+	a.r.Close()
+	return a.file.Close()
+}
+
+func startReader(cmd *exec.Cmd, name string) (*externalReader, error) {
+	// Nach einem Abbruch nicht ewig auf Kindprozesse des Programms warten
+	cmd.WaitDelay = time.Second
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("%s konnte nicht gestartet werden: %v", name, err)
+	}
+	return &externalReader{cmd: cmd, out: out, stderr: stderr, name: name}, nil
+}
+
+// externalReader liest die Ausgabe eines externen Entpackprogramms
+type externalReader struct {
+	cmd    *exec.Cmd
+	out    io.ReadCloser
+	stderr *bytes.Buffer
+	name   string
+	done   bool
+}
+
+func (r *externalReader) Read(p []byte) (int, error) {
+	n, err := r.out.Read(p)
+	if err == io.EOF && !r.done {
+		r.done = true
+		if waitErr := r.cmd.Wait(); waitErr != nil {
+			return n, fmt.Errorf("%s: %v %s", r.name, waitErr, strings.TrimSpace(r.stderr.String()))
+		}
+	}
+	return n, err
+}
+
+// Close beendet das Programm auch dann, wenn nicht bis zum Ende gelesen wurde
+func (r *externalReader) Close() error {
+	if !r.done {
+		r.done = true
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+	}
+	return nil
+}
+
+// compressedFile öffnet ein Archiv und liefert den entpackten Datenstrom
+func compressedFile(archivePath string) (io.ReadCloser, error) {
+	return compressedFileWithPassword(archivePath, sevenZipPassword())
+}
+
+// compressedFileWithPassword ist compressedFile mit einem ausdrücklich angegebenen 7z-Passwort
+func compressedFileWithPassword(archivePath, password string) (io.ReadCloser, error) {
+	format, err := fileCompression(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return format.openWithPassword(archivePath, password)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testPassword = "geheim-1234"
+
+func TestEncryptedBackupWithout7zFails(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("BACKUP_7Z_PASSWORD", testPassword)
+
+	if _, err := backupCompression(&Config{Compression: "7z"}); err == nil {
+		t.Fatal("ohne 7z wurde trotz Passwort auf gzip ausgewichen")
+	}
+}
+
+func TestEncryptedSnapshotAndZipRefused(t *testing.T) {
+	t.Setenv("BACKUP_7Z_PASSWORD", testPassword)
+	for _, format := range []string{"snapshot", "zip"} {
+		if _, err := backupCompression(&Config{Compression: "7z", Format: format}); err == nil {
+			t.Errorf("Format %s mit Passwort wird unverschlüsselt gesichert", format)
+		}
+	}
+}
+
+func TestBackupWithout7zFallsBackToGzip(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("BACKUP_7Z_PASSWORD", "")
+
+	config := &Config{Compression: "7z", CompressionLevel: 9}
+	compression, err := backupCompression(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compression.Name != "gzip" || config.CompressionLevel != 0 {
+		t.Errorf("Kompression %s, Stufe %d; erwartet gzip mit Standardstufe", compression.Name, config.CompressionLevel)
+	}
+}
+
+func TestSevenZipArgsWithoutPassword(t *testing.T) {
+	t.Setenv("BACKUP_7Z_PASSWORD", testPassword)
+	format, err := compressionByName("7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := append(format.createArgs("/tmp/p_backup.tar.7z", 5, true), format.extractArgs("/tmp/p_backup.tar.7z", true)...)
+	for _, arg := range args {
+		if strings.Contains(arg, testPassword) {
+			t.Errorf("Passwort steht auf der Kommandozeile: %q", args)
+		}
+	}
+}
+
+// Ein Ersatz für 7z, der Argumente, stdin und die Eingabedatei festhält
+const fake7z = `#!/bin/sh
+printf '%s\n' "$@" > "$FAKE_DIR/args"
+cat > "$FAKE_DIR/stdin"
+for last; do :; done
+cat "$last" > "$FAKE_DIR/input"
+`
+
+func TestEncrypted7zPasswordOnStdin(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "7z"), []byte(fake7z), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fakeDir := t.TempDir()
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_DIR", fakeDir)
+	t.Setenv("BACKUP_7Z_PASSWORD", testPassword)
+
+	format, err := compressionByName("7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupDir := t.TempDir()
+	w, err := format.create(filepath.Join(backupDir, "p_backup_x.tar.7z"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("tar-strom")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	args, _ := os.ReadFile(filepath.Join(fakeDir, "args"))
+	if strings.Contains(string(args), testPassword) {
+		t.Errorf("Passwort steht auf der Kommandozeile: %q", args)
+	}
+	if stdin, _ := os.ReadFile(filepath.Join(fakeDir, "stdin")); !strings.HasPrefix(string(stdin), testPassword+"\n") {
+		t.Errorf("7z erhielt auf stdin %q statt des Passworts", stdin)
+	}
+	if input, _ := os.ReadFile(filepath.Join(fakeDir, "input")); string(input) != "tar-strom" {
+		t.Errorf("7z erhielt als Eingabe %q", input)
+	}
+	// Das Verzeichnis mit der Pipe ist wieder weg
+	if entries, _ := os.ReadDir(backupDir); len(entries) != 0 {
+		t.Errorf("Reste im Backup-Verzeichnis: %v", entries)
+	}
+}
+
+// install7z legt ein Ersatzprogramm für 7z an und liefert das Verzeichnis für dessen Ausgaben
+func install7z(t *testing.T, script string) string {
+	t.Helper()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "7z"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fakeDir := t.TempDir()
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_DIR", fakeDir)
+	t.Setenv("BACKUP_7Z_PASSWORD", testPassword)
+	return fakeDir
+}
+
+func TestEncrypted7zAbortSkipsArchive(t *testing.T) {
+	fakeDir := install7z(t, `#!/bin/sh
+cat > /dev/null
+for last; do :; done
+cat "$last" > "$FAKE_DIR/input"
+touch "$FAKE_DIR/done"
+`)
+	format, _ := compressionByName("7z")
+	backupDir := t.TempDir()
+	w, err := format.create(filepath.Join(backupDir, "p_backup_x.tar.7z"), 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("halber tar-strom")); err != nil {
+		t.Fatal(err)
+	}
+	abortWriter(w)
+
+	if _, err := os.Stat(filepath.Join(fakeDir, "done")); !os.IsNotExist(err) {
+		t.Error("7z hat nach dem Abbruch ein Archiv abgeschlossen")
+	}
+	if err := w.Close(); err == nil {
+		t.Error("Close nach dem Abbruch meldet Erfolg")
+	}
+	if entries, _ := os.ReadDir(backupDir); len(entries) != 0 {
+		t.Errorf("Reste im Backup-Verzeichnis: %v", entries)
+	}
+}
+
+func TestEncrypted7zEarlyExit(t *testing.T) {
+	install7z(t, "#!/bin/sh\necho 'falsches Argument' >&2\nexit 2\n")
+	format, _ := compressionByName("7z")
+	backupDir := t.TempDir()
+	if _, err := format.create(filepath.Join(backupDir, "p_backup_x.tar.7z"), 5); err == nil || !strings.Contains(err.Error(), "falsches Argument") {
+		t.Errorf("Fehler %v, erwartet die Meldung von 7z", err)
+	}
+	if entries, _ := os.ReadDir(backupDir); len(entries) != 0 {
+		t.Errorf("Reste im Backup-Verzeichnis: %v", entries)
+	}
+}
+
+func TestRemoveStalePasswordDirs(t *testing.T) {
+	dir := t.TempDir()
+	own := fmt.Sprintf("%s%d-1", passwordDirPrefix, os.Getpid())
+	for _, name := range []string{own, passwordDirPrefix + "999999999-2", passwordDirPrefix + "123"} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	removeStalePasswordDirs(dir)
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 || entries[0].Name() != own {
+		t.Errorf("übrig: %v, erwartet nur %s", entries, own)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Standardgrenze für SkipContent: kleinere Dateien werden nie nach Inhalt ausgelassen
+const defaultSkipContentMinSize = 10 << 20
+
+// SkippedFile ist eine Datei, die wegen ihres Inhaltstyps nicht gesichert wurde
+type SkippedFile struct {
+	Path string
+	Size int64
+	Kind string
+}
+
+// contentKinds sind die Arten, die in SkipContent angegeben werden können
+var contentKinds = []string{"video", "audio", "image", "archive", "disk-image"}
+
+// contentSignatures ergänzen http.DetectContentType um Formate, die es nicht kennt
+var contentSignatures = []struct {
+	offset int
+	magic  []byte
+	kind   string
+}{
+	{0, []byte("QFI\xfb"), "disk-image"},                  // qcow2
+	{0, []byte("KDMV"), "disk-image"},                     // VMDK
+	{0, []byte("# Disk DescriptorFile"), "disk-image"},    // VMDK-Beschreibung
+	{0, []byte("<<< Oracle VM VirtualBox"), "disk-image"}, // VDI
+	{0, []byte("vhdxfile"), "disk-image"},                 // VHDX
+	{0, []byte("conectix"), "disk-image"},                 // VHD (dynamisch)
+	{0x8001, []byte("CD001"), "disk-image"},               // ISO 9660
+	{0, []byte{0xfd, '7', 'z', 'X', 'Z', 0}, "archive"},   // xz
+	{0, []byte{0x28, 0xb5, 0x2f, 0xfd}, "archive"},        // zstd
+	{0, []byte{'7', 'z', 0xbc, 0xaf, 0x27, 0x1c}, "archive"},
+	{0, []byte("BZh"), "archive"},
+}
+
+// detectContentKind ermittelt die Art einer Datei anhand ihres Anfangs, unabhängig von
+// der Endung; leer, wenn keine der contentKinds zutrifft
+func detectContentKind(path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	head := make([]byte, 0x8001+8)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+
+	for _, sig := range contentSignatures {
+		if len(head) >= sig.offset+len(sig.magic) && bytes.Equal(head[sig.offset:sig.offset+len(sig.magic)], sig.magic) {
+			return sig.kind
+		}
+	}
+	mime := http.DetectContentType(head)
+	switch {
+	case strings.HasPrefix(mime, "video/"):
+		return "video"
+	case strings.HasPrefix(mime, "audio/"):
+		return "audio"
+	case strings.HasPrefix(mime, "image/"):
+		return "image"
+	case mime == "application/zip", mime == "application/x-gzip", mime == "application/x-rar-compressed":
+		return "archive"
+	}
+	return ""
+}
+
+// isCompressedContent erkennt am Anfang einer Datei Formate, die bereits komprimiert
+// sind und sich nicht weiter verkleinern lassen
+func isCompressedContent(head []byte) bool {
+	if len(head) == 0 {
+		return false
+	}
+	for _, sig := range contentSignatures {
+		if sig.kind == "archive" && sig.offset == 0 && bytes.HasPrefix(head, sig.magic) {
+			return true
+		}
+	}
+	mime := http.DetectContentType(head)
+	switch {
+	case strings.HasPrefix(mime, "video/"):
+		return true
+	case strings.HasPrefix(mime, "font/woff"):
+		return true
+	}
+	switch mime {
+	case "image/jpeg", "image/png", "image/gif", "image/webp", "audio/mpeg", "application/ogg",
+		"application/zip", "application/x-gzip", "application/x-rar-compressed":
+		return true
+	}
+	return false
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
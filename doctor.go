@@ -0,0 +1,342 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// doctorCheck ist eine Zeile der Checkliste von doctor
+type doctorCheck struct {
+	name string
+	run  func() (string, error)
+	// warn: ein Fehler ist nur ein Hinweis und lässt doctor nicht scheitern
+	warn bool
+}
+
+// runDoctor prüft alles, was ein Backup braucht, ohne eines zu erstellen
+func runDoctor(args []string) error {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	offline := flags.Bool("offline", false, "Remote-Ziel und Benachrichtigungen nicht über das Netz prüfen")
+	flags.Parse(args)
+
+	config, sourceDir, projectName, err := loadProject()
+	if err != nil {
+		fmt.Println(colorize(colorRed, "✗ Konfiguration: "+err.Error()))
+		return fmt.Errorf("konfiguration ungültig")
+	}
+	fmt.Printf("Projekt %s (%s)\n\n", projectName, sourceDir)
+
+	checks := []doctorCheck{
+		{name: "Konfiguration", run: func() (string, error) { return configPath(), nil }},
+		{name: "Quellverzeichnis", run: func() (string, error) { return checkSourceReadable(sourceDir, config) }},
+		{name: "Programme", run: func() (string, error) { return checkTools(config) }},
+	}
+	checks = append(checks, preflightChecks(config, projectName)...)
+	checks = append(checks, []doctorCheck{
+		{name: "Verschlüsselung", run: func() (string, error) { return checkEncryption(config) }, warn: true},
+		{name: "Sperren", run: func() (string, error) { return checkLocks(config.BackupDir) }, warn: true},
+		{name: "Systemuhr", run: func() (string, error) { return checkClock(config.BackupDir) }},
+	}...)
+	if config.Remote != "" {
+		checks = append(checks, doctorCheck{name: "Remote-Ziel", run: func() (string, error) {
+			if *offline {
+				return "übersprungen (--offline)", nil
+			}
+			remote, err := openRemote(config)
+			if err != nil {
+				return "", err
+			}
+			return remote.root, checkPermissions(remote.root)
+		}})
+	}
+	if !*offline {
+		checks = append(checks, notifyChecks(config.Notify)...)
+	}
+
+	failed := 0
+	for _, check := range checks {
+		detail, err := check.run()
+		switch {
+		case err == nil:
+			fmt.Println(colorize(colorGreen, "✓ "+check.name) + detailSuffix(detail))
+		case check.warn:
+			fmt.Println(colorize(colorYellow, "! "+check.name) + ": " + err.Error())
+		default:
+			failed++
+			fmt.Println(colorize(colorRed, "✗ "+check.name) + ": " + err.Error())
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d von %d Prüfungen fehlgeschlagen", failed, len(checks))
+	}
+	fmt.Println("\nAlles bereit für ein Backup.")
+	return nil
+}
+
+// preflightChecks sind die Prüfungen, die jedes Backup vor der eigentlichen Arbeit ausführt
+func preflightChecks(config *Config, projectName string) []doctorCheck {
+	return []doctorCheck{
+		{name: "Backup-Ziel eingehängt", run: func() (string, error) { return config.BackupDir, checkMounted(config.BackupDir) }},
+		{name: "Backup-Ziel beschreibbar", run: func() (string, error) { return config.BackupDir, checkTargetWritable(config.BackupDir) }},
+		{name: "Speicherplatz", run: func() (string, error) { return checkSpace(config, projectName) }},
+	}
+}
+
+// preflight führt die Vorabprüfungen aus und liefert den ersten Fehler
+func preflight(config *Config, projectName string) error {
+	for _, check := range preflightChecks(config, projectName) {
+		detail, err := check.run()
+		if err != nil {
+			return fmt.Errorf("%s: %v", check.name, err)
+		}
+		logMessage(LogDebug, "Vorabprüfung %s: %s", check.name, detail)
+	}
+	return nil
+}
+
+func detailSuffix(detail string) string {
+	if detail == "" {
+		return ""
+	}
+	return ": " + detail
+}
+
+// checkSourceReadable prüft, ob alle nicht ausgeschlossenen Verzeichnisse der Quelle lesbar sind
+func checkSourceReadable(sourceDir string, config *Config) (string, error) {
+	excludes, err := configExcludes(config)
+	if err != nil {
+		return "", err
+	}
+	var unreadable []string
+	dirs := 0
+	filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+		rel, _ := filepath.Rel(sourceDir, path)
+		if err != nil {
+			unreadable = append(unreadable, filepath.ToSlash(rel))
+			return nil
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if rel != "." && isExcluded(filepath.ToSlash(rel), true, excludes) {
+			return filepath.SkipDir
+		}
+		dirs++
+		return nil
+	})
+	if len(unreadable) > 0 {
+		if len(unreadable) > 3 {
+			unreadable = append(unreadable[:3], "...")
+		}
+		return "", fmt.Errorf("%d Einträge nicht lesbar: %s", len(unreadable), strings.Join(unreadable, ", "))
+	}
+	return fmt.Sprintf("%d Verzeichnisse lesbar", dirs), nil
+}
+
+func checkTools(config *Config) (string, error) {
+	compression, err := compressionByName(config.Compression)
+	if err != nil {
+		return "", err
+	}
+	if err := compression.available(); err != nil {
+		return "", fmt.Errorf("%v (es würde gzip verwendet)", err)
+	}
+	if config.Notify.Email != "" {
+		if _, err := exec.LookPath("sendmail"); err != nil {
+			return "", fmt.Errorf("sendmail für Notify.Email nicht gefunden")
+		}
+	}
+	return compression.Name, nil
+}
+
+// Verzeichnisse, unter denen üblicherweise Wechseldatenträger und Netzlaufwerke liegen
+var mountRoots = []string{"/media", "/mnt", "/run/media", "/Volumes"}
+
+// checkMounted erkennt Backup-Ziele auf Wechseldatenträgern, die nicht eingehängt sind:
+// Das Ziel liegt dann auf demselben Dateisystem wie "/" und ein Backup würde
+// unbemerkt die Systemplatte füllen
+func checkMounted(dir string) error {
+	existing := existingParent(dir)
+	inMountRoot := false
+	for _, root := range mountRoots {
+		if strings.HasPrefix(dir, root+"/") {
+			inMountRoot = true
+		}
+	}
+	if !inMountRoot {
+		return nil
+	}
+	var target, rootfs syscall.Stat_t
+	if syscall.Stat(existing, &target) != nil || syscall.Stat("/", &rootfs) != nil {
+		return nil
+	}
+	if target.Dev == rootfs.Dev {
+		return fmt.Errorf("%s liegt auf der Systemplatte, der Datenträger ist vermutlich nicht eingehängt", dir)
+	}
+	return nil
+}
+
+// existingParent liefert dir oder das nächste übergeordnete Verzeichnis, das existiert
+func existingParent(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// missingDirs liefert dir und seine übergeordneten Verzeichnisse, die noch nicht existieren
+func missingDirs(dir string) []string {
+	var missing []string
+	for existing := existingParent(dir); dir != existing; dir = filepath.Dir(dir) {
+		missing = append(missing, dir)
+	}
+	return missing
+}
+
+// checkTargetWritable prüft das Backup-Verzeichnis; fehlt es, muss es sich anlegen lassen.
+// Eine Probedatei wird nur im Backup-Verzeichnis selbst angelegt, im übergeordneten
+// Verzeichnis (womöglich das Projekt) würde sie Dateibeobachter und Sync-Programme wecken.
+func checkTargetWritable(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := checkAccess(existingParent(dir)); err != nil {
+			return fmt.Errorf("%s fehlt und kann nicht angelegt werden: %v", dir, err)
+		}
+		return nil
+	}
+	return checkPermissions(dir)
+}
+
+// checkSpace prüft, ob neben der Mindestreserve noch Platz für ein Backup in der Größe des letzten ist
+func checkSpace(config *Config, project string) (string, error) {
+	reserve, err := minFreeSpace(config)
+	if err != nil {
+		return "", err
+	}
+	free, err := freeSpace(existingParent(config.BackupDir))
+	if err != nil {
+		return "", err
+	}
+	var last int64
+	if catalog, err := loadCatalog(config.BackupDir); err == nil {
+		for _, entry := range catalog.forProject(project) {
+			if entry.Size > 0 {
+				last = entry.Size
+			}
+		}
+	}
+	detail := fmt.Sprintf("%s frei, Reserve %s, letztes Backup %s", formatSize(free), formatSize(reserve), formatSize(last))
+	if free < reserve+last {
+		return "", fmt.Errorf("%s, zu wenig für ein weiteres Backup", detail)
+	}
+	return detail, nil
+}
+
+func checkEncryption(config *Config) (string, error) {
+	compression, err := compressionByName(config.Compression)
+	if err != nil || compression.Name != "7z" {
+		return "keine (nur mit Compression 7z und BACKUP_7Z_PASSWORD)", nil
+	}
+	if os.Getenv("BACKUP_7Z_PASSWORD") == "" {
+		return "", fmt.Errorf("BACKUP_7Z_PASSWORD ist nicht gesetzt, Archive werden unverschlüsselt gespeichert")
+	}
+	return "7z mit Passwort aus BACKUP_7Z_PASSWORD", nil
+}
+
+// checkLocks meldet Sperren, die gerade ein anderer Lauf hält
+func checkLocks(backupDir string) (string, error) {
+	for _, name := range []string{catalogFileName, stateFileName} {
+		lock, err := os.Open(filepath.Join(backupDir, name+".lock"))
+		if err != nil {
+			continue
+		}
+		err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		}
+		lock.Close()
+		if err != nil {
+			return "", fmt.Errorf("%s ist gesperrt, läuft gerade ein anderes Backup?", name)
+		}
+	}
+	return "frei", nil
+}
+
+// checkClock erkennt eine falsch gehende Uhr an Backups aus der Zukunft
+func checkClock(backupDir string) (string, error) {
+	now := time.Now()
+	if now.Year() < 2020 {
+		return "", fmt.Errorf("systemzeit %s ist offensichtlich falsch", formatDateTime(now))
+	}
+	catalog, err := loadCatalog(backupDir)
+	if err != nil {
+		return formatDateTime(now), nil
+	}
+	for _, entry := range catalog.Backups {
+		if entry.Created.After(now.Add(5 * time.Minute)) {
+			return "", fmt.Errorf("%s ist vom %s, die Uhr geht nach (jetzt %s)", entry.File,
+				formatDateTime(entry.Created), formatDateTime(now))
+		}
+	}
+	return formatDateTime(now), nil
+}
+
+// notifyChecks prüft die Zugangsdaten der Benachrichtigungen, ohne eine Nachricht zu senden
+func notifyChecks(config NotifyConfig) []doctorCheck {
+	var checks []doctorCheck
+	if config.Slack.Token != "" {
+		checks = append(checks, doctorCheck{name: "Slack", run: func() (string, error) {
+			var resp chatResponse
+			if err := postJSONResult("https://slack.com/api/auth.test", nil, map[string]string{"Authorization": "Bearer " + config.Slack.Token}, &resp); err != nil {
+				return "", err
+			}
+			return "Token gültig", resp.err()
+		}})
+	}
+	if config.Telegram.Token != "" {
+		checks = append(checks, doctorCheck{name: "Telegram", run: func() (string, error) {
+			api := config.Telegram.APIURL
+			if api == "" {
+				api = "https://api.telegram.org"
+			}
+			var resp chatResponse
+			if err := sendJSON(http.MethodGet, strings.TrimSuffix(api, "/")+"/bot"+config.Telegram.Token+"/getMe", nil, nil, &resp); err != nil {
+				return "", fmt.Errorf("%s", strings.ReplaceAll(err.Error(), config.Telegram.Token, "***"))
+			}
+			return "Token gültig", resp.err()
+		}})
+	}
+	if config.Matrix.Homeserver != "" {
+		checks = append(checks, doctorCheck{name: "Matrix", run: func() (string, error) {
+			endpoint := strings.TrimSuffix(config.Matrix.Homeserver, "/") + "/_matrix/client/v3/account/whoami"
+			var resp struct {
+				UserID string `json:"user_id"`
+			}
+			err := sendJSON(http.MethodGet, endpoint, nil, map[string]string{"Authorization": "Bearer " + config.Matrix.AccessToken}, &resp)
+			return "angemeldet als " + resp.UserID, err
+		}})
+	}
+	if config.MQTT.Broker != "" {
+		checks = append(checks, doctorCheck{name: "MQTT", run: func() (string, error) {
+			client, err := dialMQTT(config.MQTT)
+			if err != nil {
+				return "", err
+			}
+			client.close()
+			return config.MQTT.Broker, nil
+		}})
+	}
+	return checks
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Größe der Stichprobe, mit der vor jedem Backup Archivgröße und Dauer geschätzt werden
+const estimateSampleSize = 8 << 20
+
+type backupEstimate struct {
+	SourceSize int64
+	Files      int
+	Size       int64 // geschätzte Archivgröße
+	Duration   time.Duration
+}
+
+// estimateBackup komprimiert eine Stichprobe mit den Einstellungen des Laufs und
+// rechnet Verhältnis und Geschwindigkeit auf das ganze Projekt hoch
+func estimateBackup(sourceDir string, opts archiveOptions) (*backupEstimate, error) {
+	sample, err := benchSample(sourceDir, opts, estimateSampleSize)
+	if err != nil {
+		return nil, err
+	}
+	estimate := &backupEstimate{SourceSize: sample.Size, Files: sample.Files}
+	if len(sample.Data) == 0 {
+		return estimate, nil
+	}
+
+	tmpDir, err := os.MkdirTemp("", "backup-estimate-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+	result, err := benchCompress(opts.Compression, opts.Level, sample.Data, tmpDir)
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := float64(result.size) / float64(len(sample.Data))
+	estimate.Size = int64(float64(sample.Size) * ratio)
+	if speed := result.speed(len(sample.Data)); speed > 0 {
+		estimate.Duration = time.Duration(float64(sample.Size) / float64(speed) * float64(time.Second))
+	}
+	return estimate, nil
+}
+
+// useHistory ersetzt die Schätzung durch das bisherige Kompressionsverhältnis des
+// Projekts, wenn dieses ungünstiger ist; bereits komprimierte Inhalte wie Bilder und
+// Videos können sogar größer werden als die Quelle
+func (e *backupEstimate) useHistory(backupDir, project, compression string) {
+	catalog, err := loadCatalog(backupDir)
+	if err != nil {
+		return
+	}
+	ratio, ok := catalog.compressionRatio(project, compression)
+	if !ok {
+		return
+	}
+	historical := int64(float64(e.SourceSize) * ratio)
+	logMessage(LogDebug, "Bisheriges Kompressionsverhältnis mit %s: %.0f%% (%s)", compression, ratio*100, formatSize(historical))
+	if historical > e.Size {
+		e.Size = historical
+	}
+}
+
+func (e *backupEstimate) String() string {
+	percent := 0.0
+	if e.SourceSize > 0 {
+		percent = float64(e.Size) / float64(e.SourceSize) * 100
+	}
+	return fmt.Sprintf("%s (%.0f%% von %s in %d Dateien), Dauer etwa %v",
+		formatSize(e.Size), percent, formatSize(e.SourceSize), e.Files, e.Duration.Round(time.Second))
+}
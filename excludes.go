@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Gruppen der Standard-Ausschlüsse für die Übersicht am Ende des Laufs; eigene Muster
+// aus Excludes und ExcludesFrom zählen als "eigene Muster"
+var excludeGroups = []struct {
+	name     string
+	patterns []string
+}{
+	{"Versionsverwaltung", []string{".git", ".gitignore", ".svn", ".hg"}},
+	{"Caches", []string{"__pycache__", ".pytest_cache", ".tox", ".npm", ".coverage", "zig-cache/", "*.pyc", "*.pyo"}},
+	{"Abhängigkeiten", []string{"node_modules", "venv", ".venv", ".Python", "Cargo.lock"}},
+	{"Build-Ausgaben", []string{"target/", "bin/", "pkg/", "build/", "dist/", "out/", "zig-out/",
+		"*.exe", "*.test", "*.o", "*.a", "*.so", "*.dylib", "*.dll", "*.class", "*.pyd"}},
+	{"Logs und temporäre Dateien", []string{"*.log", "logs/", "npm-debug.log", "yarn-debug.log", "yarn-error.log",
+		"pip-log.txt", "*.tmp", "*.temp", "*.swp", "*~", "**/*.rs.bk", "*.prof"}},
+}
+
+func excludeGroup(pattern string) string {
+	for _, group := range excludeGroups {
+		if containsString(group.patterns, pattern) {
+			return group.name
+		}
+	}
+	if containsString(defaultConfig.Excludes, pattern) {
+		return "Editoren, Betriebssystem, lokale Konfiguration"
+	}
+	return "eigene Muster"
+}
+
+type excludeStat struct {
+	Files int
+	Bytes int64
+}
+
+// excludeStats zählt je Gruppe die ausgeschlossenen Dateien; ausgeschlossene
+// Verzeichnisse werden dafür nur durchgezählt, nicht gelesen
+type excludeStats map[string]*excludeStat
+
+func (s excludeStats) add(pattern, filePath string, info os.FileInfo) {
+	group := excludeGroup(pattern)
+	stat := s[group]
+	if stat == nil {
+		stat = &excludeStat{}
+		s[group] = stat
+	}
+	if !info.IsDir() {
+		stat.Files++
+		stat.Bytes += info.Size()
+		return
+	}
+	filepath.WalkDir(filePath, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			stat.Files++
+			stat.Bytes += info.Size()
+		}
+		return nil
+	})
+}
+
+// print zeigt die Gruppen nach eingesparter Größe sortiert
+func (s excludeStats) print() {
+	if len(s) == 0 {
+		return
+	}
+	groups := make([]string, 0, len(s))
+	var files, width int
+	var bytes int64
+	for group, stat := range s {
+		groups = append(groups, group)
+		files += stat.Files
+		bytes += stat.Bytes
+		if n := utf8.RuneCountInString(group); n > width {
+			width = n
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if s[groups[i]].Bytes != s[groups[j]].Bytes {
+			return s[groups[i]].Bytes > s[groups[j]].Bytes
+		}
+		return groups[i] < groups[j]
+	})
+	fmt.Fprintf(os.Stderr, "  Ausgeschlossen: %d Dateien, %s\n", files, formatSize(bytes))
+	for _, group := range groups {
+		fmt.Fprintf(os.Stderr, "    %s:%s %6d Dateien %10s\n", group, strings.Repeat(" ", width-utf8.RuneCountInString(group)),
+			s[group].Files, formatSize(s[group].Bytes))
+	}
+}
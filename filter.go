@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// Ein Filterprogramm (FilterCommand) setzt Regeln einer Organisation durch, ohne dass
+// backup-tool angepasst werden muss. Es läuft während des Archivierens im
+// Projektverzeichnis und erhält für jeden Eintrag eine JSON-Zeile auf stdin:
+//
+//	{"Path":"src/main.go","Type":"file","Size":1234,"Mode":"-rw-r--r--","ModTime":"..."}
+//
+// und antwortet mit genau einer JSON-Zeile auf stdout:
+//
+//	{"Action":"skip","Reason":"..."}           Eintrag nicht sichern (Verzeichnis samt Inhalt)
+//	{"Name":"neu/pfad.go"}                     unter anderem Namen sichern
+//	{"Metadata":{"owner":"team-a"}}            Angaben für das Manifest
+//
+// Eine leere Antwort ({}) sichert den Eintrag unverändert. Das Programm kann in jeder
+// Sprache geschrieben sein; es wird einmal je Backup gestartet.
+
+type filterRequest struct {
+	Path    string
+	Type    string // "file", "dir", "symlink" oder "other"
+	Size    int64
+	Mode    string
+	ModTime string
+}
+
+type filterResponse struct {
+	Action   string // "" oder "keep", "skip"
+	Reason   string `json:",omitempty"`
+	Name     string `json:",omitempty"`
+	Metadata map[string]string
+}
+
+type entryFilter struct {
+	cmd     *exec.Cmd
+	in      io.WriteCloser
+	out     *bufio.Reader
+	renamed map[string]string // umbenannte Verzeichnisse, alter -> neuer Name im Archiv
+}
+
+func startFilter(command []string, sourceDir, project string) (*entryFilter, error) {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = sourceDir
+	cmd.Env = append(os.Environ(), "BACKUP_PROJECT="+project, "BACKUP_SOURCE="+sourceDir)
+	cmd.Stderr = os.Stderr
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("filterprogramm %s: %v", command[0], err)
+	}
+	return &entryFilter{cmd: cmd, in: in, out: bufio.NewReader(out), renamed: make(map[string]string)}, nil
+}
+
+// check fragt das Filterprogramm nach einem Eintrag; name ist der Name im Archiv
+func (f *entryFilter) check(name string, info os.FileInfo) (filterResponse, error) {
+	name = f.rename(name)
+	request := filterRequest{Path: name, Type: "other", Size: info.Size(), Mode: info.Mode().String(), ModTime: info.ModTime().UTC().Format("2006-01-02T15:04:05Z")}
+	switch {
+	case info.Mode().IsRegular():
+		request.Type = "file"
+	case info.IsDir():
+		request.Type, request.Size = "dir", 0
+	case info.Mode()&os.ModeSymlink != 0:
+		request.Type = "symlink"
+	}
+	var response filterResponse
+	data, err := json.Marshal(request)
+	if err != nil {
+		return response, err
+	}
+	if _, err := f.in.Write(append(data, '\n')); err != nil {
+		return response, fmt.Errorf("filterprogramm beendet: %v", err)
+	}
+	line, err := f.out.ReadBytes('\n')
+	if err != nil {
+		return response, fmt.Errorf("filterprogramm antwortet nicht auf %q: %v", name, err)
+	}
+	if err := json.Unmarshal(line, &response); err != nil {
+		return response, fmt.Errorf("ungültige Antwort des Filterprogramms auf %q: %v", name, err)
+	}
+	switch response.Action {
+	case "", "keep":
+	case "skip":
+		return response, nil
+	default:
+		return response, fmt.Errorf("unbekannte Aktion %q des Filterprogramms für %q", response.Action, name)
+	}
+
+	if response.Name == "" || response.Name == name {
+		response.Name = name
+		return response, nil
+	}
+	clean := path.Clean(response.Name)
+	if path.IsAbs(clean) || clean == "." || clean == ".." || strings.HasPrefix(clean, "../") || isToolEntry(clean) {
+		return response, fmt.Errorf("filterprogramm benennt %q in unzulässigen Namen %q um", name, response.Name)
+	}
+	if info.IsDir() {
+		f.renamed[name] = clean
+	}
+	response.Name = clean
+	return response, nil
+}
+
+// rename überträgt die Umbenennung eines Verzeichnisses auf seinen Inhalt
+func (f *entryFilter) rename(name string) string {
+	for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+		if renamed, ok := f.renamed[dir]; ok {
+			return renamed + name[len(dir):]
+		}
+	}
+	return name
+}
+
+func (f *entryFilter) close() error {
+	f.in.Close()
+	if err := f.cmd.Wait(); err != nil {
+		return fmt.Errorf("filterprogramm: %v", err)
+	}
+	return nil
+}
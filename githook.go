@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Erkennungsmerkmal für Hooks, die von diesem Tool angelegt wurden
+const gitHookMarker = "# installiert von backup-tool"
+
+func runInstallGitHook(args []string) error {
+	flags := flag.NewFlagSet("install-git-hook", flag.ExitOnError)
+	hook := flags.String("hook", "post-commit", "Git-Hook, der das Backup auslöst (post-commit oder pre-push)")
+	force := flags.Bool("force", false, "vorhandenen fremden Hook überschreiben")
+	flags.Parse(args)
+
+	if *hook != "post-commit" && *hook != "pre-push" {
+		return fmt.Errorf("nicht unterstützter Hook: %s (erlaubt: post-commit, pre-push)", *hook)
+	}
+
+	sourceDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("fehler beim Ermitteln des Programmpfads: %v", err)
+	}
+
+	// git rev-parse berücksichtigt Worktrees und core.hooksPath
+	out, err := exec.Command("git", "rev-parse", "--git-path", "hooks").Output()
+	if err != nil {
+		return fmt.Errorf("kein Git-Repository: %v", err)
+	}
+	hooksDir := strings.TrimSpace(string(out))
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(sourceDir, hooksDir)
+	}
+	hookPath := filepath.Join(hooksDir, *hook)
+
+	if existing, err := os.ReadFile(hookPath); err == nil {
+		if !strings.Contains(string(existing), gitHookMarker) && !*force {
+			return fmt.Errorf("%s existiert bereits, mit --force überschreiben", hookPath)
+		}
+	}
+
+	// Das Backup läuft im Hintergrund, damit Commit bzw. Push nicht warten müssen
+	script := fmt.Sprintf(`#!/bin/sh
+%s
+cd %s || exit 0
+%s --tag "$(git rev-parse --short HEAD)" >>"$(git rev-parse --git-dir)/backup-hook.log" 2>&1 &
+exit 0
+`, gitHookMarker, shellQuote(sourceDir), shellQuote(executable))
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(hookPath, []byte(script), 0755); err != nil {
+		return fmt.Errorf("fehler beim Schreiben von %s: %v", hookPath, err)
+	}
+	fmt.Printf("✓ %s-Hook installiert: %s\n", *hook, hookPath)
+	return nil
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
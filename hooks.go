@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultHookTimeout = time.Hour
+	defaultHookRetries = 3
+)
+
+// Hook ist ein Befehl, der vor (PreHooks) oder nach (PostHooks) dem Backup läuft,
+// z.B. ein Datenbank-Dump ins Projektverzeichnis
+type Hook struct {
+	// wird mit sh -c ausgeführt; Template-Variablen wie {{.ArchivePath}} werden gequotet
+	// eingesetzt und stehen ohne eigene Anführungszeichen. Dieselben Angaben gibt es als
+	// Umgebungsvariablen, z.B. "$BACKUP_ARCHIVE".
+	Command string
+	Timeout string            // z.B. "10m"; Standard 1h, danach wird der Befehl beendet
+	Dir     string            // Arbeitsverzeichnis, relativ zum Projekt; Standard: Projektverzeichnis
+	Env     map[string]string // zusätzliche Umgebungsvariablen
+	// "abort" (Standard): Backup abbrechen, "warn": nur warnen, "retry": bis zu
+	// Retries-mal wiederholen und dann abbrechen
+	OnFailure string
+	Retries   int
+}
+
+// runHooks führt die Hooks nacheinander aus; env enthält die BACKUP_*-Variablen des Laufs,
+// data die Angaben für Template-Variablen wie {{.ArchivePath}} im Befehl
+func runHooks(stage string, hooks []Hook, sourceDir string, env map[string]string, data runData) error {
+	for i, hook := range hooks {
+		attempts := 1
+		if hook.OnFailure == "retry" {
+			attempts += hook.Retries
+			if hook.Retries == 0 {
+				attempts += defaultHookRetries
+			}
+		}
+		command, err := renderShellTemplate(hook.Command, data)
+		if err != nil {
+			return fmt.Errorf("%s-Hook %q: %v", stage, hook.Command, err)
+		}
+		hook.Command = command
+		for attempt := 1; attempt <= attempts; attempt++ {
+			logMessage(LogInfo, "%s-Hook %d: %s", stage, i+1, hook.Command)
+			if err = runHook(hook, sourceDir, env); err == nil {
+				break
+			}
+			if attempt < attempts {
+				logMessage(LogWarning, "%s-Hook %d fehlgeschlagen (%v), Versuch %d von %d", stage, i+1, err, attempt+1, attempts)
+				time.Sleep(time.Duration(attempt) * 5 * time.Second)
+			}
+		}
+		if err == nil {
+			continue
+		}
+		if hook.OnFailure == "warn" {
+			logMessage(LogWarning, "%s-Hook %d fehlgeschlagen: %v", stage, i+1, err)
+			continue
+		}
+		return fmt.Errorf("%s-Hook %q: %v", stage, hook.Command, err)
+	}
+	return nil
+}
+
+func runHook(hook Hook, sourceDir string, env map[string]string) error {
+	timeout := defaultHookTimeout
+	if hook.Timeout != "" {
+		var err error
+		if timeout, err = time.ParseDuration(hook.Timeout); err != nil {
+			return fmt.Errorf("ungültiges Timeout %q: %v", hook.Timeout, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", hook.Command)
+	cmd.Dir = sourceDir
+	if hook.Dir != "" {
+		cmd.Dir = expandPath(hook.Dir, sourceDir)
+	}
+	cmd.Env = os.Environ()
+	for key, value := range env {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+	for key, value := range hook.Env {
+		cmd.Env = append(cmd.Env, key+"="+os.ExpandEnv(value))
+	}
+	// stdout ist dem Pfad des Archivs vorbehalten
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	// Eigene Prozessgruppe, damit bei Zeitüberschreitung auch Kindprozesse der Shell enden
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = 5 * time.Second
+
+	err := cmd.Run()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("zeitüberschreitung nach %s", timeout)
+	}
+	return err
+}
+
+// validateHooks prüft die Einstellungen der Hooks für validateConfig
+func validateHooks(name string, hooks []Hook) []string {
+	var problems []string
+	for i, hook := range hooks {
+		prefix := fmt.Sprintf("%s[%d]", name, i)
+		if hook.Command == "" {
+			problems = append(problems, prefix+": Command fehlt")
+		} else if _, err := parseTemplate(hook.Command); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: ungültiges Template: %v", prefix, err))
+		}
+		if hook.Timeout != "" {
+			if _, err := time.ParseDuration(hook.Timeout); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: ungültiges Timeout %q (z.B. 30s, 10m)", prefix, hook.Timeout))
+			}
+		}
+		switch hook.OnFailure {
+		case "", "abort", "warn", "retry":
+		default:
+			problems = append(problems, fmt.Sprintf("%s: ungültiger Wert für OnFailure %q (möglich: abort, warn, retry)", prefix, hook.OnFailure))
+		}
+		if hook.Retries < 0 {
+			problems = append(problems, fmt.Sprintf("%s: Retries darf nicht negativ sein (%d)", prefix, hook.Retries))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Zeitstempel im Dateinamen von Backups, z.B. projekt_backup_20240501_130000.tar.gz oder
+// mit TimestampStyle iso8601 projekt_backup_2024-05-01T130000Z.tar.gz
+var backupNameTime = regexp.MustCompile(`_backup_(\d{8}_\d{6}|\d{4}-\d{2}-\d{2}T\d{6}Z)`)
+
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	project := flags.String("project", "", "Projekt, dem das Archiv zugeordnet wird (Standard: aktuelles Projekt)")
+	tag := flags.String("tag", "import", "Markierung für das importierte Backup")
+	move := flags.Bool("move", false, "Archiv verschieben statt kopieren")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("verwendung: backup-tool import [optionen] <archiv>")
+	}
+	source, err := filepath.Abs(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if *project != "" {
+		projectName = *project
+	}
+	if !isValidBackupName(projectName) {
+		return fmt.Errorf("ungültiger Projektname: %s", projectName)
+	}
+
+	meta, err := checkArchiveFormat(source)
+	if err != nil {
+		return fmt.Errorf("%s ist kein lesbares Archiv: %v", source, err)
+	}
+	created := importTime(source, meta)
+	extension, err := detectArchiveExtension(source)
+	if err != nil {
+		return err
+	}
+
+	// Archive erhalten den üblichen Namen, damit Aufräumen und Auflisten sie erfassen
+	target := filepath.Join(config.BackupDir, fmt.Sprintf("%s_backup_%s%s", projectName, fileTimestamp(config, created), extension))
+	if source != target {
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("%s existiert bereits", target)
+		}
+		if err := os.MkdirAll(config.BackupDir, 0755); err != nil {
+			return err
+		}
+		if *move {
+			err = moveFile(source, target)
+		} else {
+			err = copyFile(source, target)
+		}
+		if err != nil {
+			return fmt.Errorf("fehler beim Übernehmen des Archivs: %v", err)
+		}
+	}
+
+	logMessage(LogInfo, "Erzeuge Manifest für %s...", filepath.Base(target))
+	manifest, err := buildManifest(target, projectName)
+	if err != nil {
+		return fmt.Errorf("fehler beim Lesen des Archivs: %v", err)
+	}
+	manifest.Created = created.UTC()
+	if err := saveManifest(target, manifest); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	sum, err := hashFile(target)
+	if err != nil {
+		return err
+	}
+	err = updateCatalog(config.BackupDir, func(c *Catalog) {
+		c.add(CatalogEntry{
+			Project:   projectName,
+			File:      filepath.Base(target),
+			Created:   created.UTC(),
+			Size:      info.Size(),
+			SourceDir: meta.SourceDir,
+			Tag:       *tag,
+			SHA256:    sum,
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ %s importiert als %s (%d Dateien, Stand %s)\n",
+		filepath.Base(source), filepath.Base(target), len(manifest.Files), formatDateTime(created))
+	return nil
+}
+
+// importTime ermittelt den Zeitpunkt eines Archivs: aus den Metadaten, dem Dateinamen
+// oder zuletzt aus der Änderungszeit der Datei
+func importTime(archivePath string, meta *ArchiveMeta) time.Time {
+	if !meta.Created.IsZero() {
+		return meta.Created
+	}
+	if match := backupNameTime.FindStringSubmatch(filepath.Base(archivePath)); match != nil {
+		if t, err := time.ParseInLocation(legacyFileTimestamp, match[1], time.Local); err == nil {
+			return t
+		}
+		if t, err := time.Parse(isoFileTimestamp, match[1]); err == nil {
+			return t
+		}
+	}
+	if info, err := os.Stat(archivePath); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+func copyFile(source, target string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(target)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(target)
+		return err
+	}
+	if info, err := in.Stat(); err == nil {
+		os.Chtimes(target, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// moveFile verschiebt eine Datei, notfalls über Dateisystemgrenzen hinweg
+func moveFile(source, target string) error {
+	if err := os.Rename(source, target); err == nil {
+		return nil
+	}
+	if err := copyFile(source, target); err != nil {
+		return err
+	}
+	return os.Remove(source)
+}
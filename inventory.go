@@ -0,0 +1,54 @@
+package main
+
+import (
+	"archive/tar"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// discardWriter nimmt Einträge entgegen, ohne sie zu speichern; so berechnet der
+// normale Archivierungsdurchlauf nur das Manifest
+type discardWriter struct{}
+
+func (discardWriter) WriteHeader(*tar.Header) error { return nil }
+func (discardWriter) Write(p []byte) (int, error)   { return len(p), nil }
+func (discardWriter) Close() error                  { return nil }
+
+// runInventory speichert nur das Manifest des aktuellen Stands (Pfade, Größen,
+// Prüfsummen, Änderungszeiten) ohne die Inhalte zu archivieren
+func runInventory(args []string) error {
+	flags := flag.NewFlagSet("inventory", flag.ExitOnError)
+	flags.Parse(args)
+
+	config, sourceDir, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	opts := sourceOptions(config, projectName)
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+
+	start := time.Now()
+	report, err := writeArchive(discardWriter{}, sourceDir, opts)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, file := range report.Files {
+		total += file.Size
+	}
+	inventory := filepath.Join(config.BackupDir, fmt.Sprintf("%s_inventory_%s", projectName, fileTimestamp(config, start)))
+	manifest := newManifest(inventory, projectName, report.Files)
+	manifest.Archive = ""
+	manifest.Skipped = report.Skipped
+	if err := saveManifest(inventory, manifest); err != nil {
+		return fmt.Errorf("fehler beim Speichern der Inventur: %v", err)
+	}
+	fmt.Printf("✓ Inventur gespeichert: %s (%d Dateien, %s)\n", manifestPath(inventory), len(report.Files), formatSize(total))
+	return nil
+}
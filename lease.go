@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Auf gemeinsam genutzten Remote-Zielen (NAS-Freigabe, SSHFS) wirkt flock nur auf dem
+// eigenen Rechner. Änderungen am Katalog und Löschungen laufen dort deshalb unter einer
+// Lease-Datei catalog.json.lease, die der Inhaber regelmäßig verlängert. Läuft sie ab
+// (Absturz, Netzwerk weg), darf ein anderer Rechner sie übernehmen; die Uhren der Rechner
+// sollten dafür auf wenige Sekunden genau gehen.
+const leaseWait = 10 * time.Minute // so lange auf einen anderen Inhaber warten
+
+// Variablen statt Konstanten, damit Tests nicht Minuten warten müssen
+var (
+	leaseDuration      = 2 * time.Minute
+	leaseRenewInterval = leaseDuration / 3
+)
+
+var errLeaseTaken = errors.New("lease wurde übernommen")
+
+type catalogLease struct {
+	Host    string
+	PID     int
+	RunID   string
+	Expires time.Time
+}
+
+func (l catalogLease) same(other catalogLease) bool {
+	return l.Host == other.Host && l.PID == other.PID && l.RunID == other.RunID
+}
+
+func (l catalogLease) owner() string {
+	return fmt.Sprintf("%s (Prozess %d)", l.Host, l.PID)
+}
+
+// stale meldet abgelaufene Leases und solche eines beendeten Prozesses auf diesem Rechner
+func (l catalogLease) stale() bool {
+	if time.Now().After(l.Expires) {
+		return true
+	}
+	host, _ := os.Hostname()
+	return l.Host == host && l.PID > 0 && syscall.Kill(l.PID, 0) == syscall.ESRCH
+}
+
+// heldLease ist eine Lease, die dieser Prozess gerade hält. Geht sie verloren (ein anderer
+// Rechner hat sie nach Ablauf übernommen), ist lost gesetzt und jede weitere Änderung am
+// Katalog oder Löschung in dem Verzeichnis schlägt fehl.
+type heldLease struct {
+	path string
+	mu   sync.Mutex
+	own  catalogLease
+	lost error
+}
+
+var (
+	heldLeases   = make(map[string]*heldLease) // Katalogverzeichnis -> Lease
+	heldLeasesMu sync.Mutex
+)
+
+// withLease führt fn aus, während dieser Lauf die Lease auf den Katalog in dir hält
+func withLease(dir string, fn func() error) error {
+	release, err := acquireLease(dir)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return fn()
+}
+
+// checkLease prüft vor dem Speichern des Katalogs in dir und vor jedem Löschen dort, ob
+// dieser Lauf die Lease noch hält. Ohne Lease auf dir (lokales Verzeichnis) gibt es nichts
+// zu prüfen.
+func checkLease(dir string) error {
+	heldLeasesMu.Lock()
+	lease := heldLeases[filepath.Clean(dir)]
+	heldLeasesMu.Unlock()
+	if lease == nil {
+		return nil
+	}
+	return lease.check()
+}
+
+func (h *heldLease) check() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lost != nil {
+		return h.lost
+	}
+	holder, err := readLease(h.path)
+	switch {
+	case err != nil:
+		h.lost = fmt.Errorf("katalog-Lease verloren: %v", err)
+	case !holder.same(h.own):
+		h.lost = fmt.Errorf("katalog-Lease verloren, %s hat sie übernommen", holder.owner())
+	case time.Now().After(h.own.Expires):
+		// Nicht rechtzeitig verlängert, ein anderer Rechner darf sie jetzt übernehmen
+		h.lost = fmt.Errorf("katalog-Lease verloren, sie ist seit %v abgelaufen", time.Since(h.own.Expires).Round(time.Second))
+	}
+	return h.lost
+}
+
+// renew verlängert die Lease; hat ein anderer sie übernommen, gilt sie als verloren
+func (h *heldLease) renew() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.lost != nil {
+		return
+	}
+	next := h.own
+	next.Expires = time.Now().Add(leaseDuration)
+	err := renewLease(h.path, next)
+	switch {
+	case errors.Is(err, errLeaseTaken):
+		h.lost = fmt.Errorf("katalog-Lease verloren: %v", err)
+		logMessage(LogError, "%v, Änderungen am Katalog werden abgebrochen", h.lost)
+	case err != nil:
+		// Vorübergehende Störung; check() erkennt, wenn die Lease darüber abläuft
+		logMessage(LogWarning, "Katalog-Lease nicht verlängert: %v", err)
+	default:
+		h.own = next
+	}
+}
+
+// acquireLease wartet auf die Lease für den Katalog in dir; release gibt sie wieder frei
+func acquireLease(dir string) (release func(), err error) {
+	path := filepath.Join(dir, catalogFileName+".lease")
+	host, _ := os.Hostname()
+	own := catalogLease{Host: host, PID: os.Getpid(), RunID: runID}
+	// prune, compact und scrub haben keine Lauf-ID, die Lease braucht trotzdem eine eindeutige
+	if own.RunID == "" {
+		own.RunID = newRunID()
+	}
+
+	deadline := time.Now().Add(leaseWait)
+	waiting := false
+	for {
+		own.Expires = time.Now().Add(leaseDuration)
+		err := createLease(path, own)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("lease auf %s: %v", dir, err)
+		}
+		holder, err := readLease(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err == nil && holder.stale() {
+			logMessage(LogWarning, "Übernehme abgelaufene Katalog-Lease von %s", holder.owner())
+			breakLease(path, holder)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("katalog auf %s ist seit %v von %s gesperrt (%s)", dir, leaseWait, holder.owner(), path)
+		}
+		if !waiting {
+			logMessage(LogInfo, "Katalog auf %s wird gerade von %s bearbeitet, warte...", dir, holder.owner())
+			waiting = true
+		}
+		// Zufälliger Abstand, damit wartende Rechner nicht im Gleichschritt anfragen
+		time.Sleep(time.Second + time.Duration(rand.Intn(1000))*time.Millisecond)
+	}
+
+	lease := &heldLease{path: path, own: own}
+	key := filepath.Clean(dir)
+	heldLeasesMu.Lock()
+	heldLeases[key] = lease
+	heldLeasesMu.Unlock()
+
+	done := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(leaseRenewInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				lease.renew()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-renewed
+		heldLeasesMu.Lock()
+		delete(heldLeases, key)
+		heldLeasesMu.Unlock()
+		if holder, err := readLease(path); err == nil && holder.same(lease.own) {
+			os.Remove(path)
+		}
+	}, nil
+}
+
+func createLease(path string, lease catalogLease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func readLease(path string) (catalogLease, error) {
+	var lease catalogLease
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return lease, err
+	}
+	if err := json.Unmarshal(data, &lease); err != nil {
+		// Halb geschriebene Lease: gilt bis leaseDuration nach ihrer Änderungszeit
+		if info, statErr := os.Stat(path); statErr == nil {
+			lease.Expires = info.ModTime().Add(leaseDuration)
+		}
+		return lease, nil
+	}
+	return lease, nil
+}
+
+// renewLease verlängert die eigene Lease; hat ein anderer sie übernommen, ist das ein Fehler
+func renewLease(path string, lease catalogLease) error {
+	holder, err := readLease(path)
+	if err != nil {
+		return err
+	}
+	if !holder.same(lease) {
+		return fmt.Errorf("%w von %s", errLeaseTaken, holder.owner())
+	}
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+	tmp := path + "." + lease.RunID
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// breakLease entfernt eine abgelaufene Lease. Sie wird erst unter eigenem Namen beiseite
+// gelegt: Hat ein anderer Rechner sie inzwischen ersetzt, kommt die neue zurück.
+func breakLease(path string, stale catalogLease) {
+	aside := fmt.Sprintf("%s.stale-%s-%d", path, runID, os.Getpid())
+	if err := os.Rename(path, aside); err != nil {
+		return
+	}
+	if moved, err := readLease(aside); err == nil && !moved.same(stale) {
+		os.Link(aside, path)
+	}
+	os.Remove(aside)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// takeOverLease schreibt eine fremde Lease, als hätte ein anderer Rechner übernommen
+func takeOverLease(t *testing.T, dir string) {
+	t.Helper()
+	other := catalogLease{Host: "anderer-rechner", PID: 4711, RunID: "fremd", Expires: time.Now().Add(time.Hour)}
+	path := filepath.Join(dir, catalogFileName+".lease")
+	os.Remove(path)
+	if err := createLease(path, other); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLostLeaseStopsCatalogChanges(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "p_backup_2024-01-01_12-00-00.tar.gz")
+	if err := os.WriteFile(archive, []byte("archiv"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err := withLease(dir, func() error {
+		takeOverLease(t, dir)
+		if err := updateCatalog(dir, func(c *Catalog) {}); err == nil {
+			t.Error("Katalog ohne Lease gespeichert")
+		}
+		return deleteArchives(dir, []string{filepath.Base(archive)}, "test")
+	})
+	if err == nil {
+		t.Error("Archive ohne Lease gelöscht")
+	}
+	if _, err := os.Stat(archive); err != nil {
+		t.Errorf("Archiv fehlt: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, catalogFileName)); !os.IsNotExist(err) {
+		t.Errorf("Katalog wurde geschrieben (%v)", err)
+	}
+	// Die Lease des anderen Rechners bleibt beim Freigeben liegen
+	holder, err := readLease(filepath.Join(dir, catalogFileName+".lease"))
+	if err != nil || holder.RunID != "fremd" {
+		t.Errorf("fremde Lease entfernt oder verändert: %+v, %v", holder, err)
+	}
+}
+
+func TestCleanupOldBackupsChecksLease(t *testing.T) {
+	dir := t.TempDir()
+	var archives []string
+	for i, stamp := range []string{"2024-01-01_12-00-00", "2024-01-02_12-00-00"} {
+		archive := filepath.Join(dir, "p_backup_"+stamp+".tar.gz")
+		if err := os.WriteFile(archive, []byte("archiv"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		modTime := time.Date(2024, 1, i+1, 12, 0, 0, 0, time.UTC)
+		if err := os.Chtimes(archive, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, archive)
+	}
+
+	err := withLease(dir, func() error {
+		takeOverLease(t, dir)
+		return cleanupOldBackups(dir, "p", 1)
+	})
+	if err == nil {
+		t.Error("alte Backups ohne Lease gelöscht")
+	}
+	if _, err := os.Stat(archives[0]); err != nil {
+		t.Errorf("Archiv fehlt: %v", err)
+	}
+
+	// Ohne fremde Lease verschwindet das älteste Archiv, auch wenn es nicht im Katalog steht
+	os.Remove(filepath.Join(dir, catalogFileName+".lease"))
+	if err := withLease(dir, func() error { return cleanupOldBackups(dir, "p", 1) }); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(archives[0]); !os.IsNotExist(err) {
+		t.Errorf("ältestes Archiv nicht gelöscht (%v)", err)
+	}
+	if _, err := os.Stat(archives[1]); err != nil {
+		t.Errorf("neuestes Archiv fehlt: %v", err)
+	}
+}
+
+func TestLeaseRenewalDetectsTakeover(t *testing.T) {
+	interval := leaseRenewInterval
+	leaseRenewInterval = 10 * time.Millisecond
+	t.Cleanup(func() { leaseRenewInterval = interval })
+
+	dir := t.TempDir()
+	release, err := acquireLease(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+	if err := checkLease(dir); err != nil {
+		t.Fatalf("frische Lease gilt als verloren: %v", err)
+	}
+
+	takeOverLease(t, dir)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		heldLeasesMu.Lock()
+		lease := heldLeases[filepath.Clean(dir)]
+		heldLeasesMu.Unlock()
+		lease.mu.Lock()
+		lost := lease.lost
+		lease.mu.Unlock()
+		if lost != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Verlängerung hat die Übernahme nicht bemerkt")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := updateCatalog(dir, func(c *Catalog) {}); err == nil {
+		t.Error("Katalog nach verlorener Lease gespeichert")
+	}
+}
+
+func TestExpiredLeaseCountsAsLost(t *testing.T) {
+	duration, interval := leaseDuration, leaseRenewInterval
+	// Verlängerung nie rechtzeitig: die eigene Lease läuft ab
+	leaseDuration, leaseRenewInterval = 20*time.Millisecond, time.Hour
+	t.Cleanup(func() { leaseDuration, leaseRenewInterval = duration, interval })
+
+	dir := t.TempDir()
+	err := withLease(dir, func() error {
+		time.Sleep(50 * time.Millisecond)
+		return updateCatalog(dir, func(c *Catalog) {})
+	})
+	if err == nil {
+		t.Fatal("Katalog mit abgelaufener Lease gespeichert")
+	}
+	if errors.Is(err, errLeaseTaken) {
+		t.Errorf("abgelaufene Lease als übernommen gemeldet: %v", err)
+	}
+}
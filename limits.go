@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// Auf kleinen Servern kann ein Kompressor mit hoher Stufe und einem Thread je CPU den
+// Arbeitsspeicher erschöpfen. MaxMemory (oder GOMEMLIMIT) teilt den Rahmen je zur
+// Hälfte auf die Go-Laufzeit und den externen Kompressor auf, dessen Threads und Stufe
+// bei Bedarf sinken; MaxThreads begrenzt die genutzten CPUs.
+
+// Grenzen für den externen Kompressor; 0 = unbegrenzt
+var (
+	compressorThreads int
+	compressorMemory  int64
+)
+
+// applyResourceLimits übernimmt MaxMemory und MaxThreads für diesen Lauf
+func applyResourceLimits(config *Config) error {
+	limit, err := parseSize(config.MaxMemory)
+	if err != nil {
+		return fmt.Errorf("MaxMemory: %v", err)
+	}
+	if os.Getenv("GOMEMLIMIT") != "" {
+		// Die Laufzeit hat GOMEMLIMIT bereits übernommen; es hat Vorrang vor MaxMemory
+		if current := debug.SetMemoryLimit(-1); current != math.MaxInt64 {
+			limit = current * 2
+		}
+	} else if limit > 0 {
+		debug.SetMemoryLimit(limit / 2)
+	}
+	if limit > 0 {
+		compressorMemory = limit / 2
+		logMessage(LogInfo, "Speicherrahmen: %s, davon %s für den Kompressor", formatSize(limit), formatSize(compressorMemory))
+	}
+
+	if config.MaxThreads > 0 {
+		runtime.GOMAXPROCS(config.MaxThreads)
+		compressorThreads = config.MaxThreads
+		if config.Workers == 0 || config.Workers > config.MaxThreads {
+			config.Workers = config.MaxThreads
+		}
+	}
+	return nil
+}
+
+// compressorThreadCount liefert die Zahl der Kompressor-Threads, wenn jeder etwa
+// perThread Bytes braucht; 0 überlässt die Wahl dem Programm
+func compressorThreadCount(perThread int64) int {
+	threads := compressorThreads
+	if compressorMemory > 0 && perThread > 0 {
+		if threads == 0 {
+			threads = runtime.NumCPU()
+		}
+		threads = min(threads, max(1, int(compressorMemory/perThread)))
+	}
+	return threads
+}
+
+// limitLevel senkt die Stufe, bis ein einzelner Thread des Kompressors in den Rahmen passt
+func (f *compressionFormat) limitLevel(level int) int {
+	if compressorMemory <= 0 || f.memory == nil {
+		return level
+	}
+	for level > 1 && f.memory(level) > compressorMemory {
+		level--
+	}
+	return level
+}
+
+// Grobe Richtwerte für den Speicherbedarf je Kompressor-Thread
+func zstdMemory(level int) int64 {
+	switch {
+	case level <= 3:
+		return 20 << 20
+	case level <= 9:
+		return 50 << 20
+	case level <= 15:
+		return 100 << 20
+	default:
+		return 230 << 20
+	}
+}
+
+// lzmaMemory gilt für xz und 7z (LZMA2), Werte nach der xz-Dokumentation
+func lzmaMemory(level int) int64 {
+	mib := []int64{3, 9, 17, 32, 48, 94, 94, 186, 370, 674}
+	return mib[min(max(level, 0), 9)] << 20
+}
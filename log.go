@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+type LogLevel int
+
+const (
+	LogError LogLevel = iota
+	LogWarning
+	LogInfo
+	LogDebug
+)
+
+var slogLevels = map[LogLevel]slog.Level{
+	LogError:   slog.LevelError,
+	LogWarning: slog.LevelWarn,
+	LogInfo:    slog.LevelInfo,
+	LogDebug:   slog.LevelDebug,
+}
+
+var (
+	logLevel = new(slog.LevelVar)
+	logger   = slog.New(&consoleHandler{level: logLevel})
+)
+
+// runWarnings sammelt die Warnungen des laufenden Backups für den Katalog
+var runWarnings []string
+
+func init() {
+	if defaultConfig.Debug {
+		logLevel.Set(slog.LevelDebug)
+	}
+}
+
+// setupLogging richtet Format und Stufe der Meldungen nach der Konfiguration ein
+func setupLogging(config *Config) error {
+	level := config.LogLevel
+	if level == "" {
+		level = "info"
+		if config.Debug {
+			level = "debug"
+		}
+	}
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("ungültige LogLevel %q (möglich: debug, info, warn, error)", level)
+	}
+	logLevel.Set(l)
+
+	options := &slog.HandlerOptions{Level: logLevel}
+	switch config.LogFormat {
+	case "":
+		logger = slog.New(&consoleHandler{level: logLevel})
+	case "text":
+		logger = slog.New(slog.NewTextHandler(os.Stderr, options))
+	case "json":
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, options))
+	default:
+		return fmt.Errorf("ungültiges LogFormat %q (möglich: text, json)", config.LogFormat)
+	}
+	return nil
+}
+
+func logMessage(level LogLevel, format string, a ...interface{}) {
+	message := fmt.Sprintf(format, a...)
+	if level == LogWarning {
+		runWarnings = append(runWarnings, message)
+		events.warning(message)
+	}
+	logger.Log(context.Background(), slogLevels[level], message)
+}
+
+// consoleHandler gibt Meldungen wie bisher als "WARNUNG: ..." aus. Felder des Laufs
+// wie project und backup_file stehen ohnehin im Text und werden nur bei den
+// strukturierten Formaten ausgegeben; Felder der einzelnen Meldung werden angehängt.
+type consoleHandler struct {
+	level slog.Leveler
+}
+
+func (h *consoleHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *consoleHandler) Handle(_ context.Context, record slog.Record) error {
+	var prefix string
+	switch {
+	case record.Level >= slog.LevelError:
+		prefix = colorize(colorRed, "FEHLER: ")
+	case record.Level >= slog.LevelWarn:
+		prefix = colorize(colorYellow, "WARNUNG: ")
+	case record.Level >= slog.LevelInfo:
+		prefix = "INFO: "
+	default:
+		prefix = "DEBUG: "
+	}
+	var b strings.Builder
+	b.WriteString(prefix)
+	b.WriteString(record.Message)
+	record.Attrs(func(attr slog.Attr) bool {
+		fmt.Fprintf(&b, " %s=%v", attr.Key, attr.Value)
+		return true
+	})
+	b.WriteByte('\n')
+	_, err := os.Stderr.WriteString(b.String())
+	return err
+}
+
+func (h *consoleHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *consoleHandler) WithGroup(string) slog.Handler      { return h }
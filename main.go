@@ -1,13 +1,16 @@
 package main
 
 import (
+	"archive/tar"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -15,16 +18,140 @@ import (
 
 type Config struct {
 	MaxBackups int
-	Debug      bool
-	Excludes   []string
-	BackupDir  string
-	TimeFormat string
+	// Aufbewahrung nach Zeiträumen statt MaxBackups, z.B. "last=3,daily=7,weekly=4,monthly=12";
+	// mit "prune --simulate --policy" vorher am Katalog ausprobieren
+	Retention string
+	Debug     bool
+	Excludes  []string // zusätzlich zu den Standard-Excludes
+	// Dateien oder HTTPS-URLs mit Exclude-Mustern, eines pro Zeile, z.B. gemeinsam
+	// gepflegte Listen eines Teams; leere Zeilen und Zeilen mit # am Anfang werden
+	// übersprungen. URLs mit "#sha256=..." am Ende werden auf die Prüfsumme festgelegt.
+	ExcludesFrom []string
+	BackupDir    string
+	TimeFormat   string
+	Duplicates   string // "keep", "skip" oder "marker" für unveränderte Projektstände
+	Workers      int    // parallele Leser beim Archivieren, 0 = Anzahl der CPUs
+	// Umgang mit Geräten, Sockets und FIFOs: "skip", "metadata" oder "fail"
+	SpecialFiles string
+	Remote       string // eingebundenes Verzeichnis (NAS, SSHFS), auf das Backups kopiert werden
+	// Lokaler Zwischenspeicher, falls BackupDir nicht eingehängt oder Remote nicht erreichbar
+	// ist; der nächste Lauf verschiebt bzw. überträgt die Archive nachträglich
+	SpoolDir         string
+	SpoolMaxSize     string // Obergrenze für SpoolDir, z.B. "5GB"; ältere Archive werden dann gelöscht
+	RemoteAppendOnly bool   // auf dem Remote-Ziel nur neue Dateien anlegen; aufräumen mit "prune --remote"
+	// Prüfung der übertragenen Kopie: "sample" (Standard) vergleicht Stichproben, "full"
+	// die Prüfsumme des ganzen Archivs, "off" verzichtet darauf
+	RemoteVerify string
+	// Eigene Aufbewahrung für das Remote-Ziel in derselben Schreibweise, z.B. lokal
+	// MaxBackups 3 und hier "last=30"; leer = wie lokal, ohne automatisches Aufräumen
+	RemoteRetention string
+	// Unter macOS wird das Backup-Verzeichnis von Time Machine und Spotlight ausgenommen;
+	// true lässt es wie jedes andere Verzeichnis sichern und indizieren
+	IncludeInTimeMachine bool
+	// "tar" (Standard), "zip" für Empfänger unter Windows oder "snapshot": Verzeichnis aus
+	// Hardlinks in einen gemeinsamen Speicher, in dem gleiche Dateien aller Projekte nur
+	// einmal liegen (unkomprimiert, nur auf Dateisystemen mit Hardlinks)
+	Format           string
+	Compression      string // "gzip" (Standard), "zstd", "xz", "lz4" oder "brotli"
+	CompressionLevel int    // 0 = Standardstufe des Formats
+	// Höchstgeschwindigkeit bei Übertragungen vom und zum Remote-Ziel pro Sekunde, z.B. "2MB"; leer = unbegrenzt
+	BandwidthLimit string
+	Nice           int // niedrigere Prozesspriorität (1-19), 0 = unverändert
+	// Geplante Läufe (--scheduled) fallen im Akkubetrieb unter dieser Ladung in Prozent aus
+	// bzw. halten an, bis das Netzteil angeschlossen ist; 0 = aus
+	MinBattery  int
+	SkipMetered bool // geplante Läufe mit Remote über getaktete Verbindungen auslassen
+	// Arbeitsspeicher für Programm und Kompressor, z.B. "512MB"; GOMEMLIMIT hat Vorrang.
+	// Reicht er nicht, sinken Threads und Stufe des Kompressors.
+	MaxMemory  string
+	MaxThreads int                // höchstens so viele CPUs für Leser und Kompressor nutzen, 0 = alle
+	Profiles   map[string]Profile // mit --profile auswählbare Abweichungen
+	// JSON-Dateien oder HTTPS-URLs mit weiteren Profilen, z.B. zentral vorgegeben
+	ProfilesFrom []string
+	// Platz, der auf dem Backup-Ziel auch nach dem Backup frei bleiben muss, z.B. "2GB"; Standard 50MB
+	MinFreeSpace string
+	// Warnen, wenn das Backup-Ziel beim bisherigen Wachstum in weniger Tagen voll ist;
+	// Standard 30, -1 = aus
+	CapacityWarningDays int
+	OneFileSystem       bool // wie --one-file-system
+	StrictSecrets       bool // wie --strict-secrets
+	ReadOnlySource      bool // wie --read-only-source
+	MaxDepth            int  // Verzeichnisse ab dieser Tiefe ohne Inhalt sichern, 0 = unbegrenzt
+	MaxPathLength       int  // längere Pfade auslassen, 0 = unbegrenzt
+	// Große Dateien dieser Arten unabhängig von der Endung auslassen: "video", "audio",
+	// "image", "archive", "disk-image"; ab SkipContentMinSize (Standard 10MB)
+	SkipContent        []string
+	SkipContentMinSize string
+	// Als root nach dem Anlegen des Backup-Ziels zu diesem Benutzer wechseln; Quelle,
+	// Hooks und Kompressor laufen dann ohne root-Rechte
+	RunAs string
+	// Programm mit Argumenten, das beim Archivieren jeden Eintrag prüft und ablehnen,
+	// umbenennen oder mit Angaben fürs Manifest versehen kann (Protokoll in filter.go)
+	FilterCommand []string
+	// Privater Ed25519-Schlüssel (PEM, "attest keygen"); jedes Backup erhält damit eine
+	// signierte Bestätigung über Archiv und gesicherte Dateien
+	AttestationKey string
+	// Dateien und Verzeichnisse ohne Leserechte: "skip" (Standard, werden gemeldet) oder
+	// "fail" (Backup abbrechen)
+	UnreadableFiles string
+	// Branch und letzten Commit des Git-Repositorys im Backup vermerken und in list anzeigen
+	RecordGit bool
+	// Unicode-Form der Dateinamen im Archiv: "nfc" (Linux, Windows) oder "nfd" (macOS);
+	// leer = Namen unverändert übernehmen
+	NormalizeNames string
+	// Ausgabe der Meldungen: "" (lesbar), "text" (key=value) oder "json"
+	LogFormat string
+	LogLevel  string // "debug", "info", "warn" oder "error"; leer = "debug" bei Debug, sonst "info"
+	// Anzeige von Zeitpunkten in list, status usw.: Zeitzone "local" (Standard), "utc" oder
+	// ein Name wie "Europe/Berlin", Format "de" (Standard), "iso" oder "us". Katalog, Manifeste
+	// und Archive speichern immer UTC.
+	TimeZone   string
+	DateFormat string
+	// Zeitstempel in Dateinamen: "legacy" (Standard, 20240601_150405 in Ortszeit) oder
+	// "iso8601" (2024-06-01T150405Z in UTC, sortiert unabhängig von Zeitzone und Sommerzeit)
+	TimestampStyle string
+	// Projektverzeichnisse für "all", Muster wie ~/code/* sind erlaubt
+	Sources        []string
+	ProjectWorkers int          // gleichzeitige Backups bei "all", 0 = Hälfte der CPUs
+	Notify         NotifyConfig // Empfänger für Berichte
+	// "flat" (Standard): alle Projekte direkt im Backup-Verzeichnis; "project": je Projekt
+	// ein Unterverzeichnis mit eigenem Katalog
+	Layout string
+	// Fester Projektname statt des Verzeichnisnamens, z.B. bei mehreren Ordnern namens "api"
+	ProjectID string
+	Tracing   TracingConfig
+	PreHooks  []Hook // vor dem Archivieren, z.B. Datenbank-Dumps
+	PostHooks []Hook // nach einem erfolgreichen Backup
+
+	backupRoot  string   // BackupDir vor der Auswahl des Projektverzeichnisses
+	unknownKeys []string // Schlüssel aus config.json ohne passendes Feld
+}
+
+// backupOptions sind die Kommandozeilenangaben für einen Backup-Lauf
+type backupOptions struct {
+	Tag     string
+	Profile string
+	Format  string
+	// Nur das Dateisystem des Projekts sichern, eingehängte Laufwerke auslassen
+	OneFileSystem bool
+	StrictSecrets bool // Backup abbrechen, wenn Zugangsdaten gefunden werden
+	// Sicherstellen, dass nichts in das Quellverzeichnis geschrieben wird
+	ReadOnlySource bool
+	// Zusätzlich ein selbstentpackendes Shell-Skript neben dem Archiv anlegen
+	SelfExtracting bool
+	// Mit niedrigster CPU- und I/O-Priorität laufen, damit die Arbeit am Rechner nicht leidet
+	Background bool
+	// Aus Timer oder cron gestartet: MinBattery und SkipMetered beachten
+	Scheduled bool
+	StatusFD  int // Fortschritt als JSON-Zeilen in diesen Dateideskriptor schreiben, 0 = aus
 }
 
 var defaultConfig = Config{
-	MaxBackups: 10,
-	Debug:      true,
-	TimeFormat: "02012006_150405",
+	MaxBackups:   10,
+	Debug:        true,
+	TimeFormat:   "02012006_150405",
+	Duplicates:   "keep",
+	SpecialFiles: "metadata",
 	Excludes: []string{
 		// Entwicklungsumgebungen
 		".idea",
@@ -117,61 +244,58 @@ var defaultConfig = Config{
 	},
 }
 
-var currentBackup string
-
-type LogLevel int
-
-const (
-	LogError LogLevel = iota
-	LogWarning
-	LogInfo
-	LogDebug
-)
-
-func logMessage(level LogLevel, format string, a ...interface{}) {
-	prefix := ""
-	switch level {
-	case LogError:
-		prefix = "FEHLER: "
-	case LogWarning:
-		prefix = "WARNUNG: "
-	case LogInfo:
-		prefix = "INFO: "
-	case LogDebug:
-		if !defaultConfig.Debug {
-			return
-		}
-		prefix = "DEBUG: "
-	}
-	fmt.Printf(prefix+format+"\n", a...)
+// newDefaultConfig liefert eine Kopie der Standardeinstellungen, damit spätere Änderungen
+// an der Konfiguration (z.B. BackupDir) defaultConfig nicht verändern
+func newDefaultConfig() *Config {
+	config := defaultConfig
+	config.Excludes = append([]string(nil), defaultConfig.Excludes...)
+	return &config
 }
 
+var currentBackup string
+
 func handleError(message string, err error, cleanup func()) {
 	if err != nil {
 		if cleanup != nil {
 			cleanup()
 		}
-		fmt.Fprintf(os.Stderr, "%s: %v\n", message, err)
+		finishRun("", fmt.Errorf("%s: %v", message, err))
+		if _, console := logger.Handler().(*consoleHandler); console {
+			fmt.Fprintln(os.Stderr, colorize(colorRed, fmt.Sprintf("%s: %v", message, err)))
+		} else {
+			logger.Error(message, "error", err)
+		}
 		os.Exit(1)
 	}
 }
 
-func checkTarAvailable() error {
-	_, err := exec.LookPath("tar")
-	if err != nil {
-		return fmt.Errorf("tar ist nicht installiert: %v", err)
+// checkAccess prüft Schreib- und Leserechte, ohne etwas anzulegen; access() meldet auch
+// schreibgeschützt eingehängte Dateisysteme
+func checkAccess(dir string) error {
+	if err := syscall.Access(dir, 0x7); err != nil { // R_OK|W_OK|X_OK
+		return fmt.Errorf("keine Schreibrechte in %s: %v", dir, err)
 	}
 	return nil
 }
 
+// checkPermissions legt eine Probedatei an und ist daher nur für Backup-Verzeichnisse
+// gedacht; sie erkennt auch Netzlaufwerke, deren Rechte access() nicht kennt
 func checkPermissions(dir string) error {
-	// Prüfe Lese- und Schreibrechte
-	tempFile := filepath.Join(dir, ".backup_test")
-	err := os.WriteFile(tempFile, []byte("test"), 0644)
+	if err := assertWritable(dir); err != nil {
+		return err
+	}
+	// Prüfe Lese- und Schreibrechte; eigener Name, da parallele Backups dasselbe Verzeichnis prüfen
+	f, err := os.CreateTemp(dir, ".backup_test_*")
 	if err != nil {
 		return fmt.Errorf("keine Schreibrechte in %s: %v", dir, err)
 	}
+	tempFile := f.Name()
 	defer os.Remove(tempFile)
+	_, err = f.WriteString("test")
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("keine Schreibrechte in %s: %v", dir, err)
+	}
 
 	_, err = os.ReadFile(tempFile)
 	if err != nil {
@@ -189,7 +313,7 @@ func loadConfig(filename string) (*Config, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return &defaultConfig, nil
+			return newDefaultConfig(), nil
 		}
 		return nil, err
 	}
@@ -198,69 +322,440 @@ func loadConfig(filename string) (*Config, error) {
 	if err != nil {
 		return nil, fmt.Errorf("fehler beim Lesen der Konfiguration: %v", err)
 	}
+	config.unknownKeys = unknownConfigKeys(data)
+	base, err := filepath.Abs(filepath.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	config.BackupDir = expandPath(config.BackupDir, base)
+	config.Remote = expandPath(config.Remote, base)
+	config.SpoolDir = expandPath(config.SpoolDir, base)
+	config.AttestationKey = expandPath(config.AttestationKey, base)
+	for i, source := range config.Sources {
+		config.Sources[i] = expandPath(source, base)
+	}
+	for _, list := range [][]string{config.ExcludesFrom, config.ProfilesFrom} {
+		for i, source := range list {
+			if !isURL(source) {
+				list[i] = expandPath(source, base)
+			}
+		}
+	}
 	return &config, nil
 }
 
+// expandPath ersetzt ~ und Umgebungsvariablen ($HOME, ${USER}) in Pfaden aus der
+// Konfiguration; relative Pfade gelten ab dem Verzeichnis der config.json
+func expandPath(path, base string) string {
+	if path == "" {
+		return ""
+	}
+	path = expandHome(os.ExpandEnv(path))
+	if path == "~" {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home
+		}
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(base, path)
+	}
+	return path
+}
+
+// saveConfigValues setzt einzelne Einstellungen in einer Konfigurationsdatei und
+// lässt alle übrigen Einträge unverändert
+func saveConfigValues(filename string, values map[string]interface{}) error {
+	config := make(map[string]interface{})
+	data, err := os.ReadFile(filename)
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return fmt.Errorf("fehler beim Lesen der Konfiguration: %v", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	for key, value := range values {
+		config[key] = value
+	}
+	data, err = json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, append(data, '\n'), 0644)
+}
+
+// ignoreUnknownConfig lässt unbekannte Schlüssel in config.json nur warnen statt abbrechen
+var ignoreUnknownConfig bool
+
+// sourceOverride ist das mit --source angegebene Projektverzeichnis; leer = aktuelles Verzeichnis
+var sourceOverride string
+
+// projectSourceDir liefert das zu sichernde Projektverzeichnis als absoluten Pfad
+func projectSourceDir() (string, error) {
+	if sourceOverride == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("fehler beim Ermitteln des aktuellen Verzeichnisses: %v", err)
+		}
+		return dir, nil
+	}
+	dir, err := filepath.Abs(expandHome(sourceOverride))
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return "", fmt.Errorf("quellverzeichnis nicht gefunden: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("quellverzeichnis %s ist kein Verzeichnis", dir)
+	}
+	return dir, nil
+}
+
+// configPath liefert den Pfad der config.json im Projektverzeichnis
+func configPath() string {
+	if sourceOverride == "" {
+		return "config.json"
+	}
+	dir, err := projectSourceDir()
+	if err != nil {
+		return "config.json"
+	}
+	return filepath.Join(dir, "config.json")
+}
+
+// loadProject lädt die Konfiguration und ermittelt Quellverzeichnis und Projektnamen
+func loadProject() (*Config, string, string, error) {
+	// Absolute Pfade ermitteln
+	sourceDir, err := projectSourceDir()
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	// Lade Konfiguration aus config.json im Projektverzeichnis; ohne Datei gelten die
+	// Standardeinstellungen, eine fehlerhafte Datei bricht ab, statt z.B. ohne
+	// Verschlüsselung oder in ein anderes Verzeichnis zu sichern
+	configFile := filepath.Join(sourceDir, "config.json")
+	config, err := loadConfig(configFile)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%s: %v", configFile, err)
+	}
+	// Tippfehler wie "MaxBackps" würden sonst stillschweigend den Standardwert ergeben
+	var problems []string
+	for _, key := range config.unknownKeys {
+		if ignoreUnknownConfig {
+			logMessage(LogWarning, "Unbekannte Einstellung %q in config.json wird ignoriert", key)
+		} else {
+			problems = append(problems, fmt.Sprintf("unbekannte Einstellung %q (--ignore-unknown-config zum Ignorieren)", key))
+		}
+	}
+	if err := mergeSharedProfiles(config); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if problems = append(problems, validateConfig(config)...); len(problems) > 0 {
+		return nil, "", "", fmt.Errorf("ungültige Konfiguration:%s", problemList(problems))
+	}
+
+	if err := setupLogging(config); err != nil {
+		return nil, "", "", err
+	}
+	if err := setupDisplayTime(config); err != nil {
+		return nil, "", "", err
+	}
+
+	if config.BackupDir == "" {
+		config.BackupDir = filepath.Join(filepath.Dir(sourceDir), "Backup")
+	}
+	projectName, err := projectIdentity(config, sourceDir)
+	if err != nil {
+		return nil, "", "", err
+	}
+	config.backupRoot = config.BackupDir
+	switch config.Layout {
+	case "", "flat":
+	case "project":
+		config.BackupDir = filepath.Join(config.BackupDir, projectName)
+	default:
+		return nil, "", "", fmt.Errorf("ungültiges Layout %q (möglich: flat, project)", config.Layout)
+	}
+	auditDir = config.BackupDir
+	return config, sourceDir, projectName, nil
+}
+
 func main() {
+	colorMode, args := extractGlobalFlag(os.Args[1:], "color", "auto")
+	sourceOverride, args = extractGlobalFlag(args, "source", "")
+	ignoreUnknownConfig, args = extractGlobalBool(args, "ignore-unknown-config")
+	os.Args = append(os.Args[:1], args...)
+	if err := setColorMode(colorMode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		var err error
+		switch os.Args[1] {
+		case "restore":
+			err = runRestore(os.Args[2:])
+		case "install-git-hook":
+			err = runInstallGitHook(os.Args[2:])
+		case "run":
+			err = runGuarded(os.Args[2:])
+		case "import":
+			err = runImport(os.Args[2:])
+		case "list":
+			err = runList(os.Args[2:])
+		case "sync-metadata":
+			err = runSyncMetadata(os.Args[2:])
+		case "fetch":
+			err = runFetch(os.Args[2:])
+		case "bench":
+			err = runBench(os.Args[2:])
+		case "du":
+			err = runDu(os.Args[2:])
+		case "inventory":
+			err = runInventory(os.Args[2:])
+		case "status":
+			err = runStatus(os.Args[2:])
+		case "all":
+			err = runAll(os.Args[2:])
+		case "migrate-layout":
+			err = runMigrateLayout(os.Args[2:])
+		case "project":
+			err = runProject(os.Args[2:])
+		case "verify-dir":
+			err = runVerifyDir(os.Args[2:])
+		case "scrub":
+			err = runScrub(os.Args[2:])
+		case "prune":
+			err = runPrune(os.Args[2:])
+		case "config":
+			err = runConfig(os.Args[2:])
+		case "stats":
+			err = runStats(os.Args[2:])
+		case "doctor":
+			err = runDoctor(os.Args[2:])
+		case "pause":
+			err = runPause(os.Args[2:])
+		case "resume":
+			err = runResume(os.Args[2:])
+		case "spool":
+			err = runSpool(os.Args[2:])
+		case "repack":
+			err = runRepack(os.Args[2:])
+		case "compact":
+			err = runCompact(os.Args[2:])
+		case "relocate":
+			err = runRelocate(os.Args[2:])
+		case "attest":
+			err = runAttest(os.Args[2:])
+		case "verify":
+			err = runVerify(os.Args[2:])
+		default:
+			fmt.Fprintf(os.Stderr, "unbekannter Befehl: %s\n", os.Args[1])
+			os.Exit(2)
+		}
+		handleError("fehler bei "+os.Args[1], err, nil)
+		return
+	}
+
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	var opts backupOptions
+	flags.StringVar(&opts.Tag, "tag", "", "Markierung, die im Katalog zum Backup gespeichert wird (z.B. ein Commit-Hash)")
+	flags.StringVar(&opts.Profile, "profile", "", "Einstellungen aus Profiles in config.json verwenden")
+	flags.StringVar(&opts.Format, "format", "", "Archivformat: tar, zip oder snapshot (Standard: Format aus config.json)")
+	flags.BoolVar(&opts.OneFileSystem, "one-file-system", false, "keine anderen Dateisysteme (Mounts) innerhalb des Projekts sichern")
+	flags.StringVar(&sourceOverride, "source", sourceOverride, "Projektverzeichnis, das gesichert wird (Standard: aktuelles Verzeichnis; gilt auch für Unterbefehle)")
+	flags.BoolVar(&ignoreUnknownConfig, "ignore-unknown-config", ignoreUnknownConfig, "unbekannte Einstellungen in config.json nur melden statt abbrechen (gilt auch für Unterbefehle)")
+	flags.BoolVar(&opts.StrictSecrets, "strict-secrets", false, "abbrechen, wenn Dateien nach Schlüsseln oder Zugangsdaten aussehen")
+	flags.BoolVar(&opts.ReadOnlySource, "read-only-source", false, "abbrechen, statt etwas in das Projektverzeichnis zu schreiben (Ziel, Prüfdateien)")
+	flags.BoolVar(&opts.Background, "background", false, "mit niedrigster CPU- und I/O-Priorität sichern, um die Arbeit am Rechner nicht zu stören")
+	flags.BoolVar(&opts.Scheduled, "scheduled", false, "geplanter Lauf (Timer, cron): bei schwachem Akku oder getakteter Verbindung auslassen")
+	flags.IntVar(&opts.StatusFD, "status-fd", 0, "Fortschritt für Oberflächen als JSON-Zeilen in diesen Dateideskriptor schreiben (z.B. 3)")
+	flags.BoolVar(&opts.SelfExtracting, "self-extracting", false, "zusätzlich ein selbstentpackendes Skript (.sh) anlegen, das ohne backup-tool wiederherstellt")
+	flags.Parse(os.Args[1:])
+
+	// Meldungen gehen nach stderr, auf stdout steht nur der Pfad des Archivs
+	fmt.Println(runBackup(opts))
+}
+
+// runBackup sichert das aktuelle Verzeichnis und liefert den Pfad des Archivs.
+// Bei Fehlern wird das Programm beendet.
+func runBackup(opts backupOptions) string {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-sigChan
-		fmt.Println("\nProgramm wird beendet...")
+		fmt.Fprintln(os.Stderr, "\nProgramm wird beendet...")
 		// Cleanup falls nötig
 		if currentBackup != "" {
 			os.Remove(currentBackup)
 		}
+		finishRun("", fmt.Errorf("abgebrochen"))
 		os.Exit(1)
 	}()
-
-	err := checkTarAvailable()
-	handleError("fehler: tar wird benötigt", err, nil)
-
-	// Lade Konfiguration aus config.json im aktuellen Verzeichnis
-	config, err := loadConfig("config.json")
-	if err != nil {
-		logMessage(LogWarning, "Konnte Konfigurationsdatei nicht laden: %v\nVerwende Standardeinstellungen", err)
-		config = &defaultConfig
+	handlePauseSignals()
+	if opts.StatusFD > 0 {
+		err := openStatusFD(opts.StatusFD)
+		handleError("fehler", err, nil)
 	}
 
-	// Absolute Pfade ermitteln
-	sourceDir, err := os.Getwd()
-	handleError("fehler beim Ermitteln des aktuellen Verzeichnisses", err, nil)
+	config, sourceDir, projectName, err := loadProject()
+	handleError("fehler beim Laden des Projekts", err, nil)
 	logMessage(LogInfo, "Quellverzeichnis: %s", sourceDir)
-
-	projectName := filepath.Base(sourceDir)
-	if config.BackupDir == "" {
-		config.BackupDir = filepath.Join(filepath.Dir(sourceDir), "Backup")
-	}
+	logger = logger.With("project", projectName)
 	logMessage(LogInfo, "Projektname: %s", projectName)
 	logMessage(LogInfo, "Backup-Verzeichnis: %s", config.BackupDir)
+	if opts.Format != "" {
+		config.Format = opts.Format
+	}
+	if opts.Scheduled {
+		if reason := deferralReason(config); reason != "" {
+			deferRun(config, projectName, reason)
+			os.Exit(0)
+		}
+	}
+
+	if opts.ReadOnlySource || config.ReadOnlySource {
+		err = enforceReadOnlySource(config, sourceDir)
+		handleError("fehler in der Konfiguration", err, nil)
+	}
+
+	// Ziel, Rechte und Platz prüfen, bevor aufwendige Arbeit beginnt; ein nicht
+	// eingehängtes Laufwerk darf nicht erst als Verzeichnis angelegt werden
+	target := config.BackupDir
+	err = preflight(config, projectName)
+	if err != nil && config.SpoolDir != "" {
+		err = spoolBackupDir(config, projectName, err)
+	}
+	handleError("fehler bei der Vorabprüfung", err, nil)
+	spooled := config.BackupDir != target
 
 	// Backup-Verzeichnis erstellen
+	created := missingDirs(config.BackupDir)
 	if err := os.MkdirAll(config.BackupDir, 0755); err != nil {
 		fmt.Fprintf(os.Stderr, "fehler beim Erstellen des Backup-Verzeichnisses: %v\n", err)
 		os.Exit(1)
 	}
 	logMessage(LogInfo, "Backup-Verzeichnis erstellt oder existiert bereits")
+	// Pipes verschlüsselter 7z-Archive, die ein abgestürzter Lauf zurückgelassen hat
+	removeStalePasswordDirs(config.BackupDir)
+	if !config.IncludeInTimeMachine {
+		if err := excludeFromSystemBackup(config.backupRoot); err != nil {
+			logMessage(LogWarning, "Backup-Verzeichnis nicht von Time Machine ausgenommen: %v", err)
+		}
+	}
+	if config.RunAs != "" {
+		err = dropPrivileges(config.RunAs, created)
+		handleError("fehler beim Abgeben der Rechte", err, nil)
+		err = checkTargetWritable(config.BackupDir)
+		handleError("fehler: Backup-Ziel für "+config.RunAs+" nicht beschreibbar", err, nil)
+	}
+	startRun(config, projectName)
+	if opts.Scheduled {
+		watchPower(config)
+	}
+	if !spooled {
+		flushSpool(config, projectName)
+	}
 
-	// Alte Backups aufräumen
-	err = cleanupOldBackups(config.BackupDir, projectName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "fehler beim Aufräumen alter Backups: %v\n", err)
-		os.Exit(1)
+	// Alte Backups aufräumen; für zwischengespeicherte gilt stattdessen SpoolMaxSize
+	span := startSpan("prune", nil)
+	switch {
+	case spooled:
+	case config.Retention != "":
+		err = applyRetention(config, projectName)
+	default:
+		err = cleanupOldBackups(config.BackupDir, projectName, retainedBackups(config))
+	}
+	span.finish(err)
+	handleError("fehler beim Aufräumen alter Backups", err, nil)
+
+	err = applyProfile(config, opts.Profile)
+	handleError("fehler beim Laden des Profils", err, nil)
+	if opts.Background {
+		if err := enterBackground(); err != nil {
+			logMessage(LogWarning, "Hintergrundpriorität konnte nicht gesetzt werden: %v", err)
+		}
+	} else if err := applyPriority(config.Nice); err != nil {
+		logMessage(LogWarning, "Priorität konnte nicht gesenkt werden: %v", err)
+	}
+	err = applyResourceLimits(config)
+	handleError("fehler in der Konfiguration", err, nil)
+	compression, err := backupCompression(config)
+	handleError("fehler bei der Kompression", err, nil)
+	level, err := compression.level(config.CompressionLevel)
+	handleError("fehler bei der Kompression", err, nil)
+	if limited := compression.limitLevel(level); limited < level {
+		logMessage(LogWarning, "Stufe %d von %s braucht etwa %s je Thread und passt nicht in MaxMemory, verwende Stufe %d",
+			level, compression.Name, formatSize(compression.memory(level)), limited)
+		level = limited
 	}
+	extension, compressionName := compression.Extension, compression.Name
+	switch config.Format {
+	case "", "tar":
+	case "zip":
+		extension, compressionName = zipExtension, "zip"
+	case "snapshot":
+		extension, compressionName = snapshotExtension, "snapshot"
+	default:
+		handleError("fehler: ungültiges Archivformat", fmt.Errorf("%q (möglich: tar, zip, snapshot)", config.Format), nil)
+	}
+
+	hookEnv := map[string]string{
+		"BACKUP_PROJECT": projectName,
+		"BACKUP_SOURCE":  sourceDir,
+		"BACKUP_DIR":     config.BackupDir,
+		"BACKUP_RUN_ID":  runID,
+	}
+	span = startSpan("pre-hooks", nil)
+	err = runHooks("Pre", config.PreHooks, sourceDir, hookEnv, newRunData(projectName, "", 0, 0, "läuft"))
+	span.finish(err)
+	handleError("fehler vor dem Backup", err, nil)
 
 	// Zeitstempel für Backup-Datei
-	timestamp := time.Now().Format("20060102_150405")
-	backupFile := filepath.Join(config.BackupDir, fmt.Sprintf("%s_backup_%s.tar.gz", projectName, timestamp))
+	startTime := time.Now()
+	timestamp := fileTimestamp(config, startTime)
+	backupFile := filepath.Join(config.BackupDir, fmt.Sprintf("%s_backup_%s%s", projectName, timestamp, extension))
+	logger = logger.With("backup_file", backupFile)
 	logMessage(LogInfo, "Backup-Datei: %s", backupFile)
 
-	// Speicherplatz prüfen
-	err = checkDiskSpace(sourceDir, config.BackupDir)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "fehler beim Prüfen des Speicherplatzes: %v\n", err)
-		os.Exit(1)
+	archiveOpts := sourceOptions(config, projectName)
+	archiveOpts.Format = config.Format
+	archiveOpts.Compression = compression
+	archiveOpts.Level = level
+	// Im Wurzelverzeichnis, damit auch beim Layout "project" alle Projekte einen Speicher teilen
+	archiveOpts.Store = filepath.Join(config.backupRoot, snapshotStoreDir)
+	// Einen abgebrochenen Snapshot unter dem neuen Namen fortsetzen
+	if config.Format == "snapshot" {
+		previous, checkpoint, err := findSnapshotCheckpoint(config.BackupDir, projectName)
+		if err != nil {
+			logMessage(LogWarning, "%v", err)
+		} else if previous != "" && os.Rename(previous, backupFile) == nil {
+			fmt.Fprintf(os.Stderr, "Setze abgebrochenes Backup %s fort (%d Einträge bereits gesichert)\n",
+				filepath.Base(previous), len(checkpoint))
+			archiveOpts.checkpoint = checkpoint
+		}
+	}
+	archiveOpts.OneFileSystem = archiveOpts.OneFileSystem || opts.OneFileSystem
+	if config.RecordGit {
+		if archiveOpts.Git, err = readGitInfo(sourceDir); err != nil {
+			logMessage(LogWarning, "RecordGit: %v", err)
+		}
 	}
+
+	// Archivgröße und Dauer anhand einer Stichprobe schätzen; zip wird wie gzip gerechnet
+	estimate, err := estimateBackup(sourceDir, archiveOpts)
+	handleError("fehler beim Schätzen der Backup-Größe", err, nil)
+	estimate.useHistory(config.BackupDir, projectName, compressionName)
+	logMessage(LogInfo, "Geschätzte Archivgröße: %s", estimate)
+
+	// Speicherplatz prüfen
+	reserve, err := minFreeSpace(config)
+	handleError("fehler in der Konfiguration", err, nil)
+	err = checkDiskSpace(estimate, config.BackupDir, reserve)
+	handleError("fehler beim Prüfen des Speicherplatzes", err, nil)
 	logMessage(LogInfo, "Ausreichend Speicherplatz verfügbar")
 
 	// Vor der Backup-Erstellung:
@@ -270,45 +765,188 @@ func main() {
 	}
 
 	// Backup erstellen
-	err = createBackup(sourceDir, backupFile)
+	span = startSpan("compress", nil)
+	span.set("backup.compression", compressionName)
+	archiveOpts.trace = span
+	report, err := createBackup(sourceDir, backupFile, archiveOpts)
+	span.finish(err)
+	if err == nil {
+		span.set("backup.files", len(report.Files))
+	}
 	handleError("fehler beim Erstellen des Backups", err, func() {
-		os.Remove(backupFile)
+		if removeBackup(backupFile) == nil {
+			audit("delete", backupFile, "Backup fehlgeschlagen")
+		}
+	})
+	// Vor Katalog und Übertragung, damit im strikten Modus nichts das Gerät verlässt
+	encrypted := compressionName == compression.Name && compression.encrypted()
+	err = checkSecrets(report.Files, encrypted, opts.StrictSecrets || config.StrictSecrets)
+	handleError("fehler: mögliche Zugangsdaten im Backup", err, func() {
+		removeBackup(backupFile)
+		audit("delete", backupFile, "Zugangsdaten gefunden (--strict-secrets)")
 	})
 
 	// Backup-Größe ermitteln
 	fileInfo, err := os.Stat(backupFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "fehler beim Ermitteln der Backup-Größe: %v\n", err)
-		os.Exit(1)
+	handleError("fehler beim Ermitteln der Backup-Größe", err, nil)
+	size := fileInfo.Size()
+	fmt.Fprintln(os.Stderr, colorize(colorGreen, "✓ Backup erstellt: "+backupFile))
+	if config.Format == "snapshot" {
+		// Ein Snapshot belegt nur, was noch nicht im Speicher lag
+		size = report.Stored
+		fmt.Fprintf(os.Stderr, "  Neu im Speicher: %s\n", formatSize(size))
+	} else {
+		fmt.Fprintf(os.Stderr, "  Größe: %s\n", formatSize(size))
 	}
-	fmt.Printf("✓ Backup erstellt: %s\n", backupFile)
-	fmt.Printf("  Größe: %s\n", formatSize(fileInfo.Size()))
-
-	// Aktuelle Backups anzeigen
-	err = listBackups(config.BackupDir, projectName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "fehler beim Auflisten der Backups: %v\n", err)
-		os.Exit(1)
+	report.Excluded.print()
+	if available, err := freeSpace(config.BackupDir); err == nil && available < reserve {
+		logMessage(LogWarning, "Auf %s sind nur noch %s frei, weniger als die Mindestreserve von %s",
+			config.BackupDir, formatSize(available), formatSize(reserve))
 	}
 
 	// Backup-Integrität zum Schluss prüfen
-	fmt.Printf("\nVerifiziere Backup-Integrität...\n")
+	fmt.Fprintf(os.Stderr, "\nVerifiziere Backup-Integrität...\n")
+	span = startSpan("verify", nil)
 	err = verifyBackup(backupFile)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "fehler bei der Backup-Verifizierung: %v\n", err)
-		os.Remove(backupFile)
-		os.Exit(1)
+	span.finish(err)
+	handleError("fehler bei der Backup-Verifizierung", err, func() {
+		removeBackup(backupFile)
+		audit("delete", backupFile, "Verifizierung fehlgeschlagen")
+	})
+	fmt.Fprintln(os.Stderr, colorize(colorGreen, "+ Backup-Integrität bestätigt"))
+
+	// Manifest mit den beim Archivieren berechneten Prüfsummen
+	manifest := newManifest(backupFile, projectName, report.Files)
+	manifest.Entries = report.Entries
+	manifest.Skipped = report.Skipped
+	if err := saveManifest(backupFile, manifest); err != nil {
+		logMessage(LogWarning, "Konnte Manifest nicht speichern: %v", err)
+	}
+
+	entry := CatalogEntry{
+		Project:     projectName,
+		File:        filepath.Base(backupFile),
+		Created:     startTime.UTC(),
+		Size:        size,
+		SourceDir:   sourceDir,
+		Tag:         opts.Tag,
+		Compression: compressionName,
+		Encrypted:   encrypted,
+		Git:         archiveOpts.Git,
+		TreeRoot:    manifest.Tree[""],
+	}
+	for _, file := range report.Files {
+		entry.SourceSize += file.Size
+	}
+	// Snapshots prüfen ihre Dateien einzeln anhand des Index
+	if config.Format != "snapshot" {
+		if sum, err := hashFile(backupFile); err == nil {
+			entry.SHA256 = sum
+		} else {
+			logMessage(LogWarning, "Prüfsumme des Archivs nicht berechnet: %v", err)
+		}
+	}
+
+	// Unveränderte Projekte belegen keinen weiteren Platz in der Aufbewahrung
+	if config.Duplicates == "skip" || config.Duplicates == "marker" {
+		if previous, ok := findIdenticalPrevious(config.BackupDir, projectName, manifest); ok {
+			removeBackup(backupFile)
+			os.Remove(manifestPath(backupFile))
+			audit("delete", backupFile, "unverändert seit "+previous.archiveFile())
+			fmt.Fprintf(os.Stderr, "= Keine Änderungen seit %s, neues Archiv verworfen\n", previous.archiveFile())
+			backupFile = filepath.Join(config.BackupDir, previous.archiveFile())
+			entry.SameAs = previous.archiveFile()
+			entry.Size = 0
+			if config.Duplicates == "skip" {
+				entry = CatalogEntry{}
+			}
+		}
+	}
+
+	// Bestätigung für Prüfer, nur für tatsächlich neu geschriebene Archive
+	if config.AttestationKey != "" && entry.File != "" && entry.SameAs == "" {
+		if err := writeAttestation(config.AttestationKey, backupFile, manifest, entry.SHA256); err != nil {
+			logMessage(LogWarning, "Bestätigung nicht signiert: %v", err)
+		} else {
+			logMessage(LogInfo, "Signierte Bestätigung: %s", filepath.Base(attestationPath(backupFile)))
+		}
+	}
+
+	if opts.SelfExtracting && config.Format == "snapshot" {
+		logMessage(LogWarning, "Für Snapshots wird kein selbstentpackendes Archiv angelegt")
+	} else if opts.SelfExtracting {
+		if path, err := writeSelfExtracting(backupFile, projectName, sourceDir, archiveOpts); err != nil {
+			logMessage(LogWarning, "Selbstentpackendes Archiv konnte nicht angelegt werden: %v", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "✓ Selbstentpackendes Archiv: %s (sh %s [ZIEL])\n", path, filepath.Base(path))
+		}
 	}
-	fmt.Printf("+ Backup-Integrität bestätigt\n")
 
-	err = checkPermissions(config.BackupDir)
-	handleError("fehler: unzureichende Berechtigungen", err, nil)
+	// Backup im Katalog vermerken
+	if entry.File != "" {
+		entry.Warnings = runWarnings
+		entry.Duration = time.Since(startTime)
+		err = updateCatalog(config.BackupDir, func(c *Catalog) {
+			c.add(entry)
+		})
+		if err != nil {
+			logMessage(LogWarning, "Konnte Backup nicht im Katalog vermerken: %v", err)
+		}
+	}
+	if spooled {
+		fmt.Fprintln(os.Stderr, colorize(colorYellow, "! Backup liegt im Zwischenspeicher und wird beim nächsten Lauf nach "+target+" verschoben"))
+		if err := limitSpool(config, projectName); err != nil {
+			logMessage(LogWarning, "SpoolMaxSize: %v", err)
+		}
+	}
+
+	checkCapacity(config)
+
+	// Aktuelle Backups anzeigen
+	err = listBackups(config.BackupDir, projectName)
+	handleError("fehler beim Auflisten der Backups", err, nil)
+
+	// Kopie auf dem Remote-Ziel; das lokale Backup bleibt auch bei Fehlern gültig
+	if config.Remote != "" && config.Format == "snapshot" {
+		logMessage(LogWarning, "Snapshots werden nicht auf das Remote-Ziel übertragen")
+	} else if config.Remote != "" && entry.SameAs == "" && entry.File != "" {
+		span := startSpan("upload", nil)
+		err := uploadBackup(config, backupFile, entry)
+		span.finish(err)
+		if err != nil {
+			logMessage(LogWarning, "Übertragung auf das Remote-Ziel fehlgeschlagen: %v", err)
+			if config.SpoolDir != "" {
+				if err := queueUpload(config, projectName, entry); err != nil {
+					logMessage(LogWarning, "Übertragung konnte nicht vorgemerkt werden: %v", err)
+				} else {
+					logMessage(LogInfo, "Übertragung wird beim nächsten Lauf nachgeholt")
+				}
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, colorize(colorGreen, "✓ Backup nach "+config.Remote+" übertragen"))
+			// Bei RemoteAppendOnly räumt nur "prune --remote" auf
+			if config.RemoteRetention != "" && !config.RemoteAppendOnly {
+				if err := applyRemoteRetention(config, projectName); err != nil {
+					logMessage(LogWarning, "Aufräumen auf dem Remote-Ziel fehlgeschlagen: %v", err)
+				}
+			}
+		}
+	}
+
+	hookEnv["BACKUP_ARCHIVE"] = backupFile
+	span = startSpan("post-hooks", nil)
+	err = runHooks("Post", config.PostHooks, sourceDir, hookEnv, newRunData(projectName, backupFile, size, time.Since(startTime), "ok"))
+	span.finish(err)
+	handleError("fehler nach dem Backup", err, nil)
+	logger.Info("Backup abgeschlossen", "duration", time.Since(startTime).Round(time.Millisecond), "size", size)
+	finishRun(backupFile, nil)
+	return backupFile
 }
 
-func cleanupOldBackups(backupDir, projectName string) error {
+// cleanupOldBackups behält die neuesten keep Archive (MaxBackups) des Projekts
+func cleanupOldBackups(backupDir, projectName string, keep int) error {
 	logMessage(LogInfo, "Suche nach alten Backups...")
-	pattern := filepath.Join(backupDir, fmt.Sprintf("%s_backup_*.tar.gz", projectName))
-	files, err := filepath.Glob(pattern)
+	files, err := projectArchives(backupDir, projectName)
 	if err != nil {
 		return err
 	}
@@ -333,128 +971,233 @@ func cleanupOldBackups(backupDir, projectName string) error {
 		return backups[i].modTime.After(backups[j].modTime)
 	})
 
-	if len(backups) > defaultConfig.MaxBackups {
-		logMessage(LogInfo, "Maximale Backup-Anzahl erreicht, lösche %d alte Backups", len(backups)-defaultConfig.MaxBackups)
-		for i := defaultConfig.MaxBackups; i < len(backups); i++ {
-			logMessage(LogInfo, "Lösche: %s", backups[i].path)
-			if err := os.Remove(backups[i].path); err != nil {
-				return fmt.Errorf("fehler beim Löschen von %s: %v", backups[i].path, err)
-			}
+	if len(backups) > keep {
+		logMessage(LogInfo, "Maximale Backup-Anzahl erreicht, lösche %d alte Backups", len(backups)-keep)
+		var removed []string
+		for _, backup := range backups[keep:] {
+			removed = append(removed, filepath.Base(backup.path))
 		}
+		return deleteArchives(backupDir, removed, fmt.Sprintf("mehr als %d Backups", keep))
 	}
 	return nil
 }
 
-func checkDiskSpace(sourceDir, backupDir string) error {
-	logMessage(LogInfo, "Prüfe verfügbaren Speicherplatz...")
+// findIdenticalPrevious prüft, ob das letzte Backup des Projekts denselben Inhalt hat
+func findIdenticalPrevious(backupDir, projectName string, manifest *Manifest) (CatalogEntry, bool) {
+	catalog, err := loadCatalog(backupDir)
+	if err != nil {
+		return CatalogEntry{}, false
+	}
+	entries := catalog.forProject(projectName)
+	if len(entries) == 0 {
+		return CatalogEntry{}, false
+	}
+	previous := entries[len(entries)-1]
+	if previous.archiveFile() == manifest.Archive {
+		return CatalogEntry{}, false
+	}
+	previousManifest, err := loadManifest(filepath.Join(backupDir, previous.archiveFile()))
+	if err != nil {
+		return CatalogEntry{}, false
+	}
+	return previous, contentHash(previousManifest) == contentHash(manifest)
+}
 
-	// Quellgröße ermitteln
-	var sourceSize int64
-	err := filepath.Walk(sourceDir, func(path string, info os.FileInfo, err error) error {
+// sourceOptions liefert die Einstellungen, die bestimmen, was aus der Quelle gesichert wird
+func sourceOptions(config *Config, projectName string) archiveOptions {
+	opts := archiveOptions{
+		Project:       projectName,
+		Workers:       config.Workers,
+		SpecialFiles:  config.SpecialFiles,
+		OneFileSystem: config.OneFileSystem,
+		MaxDepth:      config.MaxDepth,
+		MaxPathLength: config.MaxPathLength,
+		SkipContent:   config.SkipContent,
+	}
+	opts.NormalizeNames = strings.ToLower(config.NormalizeNames)
+	opts.UnreadableFiles = config.UnreadableFiles
+	opts.Filter = config.FilterCommand
+	excludes, err := configExcludes(config)
+	if err != nil {
+		logMessage(LogWarning, "%v", err)
+	}
+	opts.Excludes = excludes
+	opts.SkipContentMinSize = defaultSkipContentMinSize
+	if config.SkipContentMinSize != "" {
+		if size, err := parseSize(config.SkipContentMinSize); err == nil {
+			opts.SkipContentMinSize = size
+		} else {
+			logMessage(LogWarning, "SkipContentMinSize: %v, verwende 10MB", err)
+		}
+	}
+	return opts
+}
+
+// configExcludes liefert die Standard-Excludes, Excludes und die Muster aus ExcludesFrom
+func configExcludes(config *Config) ([]string, error) {
+	excludes := append([]string(nil), defaultConfig.Excludes...)
+	add := func(pattern string) {
+		if !containsString(excludes, pattern) {
+			excludes = append(excludes, pattern)
+		}
+	}
+	for _, pattern := range config.Excludes {
+		add(pattern)
+	}
+	var errs []string
+	for _, file := range config.ExcludesFrom {
+		patterns, err := readPatternFile(file)
 		if err != nil {
-			return err
+			errs = append(errs, err.Error())
+			continue
 		}
-		if !info.IsDir() {
-			sourceSize += info.Size()
+		for _, pattern := range patterns {
+			add(pattern)
 		}
-		return nil
-	})
-	if err != nil {
-		return fmt.Errorf("fehler beim Ermitteln der Quellgröße: %v", err)
 	}
-
-	if sourceSize == 0 {
-		return fmt.Errorf("quellverzeichnis scheint leer zu sein")
+	if len(errs) > 0 {
+		return excludes, fmt.Errorf("ExcludesFrom: %s", strings.Join(errs, "; "))
 	}
+	return excludes, nil
+}
 
-	// Verfügbaren Speicherplatz ermitteln
-	var stat syscall.Statfs_t
-	err = syscall.Statfs(backupDir, &stat)
+// readPatternFile liest eine Datei oder URL mit einem Muster pro Zeile
+func readPatternFile(path string) ([]string, error) {
+	data, err := loadPreset(path)
 	if err != nil {
-		return fmt.Errorf("fehler beim Ermitteln des verfügbaren Speicherplatzes: %v", err)
+		return nil, err
 	}
-
-	available := stat.Bavail * uint64(stat.Bsize)
-	required := uint64(float64(sourceSize) * 1.1) // 10% extra für Komprimierung
-
-	// Mindestens 50MB oder 10% der Quellgröße frei lassen
-	minSpace := uint64(50 * 1024 * 1024)
-	if required < minSpace {
-		required = minSpace
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		patterns = append(patterns, line)
 	}
+	return patterns, nil
+}
 
-	if available < required {
-		return fmt.Errorf("nicht genügend Speicherplatz. benötigt: %s, verfügbar: %s",
-			formatSize(int64(required)),
-			formatSize(int64(available)))
+// minFreeSpace liefert den Platz, der auf dem Backup-Ziel frei bleiben muss
+func minFreeSpace(config *Config) (int64, error) {
+	if config.MinFreeSpace == "" {
+		return 50 * 1024 * 1024, nil
 	}
-
-	logMessage(LogInfo, "Quellgröße: %s", formatSize(sourceSize))
-	logMessage(LogInfo, "Verfügbarer Speicherplatz: %s", formatSize(int64(available)))
-	return nil
+	return parseSize(config.MinFreeSpace)
 }
 
-func createBackup(sourceDir, backupFile string) error {
-	logMessage(LogInfo, "Erstelle Backup...")
-	args := []string{"-czf", backupFile, "-C", sourceDir}
+// freeSpace liefert den für den Benutzer verfügbaren Platz im Dateisystem von dir
+func freeSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, fmt.Errorf("fehler beim Ermitteln des verfügbaren Speicherplatzes: %v", err)
+	}
+	return int64(stat.Bavail) * int64(stat.Bsize), nil
+}
 
-	for _, exclude := range defaultConfig.Excludes {
-		args = append(args, "--exclude="+exclude)
+// backupCompression liefert das konfigurierte Format. Fehlt das Programm dafür, wird mit
+// gzip gesichert, außer das Archiv soll verschlüsselt werden: Dann wäre es im Klartext.
+// Aus demselben Grund lehnt es zip und snapshot ab, wenn ein 7z-Passwort gesetzt ist.
+func backupCompression(config *Config) (*compressionFormat, error) {
+	compression, err := compressionByName(config.Compression)
+	if err != nil {
+		return nil, err
+	}
+	if compression.encrypted() && config.Format != "" && config.Format != "tar" {
+		return nil, fmt.Errorf("BACKUP_7Z_PASSWORD ist gesetzt, Format %s speichert aber unverschlüsselt; verschlüsselt wird nur mit Format tar", config.Format)
+	}
+	if err := compression.available(); err != nil {
+		if compression.encrypted() {
+			return nil, fmt.Errorf("%v; BACKUP_7Z_PASSWORD ist gesetzt, ohne 7z wäre das Archiv unverschlüsselt", err)
+		}
+		logMessage(LogWarning, "%v, verwende stattdessen gzip", err)
+		config.CompressionLevel = 0
+		return compressionByName("gzip")
 	}
-	args = append(args, ".")
+	return compression, nil
+}
 
-	cmd := exec.Command("tar", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+// checkDiskSpace stellt sicher, dass nach dem Backup noch reserve Bytes frei sind
+func checkDiskSpace(estimate *backupEstimate, backupDir string, reserve int64) error {
+	logMessage(LogInfo, "Prüfe verfügbaren Speicherplatz...")
 
-	fmt.Printf("Erstelle Backup von %s\n", sourceDir)
-	fmt.Printf("Ausgeschlossene Dateien/Ordner: %s\n", strings.Join(defaultConfig.Excludes, ", "))
+	if estimate.SourceSize == 0 {
+		return fmt.Errorf("quellverzeichnis scheint leer zu sein")
+	}
 
-	startTime := time.Now()
-	err := cmd.Run()
+	available, err := freeSpace(backupDir)
 	if err != nil {
 		return err
 	}
+	required := int64(float64(estimate.Size)*1.1) + reserve // 10% Reserve, da die Stichprobe abweichen kann
 
-	duration := time.Since(startTime)
-	fmt.Printf("Backup-Erstellung abgeschlossen in %v\n", duration.Round(time.Second).String())
+	if available < required {
+		return fmt.Errorf("nicht genügend Speicherplatz. benötigt: %s (davon %s Mindestreserve), verfügbar: %s",
+			formatSize(required),
+			formatSize(reserve),
+			formatSize(available))
+	}
+
+	logMessage(LogInfo, "Quellgröße: %s", formatSize(estimate.SourceSize))
+	logMessage(LogInfo, "Verfügbarer Speicherplatz: %s", formatSize(available))
 	return nil
 }
 
 func verifyBackup(backupFile string) error {
 	logMessage(LogInfo, "Verifiziere Backup...")
-	cmd := exec.Command("tar", "-tzf", backupFile)
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	// Alle Einträge vollständig lesen, damit auch die Prüfsumme der Kompression geprüft wird
+	return walkArchive(backupFile, func(header *tar.Header, r io.Reader) error {
+		_, err := io.Copy(io.Discard, r)
+		return err
+	})
 }
 
 func listBackups(backupDir, projectName string) error {
 	logMessage(LogInfo, "Liste aktuelle Backups auf...")
-	pattern := filepath.Join(backupDir, fmt.Sprintf("%s_backup_*.tar.gz", projectName))
-	files, err := filepath.Glob(pattern)
+	files, err := projectArchives(backupDir, projectName)
 	if err != nil {
 		return err
 	}
 
+	// Der Katalog liefert zusätzliche Angaben wie Markierungen; ohne ihn reicht die Dateiliste
+	catalog, err := loadCatalog(backupDir)
+	if err != nil {
+		logMessage(LogWarning, "Konnte Katalog nicht lesen: %v", err)
+		catalog = &Catalog{}
+	}
+
 	var totalSize int64
 	validFiles := 0
-	fmt.Println("\nAktuelle Backups:")
+	fmt.Fprintln(os.Stderr, "\nAktuelle Backups:")
 	for _, file := range files {
 		fileInfo, err := os.Stat(file)
 		if err != nil {
 			continue
 		}
-		totalSize += fileInfo.Size()
+		size := fileInfo.Size()
 		validFiles++
-		fmt.Printf("%s vom %s (%s)\n",
+		tag := ""
+		entry, ok := catalog.find(filepath.Base(file))
+		if ok && fileInfo.IsDir() {
+			size = entry.Size
+		}
+		totalSize += size
+		if ok && entry.Tag != "" {
+			tag = " [" + entry.Tag + "]"
+		}
+		if ok && entry.Git != nil {
+			tag += " " + entry.Git.String()
+		}
+		fmt.Fprintf(os.Stderr, "%s vom %s (%s)%s\n",
 			filepath.Base(file),
 			formatDateTime(fileInfo.ModTime()),
-			formatSize(fileInfo.Size()))
+			formatSize(size),
+			tag)
 	}
 
 	if validFiles > 0 {
-		fmt.Printf("\nGesamtanzahl Backups: %d", validFiles)
-		fmt.Printf("\nGesamtgröße: %s\n", formatSize(totalSize))
+		fmt.Fprintf(os.Stderr, "\nGesamtanzahl Backups: %d", validFiles)
+		fmt.Fprintf(os.Stderr, "\nGesamtgröße: %s\n", formatSize(totalSize))
 	}
 	return nil
 }
@@ -472,7 +1215,134 @@ func formatSize(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
+// parseSize liest Größenangaben wie "512K", "2MB" oder "1.5 GB" (Basis 1024)
+func parseSize(value string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(value))
+	if s == "" {
+		return 0, nil
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "IB"), "B")
+	multiplier := int64(1)
+	if i := strings.IndexAny(s, "KMGT"); i >= 0 && i == len(s)-1 {
+		multiplier = int64(1) << (10 * (strings.IndexByte("KMGT", s[i]) + 1))
+		s = s[:i]
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("ungültige Größenangabe: %q", value)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+// fileTimestamp liefert den Zeitstempel für Archiv- und Inventurnamen nach TimestampStyle
+func fileTimestamp(config *Config, t time.Time) string {
+	if config.TimestampStyle == "iso8601" {
+		return t.UTC().Format(isoFileTimestamp)
+	}
+	return t.Local().Format(legacyFileTimestamp)
+}
+
+const (
+	legacyFileTimestamp = "20060102_150405"
+	isoFileTimestamp    = "2006-01-02T150405Z"
+)
+
+// Anzeigeformate je DateFormat: Datum mit Uhrzeit und reines Datum
+var dateFormats = map[string][2]string{
+	"de":  {"02.01.2006 15:04:05", "02.01.2006"},
+	"iso": {"2006-01-02 15:04:05", "2006-01-02"},
+	"us":  {"01/02/2006 03:04:05 PM", "01/02/2006"},
+}
+
+var (
+	displayLocation = time.Local
+	displayFormat   = dateFormats["de"]
+)
+
+// setupDisplayTime übernimmt TimeZone und DateFormat für alle Zeitangaben der Ausgabe
+func setupDisplayTime(config *Config) error {
+	switch strings.ToLower(config.TimeZone) {
+	case "", "local":
+		displayLocation = time.Local
+	case "utc":
+		displayLocation = time.UTC
+	default:
+		location, err := time.LoadLocation(config.TimeZone)
+		if err != nil {
+			return fmt.Errorf("unbekannte TimeZone %q: %v", config.TimeZone, err)
+		}
+		displayLocation = location
+	}
+	format, ok := dateFormats[strings.ToLower(config.DateFormat)]
+	if config.DateFormat == "" {
+		format, ok = dateFormats["de"], true
+	}
+	if !ok {
+		return fmt.Errorf("ungültiges DateFormat %q (möglich: de, iso, us)", config.DateFormat)
+	}
+	displayFormat = format
+	return nil
+}
+
+// formatDateTime zeigt einen Zeitpunkt in der Zeitzone und im Format der Konfiguration
 func formatDateTime(t time.Time) string {
-	// Deutsches Format für die Anzeige: TT.MM.YYYY HH:MM:SS
-	return t.Format("02.01.2006 15:04:05")
+	return t.In(displayLocation).Format(displayFormat[0]) + displayZoneSuffix()
+}
+
+func formatDate(t time.Time) string {
+	return t.In(displayLocation).Format(displayFormat[1])
+}
+
+// displayZoneSuffix kennzeichnet Zeiten, die nicht in der Ortszeit angezeigt werden
+func displayZoneSuffix() string {
+	if displayLocation == time.Local {
+		return ""
+	}
+	return " " + displayLocation.String()
+}
+
+// extractGlobalFlag entfernt --name aus den Argumenten, damit es vor und nach dem
+// Unterbefehl angegeben werden kann. Hinter "--" und im Befehl von "run" bleibt es stehen.
+func extractGlobalFlag(args []string, flagName, value string) (string, []string) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		name := strings.TrimLeft(arg, "-")
+		if arg == "--" || (arg == name && len(rest) > 0 && rest[0] == "run") {
+			return value, append(rest, args[i:]...)
+		}
+		switch {
+		case arg == name:
+			rest = append(rest, arg)
+		case strings.HasPrefix(name, flagName+"="):
+			value = strings.TrimPrefix(name, flagName+"=")
+		case name == flagName && i+1 < len(args):
+			value = args[i+1]
+			i++
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return value, rest
+}
+
+// extractGlobalBool entfernt den Schalter --name (oder --name=true/false) wie extractGlobalFlag
+func extractGlobalBool(args []string, flagName string) (bool, []string) {
+	value := false
+	var rest []string
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if arg == "--" || (arg == name && len(rest) > 0 && rest[0] == "run") {
+			return value, append(rest, args[i:]...)
+		}
+		switch {
+		case arg != name && name == flagName:
+			value = true
+		case arg != name && strings.HasPrefix(name, flagName+"="):
+			value, _ = strconv.ParseBool(strings.TrimPrefix(name, flagName+"="))
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return value, rest
 }
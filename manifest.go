@@ -0,0 +1,189 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type ManifestFile struct {
+	Path    string // Pfad relativ zum Projektverzeichnis, wie im Archiv
+	RawPath []byte `json:",omitempty"` // Originalbytes, falls der Pfad kein gültiges UTF-8 ist
+	Size    int64
+	ModTime time.Time
+	SHA256  string
+	// Angaben des Filterprogramms (FilterCommand), z.B. Eigentümer oder Klassifizierung
+	Metadata map[string]string `json:",omitempty"`
+}
+
+func newManifestFile(name string) *ManifestFile {
+	file := &ManifestFile{Path: name}
+	// JSON kann nur UTF-8 darstellen, daher die Originalbytes zusätzlich sichern
+	if !utf8.ValidString(name) {
+		file.Path = strings.ToValidUTF8(name, "\uFFFD")
+		file.RawPath = []byte(name)
+	}
+	return file
+}
+
+// name liefert den exakten Pfad des Eintrags im Archiv
+func (f ManifestFile) name() string {
+	if f.RawPath != nil {
+		return string(f.RawPath)
+	}
+	return f.Path
+}
+
+// ManifestEntry ist ein Eintrag ohne Inhalt: Verzeichnis, Symlink, Hardlink oder Spezialdatei
+type ManifestEntry struct {
+	Path     string
+	RawPath  []byte `json:",omitempty"`
+	Type     string // "dir", "symlink", "hardlink" oder "special"
+	Linkname string `json:",omitempty"`
+}
+
+func newManifestEntry(header *tar.Header) *ManifestEntry {
+	name := cleanArchivePath(header.Name)
+	entry := &ManifestEntry{Path: name, Linkname: header.Linkname, Type: "special"}
+	if !utf8.ValidString(name) {
+		entry.Path = strings.ToValidUTF8(name, "\uFFFD")
+		entry.RawPath = []byte(name)
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		entry.Type = "dir"
+	case tar.TypeSymlink:
+		entry.Type = "symlink"
+	case tar.TypeLink:
+		entry.Type = "hardlink"
+	}
+	return entry
+}
+
+// name liefert den exakten Pfad des Eintrags im Archiv
+func (e ManifestEntry) name() string {
+	if e.RawPath != nil {
+		return string(e.RawPath)
+	}
+	return e.Path
+}
+
+type Manifest struct {
+	Project string
+	Archive string
+	Created time.Time
+	RunID   string `json:",omitempty"`
+	// Prüfsumme über Dateiliste und Dateiprüfsummen; gleich bei unverändertem Projekt
+	ContentHash string
+	Files       []ManifestFile
+	// Einträge ohne Inhalt, damit eine gestreamte Wiederherstellung alle Namen vorab kennt;
+	// fehlt bei Manifesten älterer Versionen (nil)
+	Entries []ManifestEntry
+	Skipped []SkippedFile `json:",omitempty"` // wegen SkipContent nicht gesicherte Dateien
+	// Hash-Baum: Prüfsumme je Verzeichnis, "" ist die Wurzel (siehe merkle.go)
+	Tree map[string]string `json:",omitempty"`
+}
+
+// manifestPath liefert den Pfad der Manifest-Datei, die neben dem Archiv liegt
+func manifestPath(archivePath string) string {
+	return strings.TrimSuffix(archivePath, archiveExtension(archivePath)) + ".manifest.json"
+}
+
+func newManifest(archivePath, projectName string, files []ManifestFile) *Manifest {
+	manifest := &Manifest{
+		Project: projectName,
+		Archive: filepath.Base(archivePath),
+		Created: time.Now().UTC(),
+		RunID:   runID,
+		Files:   files,
+	}
+	manifest.ContentHash = contentHash(manifest)
+	manifest.Tree = buildTree(files)
+	return manifest
+}
+
+// buildManifest liest das Archiv und berechnet die Prüfsummen aller enthaltenen Dateien
+func buildManifest(archivePath, projectName string) (*Manifest, error) {
+	var files []ManifestFile
+	entries := []ManifestEntry{}
+	err := walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			entries = append(entries, *newManifestEntry(header))
+			return nil
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, r); err != nil {
+			return err
+		}
+		file := newManifestFile(cleanArchivePath(header.Name))
+		file.Size = header.Size
+		file.ModTime = header.ModTime.UTC()
+		file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+		files = append(files, *file)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	manifest := newManifest(archivePath, projectName, files)
+	manifest.Entries = entries
+	return manifest, nil
+}
+
+// contentHash berechnet die Inhaltsprüfsumme; Zeitstempel fließen bewusst nicht ein
+func contentHash(manifest *Manifest) string {
+	lines := make([]string, 0, len(manifest.Files))
+	for _, file := range manifest.Files {
+		lines = append(lines, file.name()+"\x00"+file.SHA256)
+	}
+	sort.Strings(lines)
+
+	hash := sha256.New()
+	for _, line := range lines {
+		io.WriteString(hash, line+"\n")
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func saveManifest(archivePath string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath(archivePath), data, 0644)
+}
+
+func loadManifest(archivePath string) (*Manifest, error) {
+	data, err := os.ReadFile(manifestPath(archivePath))
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("fehler beim Lesen des Manifests: %v", err)
+	}
+	return &manifest, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Der Hash-Baum eines Manifests folgt den Verzeichnissen: Die Prüfsumme eines Verzeichnisses
+// ist SHA256 über die sortierten Zeilen seiner direkten Einträge,
+//
+//	"F\x00<name>\x00<SHA256 der Datei>\x00" bzw. "D\x00<name>\x00<Prüfsumme des Verzeichnisses>\x00"
+//
+// die Wurzel steht unter "" und zusätzlich im Katalog. Um einen Teilbaum zu prüfen, genügen
+// dessen Dateien aus dem Archiv und die Prüfsummen der Geschwister auf dem Weg zur Wurzel.
+
+// buildTree berechnet die Prüfsummen aller Verzeichnisse, in denen Dateien liegen
+func buildTree(files []ManifestFile) map[string]string {
+	lines := make(map[string][]string)
+	lines[""] = nil
+	for _, file := range files {
+		dir, base := splitTreePath(file.name())
+		lines[dir] = append(lines[dir], treeLine("F", base, file.SHA256))
+		for dir != "" {
+			if _, ok := lines[dir]; !ok {
+				lines[dir] = nil
+			}
+			dir, _ = splitTreePath(dir)
+		}
+	}
+	// Tiefste Verzeichnisse zuerst, damit die Eltern die Prüfsummen ihrer Kinder kennen
+	dirs := make([]string, 0, len(lines))
+	for dir := range lines {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return treeDepth(dirs[i]) > treeDepth(dirs[j]) })
+	tree := make(map[string]string, len(dirs))
+	for _, dir := range dirs {
+		tree[dir] = hashTreeLines(lines[dir])
+		if dir != "" {
+			parent, base := splitTreePath(dir)
+			lines[parent] = append(lines[parent], treeLine("D", base, tree[dir]))
+		}
+	}
+	return tree
+}
+
+// proveTree rechnet die Prüfsumme eines Teilbaums (Verzeichnis oder Datei) bis zur Wurzel
+// hoch; die Geschwister auf dem Weg stammen aus dem Manifest
+func proveTree(manifest *Manifest, name, sum string, isDir bool) string {
+	for name != "" {
+		parent, base := splitTreePath(name)
+		var lines []string
+		for _, file := range manifest.Files {
+			if dir, fileBase := splitTreePath(file.name()); dir == parent && (isDir || fileBase != base) {
+				lines = append(lines, treeLine("F", fileBase, file.SHA256))
+			}
+		}
+		for dir, dirSum := range manifest.Tree {
+			if grandparent, dirBase := splitTreePath(dir); dir != "" && grandparent == parent && (!isDir || dirBase != base) {
+				lines = append(lines, treeLine("D", dirBase, dirSum))
+			}
+		}
+		kind := "F"
+		if isDir {
+			kind = "D"
+		}
+		lines = append(lines, treeLine(kind, base, sum))
+		name, sum, isDir = parent, hashTreeLines(lines), true
+	}
+	return sum
+}
+
+// verifyTree prüft die Dateien unterhalb von prefix (actual: Name -> Prüfsumme aus dem
+// Archiv) gegen den Hash-Baum und diesen gegen die Wurzel root
+func verifyTree(manifest *Manifest, prefix string, actual map[string]string, root string) error {
+	if manifest.Tree == nil {
+		return fmt.Errorf("manifest ohne Hash-Baum (Backup einer älteren Version), nur eine vollständige Prüfung ist möglich")
+	}
+	var expected []ManifestFile
+	for _, file := range manifest.Files {
+		if underTreePrefix(file.name(), prefix) {
+			expected = append(expected, file)
+		}
+	}
+	if len(expected) == 0 {
+		return fmt.Errorf("%q enthält im Manifest keine Dateien", prefix)
+	}
+	var problems []string
+	for _, file := range expected {
+		sum, ok := actual[file.name()]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%q fehlt im Archiv", file.name()))
+		case sum != file.SHA256:
+			problems = append(problems, fmt.Sprintf("%q: Prüfsumme weicht ab", file.name()))
+		}
+		delete(actual, file.name())
+	}
+	for name := range actual {
+		problems = append(problems, fmt.Sprintf("%q steht nicht im Manifest", name))
+	}
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+
+	// Die Dateien stimmen mit dem Manifest überein; bleibt zu zeigen, dass das Manifest
+	// zu der Wurzel gehört, die beim Backup festgehalten wurde
+	var sum string
+	isDir := true
+	if len(expected) == 1 && expected[0].name() == prefix {
+		sum, isDir = expected[0].SHA256, false
+	} else {
+		sum = buildTree(expected)[prefix]
+	}
+	if proved := proveTree(manifest, prefix, sum, isDir); proved != root {
+		return fmt.Errorf("hash-Baum führt nicht zur Wurzel %s (%s), das Manifest wurde verändert", shortSum(root), shortSum(proved))
+	}
+	return nil
+}
+
+func underTreePrefix(name, prefix string) bool {
+	return prefix == "" || name == prefix || strings.HasPrefix(name, prefix+"/")
+}
+
+func splitTreePath(name string) (dir, base string) {
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return "", name
+}
+
+func treeDepth(dir string) int {
+	if dir == "" {
+		return 0
+	}
+	return strings.Count(dir, "/") + 1
+}
+
+func treeLine(kind, name, sum string) string {
+	return kind + "\x00" + name + "\x00" + sum + "\x00"
+}
+
+func hashTreeLines(lines []string) string {
+	sort.Strings(lines)
+	hash := sha256.New()
+	for _, line := range lines {
+		hash.Write([]byte(line))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func shortSum(sum string) string {
+	if len(sum) > 16 {
+		return sum[:16]
+	}
+	return sum
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func testTreeManifest() *Manifest {
+	files := []ManifestFile{
+		{Path: "README.md", SHA256: strings.Repeat("1", 64)},
+		{Path: "src/main.go", SHA256: strings.Repeat("2", 64)},
+		{Path: "src/util/util.go", SHA256: strings.Repeat("3", 64)},
+		{Path: "docs/index.md", SHA256: strings.Repeat("4", 64)},
+	}
+	return &Manifest{Files: files, Tree: buildTree(files)}
+}
+
+func TestProveTreeSubtree(t *testing.T) {
+	manifest := testTreeManifest()
+	root := manifest.Tree[""]
+
+	if proved := proveTree(manifest, "src", manifest.Tree["src"], true); proved != root {
+		t.Errorf("Teilbaum src führt zu %s statt zur Wurzel %s", shortSum(proved), shortSum(root))
+	}
+	if proved := proveTree(manifest, "src/util/util.go", strings.Repeat("3", 64), false); proved != root {
+		t.Errorf("Datei führt zu %s statt zur Wurzel %s", shortSum(proved), shortSum(root))
+	}
+	actual := map[string]string{
+		"src/main.go":      strings.Repeat("2", 64),
+		"src/util/util.go": strings.Repeat("3", 64),
+	}
+	if err := verifyTree(manifest, "src", actual, root); err != nil {
+		t.Errorf("unveränderter Teilbaum nicht bestätigt: %v", err)
+	}
+}
+
+func TestVerifyTreeDetectsTamperedSibling(t *testing.T) {
+	actual := func() map[string]string {
+		return map[string]string{
+			"src/main.go":      strings.Repeat("2", 64),
+			"src/util/util.go": strings.Repeat("3", 64),
+		}
+	}
+
+	// Prüfsumme eines Geschwisterverzeichnisses im Manifest verändert
+	manifest := testTreeManifest()
+	root := manifest.Tree[""]
+	manifest.Tree["docs"] = strings.Repeat("f", 64)
+	if err := verifyTree(manifest, "src", actual(), root); err == nil {
+		t.Error("veränderte Prüfsumme von docs nicht erkannt")
+	}
+
+	// Prüfsumme einer Geschwisterdatei im Manifest verändert
+	manifest = testTreeManifest()
+	manifest.Files[0].SHA256 = strings.Repeat("f", 64)
+	if err := verifyTree(manifest, "src", actual(), root); err == nil {
+		t.Error("veränderte Prüfsumme von README.md nicht erkannt")
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	toolVersion = "2.0.0"
+
+	// Version 1: Archive des externen tar ohne Metadaten-Eintrag
+	// Version 2: internes Archiv mit .backup-meta.json als erstem Eintrag; neuere Archive
+	// enthalten am Ende zusätzlich .backup-restore/, ältere Versionen lesen sie trotzdem
+	archiveFormatVersion = 2
+
+	metaEntryName = ".backup-meta.json"
+)
+
+type ArchiveMeta struct {
+	FormatVersion int
+	ToolVersion   string
+	Created       time.Time
+	Project       string
+	SourceDir     string
+	Host          string
+	Git           *GitInfo `json:",omitempty"`
+}
+
+func newArchiveMeta(project, sourceDir string) *ArchiveMeta {
+	host, _ := os.Hostname()
+	return &ArchiveMeta{
+		FormatVersion: archiveFormatVersion,
+		ToolVersion:   toolVersion,
+		Created:       time.Now().UTC(),
+		Project:       project,
+		SourceDir:     sourceDir,
+		Host:          host,
+	}
+}
+
+func writeArchiveMeta(tw entryWriter, meta *ArchiveMeta) error {
+	data, err := json.MarshalIndent(meta, "", "    ")
+	if err != nil {
+		return err
+	}
+	header := &tar.Header{
+		Name:     metaEntryName,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  meta.Created,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err = tw.Write(data)
+	return err
+}
+
+// readArchiveMeta liest den Metadaten-Eintrag; ältere Archive ohne Eintrag gelten als Version 1
+func readArchiveMeta(archivePath string) (*ArchiveMeta, error) {
+	f, tr, err := openArchive(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	header, err := tr.Next()
+	if err == io.EOF {
+		return &ArchiveMeta{FormatVersion: 1}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cleanArchivePath(header.Name) != metaEntryName {
+		return &ArchiveMeta{FormatVersion: 1}, nil
+	}
+
+	var meta ArchiveMeta
+	if err := json.NewDecoder(tr).Decode(&meta); err != nil {
+		return nil, fmt.Errorf("ungültige Archiv-Metadaten: %v", err)
+	}
+	return &meta, nil
+}
+
+// checkArchiveFormat stellt sicher, dass dieses Programm das Archiv verarbeiten kann
+func checkArchiveFormat(archivePath string) (*ArchiveMeta, error) {
+	meta, err := readArchiveMeta(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	if meta.FormatVersion > archiveFormatVersion {
+		return nil, fmt.Errorf("%s wurde mit Formatversion %d (backup-tool %s) erstellt, unterstützt wird bis Version %d",
+			archivePath, meta.FormatVersion, meta.ToolVersion, archiveFormatVersion)
+	}
+	return meta, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runMigrateLayout verschiebt vorhandene Backups zwischen den Layouts "flat" und
+// "project" und teilt bzw. vereinigt dabei Kataloge und state.json
+func runMigrateLayout(args []string) error {
+	flags := flag.NewFlagSet("migrate-layout", flag.ExitOnError)
+	to := flags.String("to", "project", "Ziel-Layout: project oder flat")
+	dryRun := flags.Bool("dry-run", false, "nur anzeigen, was verschoben würde")
+	flags.Parse(args)
+
+	config, _, _, err := loadProject()
+	if err != nil {
+		return err
+	}
+	root := config.backupRoot
+
+	var moved int
+	switch *to {
+	case "project":
+		moved, err = migrateToProjectLayout(root, *dryRun)
+	case "flat":
+		moved, err = migrateToFlatLayout(root, *dryRun)
+	default:
+		return fmt.Errorf("ungültiges Layout %q (möglich: flat, project)", *to)
+	}
+	if err != nil {
+		return err
+	}
+	if *dryRun {
+		fmt.Printf("%d Dateien würden verschoben\n", moved)
+		return nil
+	}
+	fmt.Printf("✓ %d Dateien nach Layout %q verschoben\n", moved, *to)
+	if config.Layout != *to && !(config.Layout == "" && *to == "flat") {
+		fmt.Printf("Hinweis: \"Layout\": %q in config.json der Projekte setzen\n", *to)
+	}
+	return nil
+}
+
+// backupFileProject liefert das Projekt einer Archiv-, Manifest- oder Inventurdatei
+func backupFileProject(name string) string {
+	for _, marker := range []string{"_backup_", "_inventory_"} {
+		if i := strings.LastIndex(name, marker); i > 0 {
+			if archiveExtension(name) != "" || strings.HasSuffix(name, ".manifest.json") {
+				return name[:i]
+			}
+		}
+	}
+	return ""
+}
+
+func migrateToProjectLayout(root string, dryRun bool) (int, error) {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for _, entry := range entries {
+		project := backupFileProject(entry.Name())
+		if entry.IsDir() || project == "" {
+			continue
+		}
+		target := filepath.Join(root, project, entry.Name())
+		fmt.Printf("%s -> %s\n", entry.Name(), filepath.Join(project, entry.Name()))
+		if dryRun {
+			moved++
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return moved, err
+		}
+		if err := moveBackupFile(filepath.Join(root, entry.Name()), target); err != nil {
+			return moved, err
+		}
+		moved++
+	}
+	if dryRun {
+		return moved, nil
+	}
+
+	// Katalog und Status auf die Projektverzeichnisse aufteilen
+	catalog, err := loadCatalog(root)
+	if err != nil {
+		return moved, err
+	}
+	byProject := make(map[string][]CatalogEntry)
+	for _, entry := range catalog.Backups {
+		byProject[entry.Project] = append(byProject[entry.Project], entry)
+	}
+	for project, projectEntries := range byProject {
+		dir := filepath.Join(root, project)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return moved, err
+		}
+		err := updateCatalog(dir, func(c *Catalog) {
+			for _, entry := range projectEntries {
+				c.add(entry)
+			}
+		})
+		if err != nil {
+			return moved, err
+		}
+	}
+	state, err := loadState(root)
+	if err != nil {
+		return moved, err
+	}
+	for project, run := range state.Projects {
+		if err := os.MkdirAll(filepath.Join(root, project), 0755); err != nil {
+			return moved, err
+		}
+		if err := saveRunState(filepath.Join(root, project), project, run); err != nil {
+			return moved, err
+		}
+	}
+	removeMigrated(root)
+	return moved, nil
+}
+
+func migrateToFlatLayout(root string, dryRun bool) (int, error) {
+	dirs, err := os.ReadDir(root)
+	if err != nil {
+		return 0, err
+	}
+	moved := 0
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		projectDir := filepath.Join(root, dir.Name())
+		entries, err := os.ReadDir(projectDir)
+		if err != nil {
+			return moved, err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || backupFileProject(entry.Name()) == "" {
+				continue
+			}
+			fmt.Printf("%s -> %s\n", filepath.Join(dir.Name(), entry.Name()), entry.Name())
+			if dryRun {
+				moved++
+				continue
+			}
+			if err := moveBackupFile(filepath.Join(projectDir, entry.Name()), filepath.Join(root, entry.Name())); err != nil {
+				return moved, err
+			}
+			moved++
+		}
+		if dryRun {
+			continue
+		}
+
+		catalog, err := loadCatalog(projectDir)
+		if err != nil {
+			return moved, err
+		}
+		err = updateCatalog(root, func(c *Catalog) {
+			for _, entry := range catalog.Backups {
+				c.add(entry)
+			}
+		})
+		if err != nil {
+			return moved, err
+		}
+		state, err := loadState(projectDir)
+		if err != nil {
+			return moved, err
+		}
+		for project, run := range state.Projects {
+			if err := saveRunState(root, project, run); err != nil {
+				return moved, err
+			}
+		}
+		removeMigrated(projectDir)
+		// Nur leere Verzeichnisse entfernen; ein Audit-Log bleibt erhalten
+		os.Remove(projectDir)
+	}
+	return moved, nil
+}
+
+// moveBackupFile verschiebt eine Datei, ohne ein vorhandenes Ziel zu überschreiben
+func moveBackupFile(source, target string) error {
+	if _, err := os.Lstat(target); err == nil {
+		return fmt.Errorf("%s existiert bereits", target)
+	}
+	return moveFile(source, target)
+}
+
+// removeMigrated entfernt Katalog und Status, nachdem ihr Inhalt übernommen wurde
+func removeMigrated(dir string) {
+	for _, name := range []string{catalogFileName, stateFileName} {
+		os.Remove(filepath.Join(dir, name))
+		os.Remove(filepath.Join(dir, name+".lock"))
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+import "syscall"
+
+// mknod legt eine Gerätedatei an; dev wird wie von makedev in macOS kodiert
+func mknod(path string, mode uint32, major, minor int64) error {
+	return syscall.Mknod(path, mode, int(major<<24|minor&0xffffff))
+}
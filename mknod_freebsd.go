@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// mknod legt eine Gerätedatei an; dev wird wie von makedev in FreeBSD 12 kodiert
+func mknod(path string, mode uint32, major, minor int64) error {
+	dev := uint64((major&0xffffff00)<<32 | (major&0xff)<<8 | (minor&0xff00)<<24 | minor&0xffff00ff)
+	return syscall.Mknod(path, mode, dev)
+}
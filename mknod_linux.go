@@ -0,0 +1,9 @@
+package main
+
+import "syscall"
+
+// mknod legt eine Gerätedatei an; dev in der Kodierung, die der Kernel erwartet
+func mknod(path string, mode uint32, major, minor int64) error {
+	dev := int((major << 8) | (minor & 0xff) | ((minor &^ 0xff) << 12))
+	return syscall.Mknod(path, mode, dev)
+}
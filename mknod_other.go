@@ -0,0 +1,10 @@
+//go:build !linux && !freebsd && !darwin
+
+package main
+
+import "fmt"
+
+// Die Kodierung von Major- und Minor-Nummer ist je System verschieden; hier ist sie unbekannt
+func mknod(path string, mode uint32, major, minor int64) error {
+	return fmt.Errorf("gerätedateien werden auf diesem System nicht unterstützt")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// MQTTConfig veröffentlicht den Zustand jedes Projekts als JSON unter Topic/<projekt>,
+// z.B. für Dashboards in Home Assistant. Die Nachrichten werden mit retain gesendet,
+// damit neue Abonnenten sofort den letzten Stand sehen.
+type MQTTConfig struct {
+	Broker   string // tcp://host:1883 oder mqtts://host:8883
+	Topic    string // Standard: backup-tool/<hostname>
+	QoS      int    // 0 oder 1; QoS 2 wird nicht unterstützt
+	Username string
+	Password string   // nur zusammen mit Username
+	Events   []string // Standard: alle Anlässe
+}
+
+// mqttStatus ist der Inhalt einer Zustandsnachricht
+type mqttStatus struct {
+	Project         string    `json:"project"`
+	Status          string    `json:"status"`
+	Event           string    `json:"event"`
+	Archive         string    `json:"archive,omitempty"`
+	Size            int64     `json:"size"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	Error           string    `json:"error,omitempty"`
+	Time            time.Time `json:"time"`
+}
+
+// publishMQTT sendet je betroffenem Projekt eine Zustandsnachricht
+func publishMQTT(config MQTTConfig, message notification) error {
+	runs := []runData{message.Data}
+	if results, ok := message.Payload.([]projectResult); ok {
+		runs = runs[:0]
+		for _, r := range results {
+			data := newRunData(r.Project, r.Archive, r.Size, r.Duration, r.status())
+			data.Error = r.Error
+			runs = append(runs, data)
+		}
+	}
+	topic := config.Topic
+	if topic == "" {
+		host, _ := os.Hostname()
+		topic = "backup-tool/" + host
+	}
+
+	client, err := dialMQTT(config)
+	if err != nil {
+		return err
+	}
+	defer client.close()
+	for _, run := range runs {
+		if run.Project == "" {
+			continue
+		}
+		payload, _ := json.Marshal(mqttStatus{
+			Project:         run.Project,
+			Status:          run.Status,
+			Event:           message.Event,
+			Archive:         run.ArchivePath,
+			Size:            run.Size,
+			DurationSeconds: run.Duration.Seconds(),
+			Error:           run.Error,
+			Time:            time.Now().UTC(),
+		})
+		if err := client.publish(strings.TrimSuffix(topic, "/")+"/"+run.Project, payload, config.QoS); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mqttClient ist ein minimaler MQTT-3.1.1-Client, der nur veröffentlichen kann
+type mqttClient struct {
+	conn     net.Conn
+	r        *bufio.Reader
+	packetID uint16
+}
+
+func dialMQTT(config MQTTConfig) (*mqttClient, error) {
+	u, err := url.Parse(config.Broker)
+	if err != nil {
+		return nil, fmt.Errorf("ungültiger Broker %q: %v", config.Broker, err)
+	}
+	// MQTT 3.1.1 erlaubt ein Passwort nur zusammen mit einem Benutzernamen
+	if config.Password != "" && config.Username == "" {
+		return nil, fmt.Errorf("MQTT-Passwort ohne Username")
+	}
+	if config.QoS < 0 || config.QoS > 1 {
+		return nil, fmt.Errorf("MQTT-QoS %d wird nicht unterstützt (0 oder 1)", config.QoS)
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	switch u.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", hostWithPort(u, "1883"))
+	case "ssl", "tls", "mqtts":
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithPort(u, "8883"), &tls.Config{ServerName: u.Hostname()})
+	default:
+		return nil, fmt.Errorf("ungültiger Broker %q (tcp://host:1883 oder mqtts://host:8883)", config.Broker)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	client := &mqttClient{conn: conn, r: bufio.NewReader(conn)}
+
+	host, _ := os.Hostname()
+	clientID := fmt.Sprintf("backup-tool-%s-%d", host, os.Getpid())
+	var flags byte = 0x02 // clean session
+	payload := mqttString(clientID)
+	if config.Username != "" {
+		flags |= 0x80
+		payload = append(payload, mqttString(config.Username)...)
+	}
+	if config.Password != "" {
+		flags |= 0x40
+		payload = append(payload, mqttString(config.Password)...)
+	}
+	variable := append(mqttString("MQTT"), 4, flags, 0, 60)
+	if err := client.write(0x10, append(variable, payload...)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	packetType, body, err := client.read()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("keine Antwort vom Broker: %v", err)
+	}
+	if packetType != 0x20 || len(body) < 2 {
+		conn.Close()
+		return nil, fmt.Errorf("unerwartete Antwort vom Broker")
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("verbindung abgelehnt (Code %d, z.B. falsche Zugangsdaten)", body[1])
+	}
+	return client, nil
+}
+
+func hostWithPort(u *url.URL, port string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+func (c *mqttClient) publish(topic string, payload []byte, qos int) error {
+	header := byte(0x30 | 0x01) // PUBLISH mit retain
+	body := mqttString(topic)
+	if qos == 1 {
+		header |= 0x02
+		c.packetID++
+		body = binary.BigEndian.AppendUint16(body, c.packetID)
+	}
+	if err := c.write(header, append(body, payload...)); err != nil {
+		return err
+	}
+	if qos == 0 {
+		return nil
+	}
+	packetType, ack, err := c.read()
+	if err != nil {
+		return fmt.Errorf("keine Bestätigung vom Broker: %v", err)
+	}
+	if packetType != 0x40 || len(ack) < 2 || binary.BigEndian.Uint16(ack) != c.packetID {
+		return fmt.Errorf("unerwartete Antwort vom Broker")
+	}
+	return nil
+}
+
+func (c *mqttClient) close() {
+	c.write(0xE0, nil)
+	c.conn.Close()
+}
+
+func (c *mqttClient) write(header byte, body []byte) error {
+	packet := []byte{header}
+	// Restlänge als variable Länge mit 7 Bit je Byte
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	_, err := c.conn.Write(append(packet, body...))
+	return err
+}
+
+func (c *mqttClient) read() (byte, []byte, error) {
+	header, err := c.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; i < 4; i++ {
+		b, err := c.r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7f) * multiplier
+		multiplier *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return 0, nil, err
+	}
+	return header & 0xf0, body, nil
+}
+
+func mqttString(s string) []byte {
+	return append(binary.BigEndian.AppendUint16(nil, uint16(len(s))), s...)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// projectResult ist das Ergebnis der Sicherung eines Projekts in einem Mehrprojekt-Lauf
+type projectResult struct {
+	Dir      string
+	Project  string
+	Archive  string `json:",omitempty"`
+	Err      error  `json:"-"`
+	Error    string `json:",omitempty"` // letzte Meldung eines fehlgeschlagenen Backups
+	Output   string `json:"-"`          // Meldungen des Backups, werden bei Fehlern ausgegeben
+	Duration time.Duration
+	Size     int64
+	Files    int
+	Warnings []string `json:",omitempty"`
+}
+
+// runAll sichert mehrere Projekte parallel. Die Projekte stammen aus Sources in
+// config.json oder mit --recursive aus den Unterverzeichnissen eines Ordners. Jedes
+// Projekt wird von einem eigenen Prozess gesichert, damit es seine config.json,
+// seinen Status und seine Logs unabhängig von den anderen behält.
+func runAll(args []string) error {
+	flags := flag.NewFlagSet("all", flag.ExitOnError)
+	recursive := flags.String("recursive", "", "alle Unterverzeichnisse dieses Ordners als Projekte sichern")
+	jobs := flags.Int("jobs", 0, "Anzahl gleichzeitiger Backups (Standard: ProjectWorkers aus config.json oder Hälfte der CPUs)")
+	profile := flags.String("profile", "", "Profil für alle Projekte")
+	tag := flags.String("tag", "", "Markierung für alle Backups")
+	scheduled := flags.Bool("scheduled", false, "geplanter Lauf (Timer, cron): bei schwachem Akku oder getakteter Verbindung auslassen")
+	flags.Parse(args)
+
+	config, _, _, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if *scheduled {
+		if reason := deferralReason(config); reason != "" {
+			logMessage(LogWarning, "Geplante Backups zurückgestellt: %s", reason)
+			return nil
+		}
+	}
+	var dirs []string
+	if *recursive != "" {
+		dirs, err = projectDirs(*recursive, config.backupRoot)
+	} else {
+		dirs, err = sourceDirs(config.Sources)
+	}
+	if err != nil {
+		return err
+	}
+	if len(dirs) == 0 {
+		return fmt.Errorf("keine Projekte gefunden (Sources in config.json oder --recursive angeben)")
+	}
+
+	workers := *jobs
+	if workers <= 0 {
+		workers = config.ProjectWorkers
+	}
+	if workers <= 0 {
+		workers = (runtime.NumCPU() + 1) / 2
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("fehler beim Ermitteln des Programmpfads: %v", err)
+	}
+	var backupArgs []string
+	if *profile != "" {
+		backupArgs = append(backupArgs, "--profile", *profile)
+	}
+	if *tag != "" {
+		backupArgs = append(backupArgs, "--tag", *tag)
+	}
+	if *scheduled {
+		backupArgs = append(backupArgs, "--scheduled")
+	}
+	if ignoreUnknownConfig {
+		backupArgs = append(backupArgs, "--ignore-unknown-config")
+	}
+
+	logMessage(LogInfo, "Sichere %d Projekte mit %d parallelen Backups", len(dirs), workers)
+	start := time.Now()
+	results := make([]projectResult, len(dirs))
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = backupProject(executable, dirs[i], backupArgs)
+				logMessage(LogInfo, "%s: %s", results[i].Project, results[i].status())
+			}
+		}()
+	}
+	for i := range dirs {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	duration := time.Since(start)
+	failed := printSummary(results, duration)
+	if config.Notify.configured() {
+		subject, status := fmt.Sprintf("Backup: %d Projekte gesichert", len(results)), "ok"
+		if failed > 0 {
+			subject = fmt.Sprintf("Backup: %d von %d Projekten fehlgeschlagen", failed, len(results))
+			status = "fehlgeschlagen"
+		}
+		var names []string
+		var size int64
+		for _, r := range results {
+			names = append(names, r.Project)
+			size += r.Size
+		}
+		err := notify(config.Notify, notification{
+			Subject: subject,
+			Text:    summaryTable(results, duration),
+			Failed:  failed > 0,
+			Event:   "summary",
+			Payload: results,
+			Data:    newRunData(strings.Join(names, ", "), "", size, duration, status),
+		})
+		if err != nil {
+			logMessage(LogWarning, "Bericht konnte nicht verschickt werden: %v", err)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d von %d Backups fehlgeschlagen", failed, len(results))
+	}
+	return nil
+}
+
+// backupProject startet ein Backup im Projektverzeichnis und sammelt dessen Ausgabe
+func backupProject(executable, dir string, backupArgs []string) projectResult {
+	result := projectResult{Dir: dir, Project: filepath.Base(dir)}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(executable, backupArgs...)
+	cmd.Dir = dir
+	// Statt einzelner Nachrichten je Projekt verschickt "all" eine Zusammenfassung
+	cmd.Env = append(os.Environ(), "BACKUP_NO_NOTIFY=1")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	result.Err = cmd.Run()
+	result.Duration = time.Since(start)
+	result.Archive = strings.TrimSpace(stdout.String())
+	result.Output = stderr.String()
+	if result.Err != nil {
+		lines := strings.Split(strings.TrimSpace(result.Output), "\n")
+		result.Error = lines[len(lines)-1]
+		return result
+	}
+
+	// Details aus Archiv, Manifest und state.json des Projekts
+	if project := backupFileProject(filepath.Base(result.Archive)); project != "" {
+		result.Project = project
+	}
+	if info, err := os.Stat(result.Archive); err == nil {
+		result.Size = info.Size()
+	}
+	if manifest, err := loadManifest(result.Archive); err == nil {
+		result.Files = len(manifest.Files)
+	}
+	if state, err := loadState(filepath.Dir(result.Archive)); err == nil {
+		result.Warnings = state.Projects[result.Project].Warnings
+	}
+	return result
+}
+
+func (r projectResult) status() string {
+	if r.Err != nil {
+		return "FEHLGESCHLAGEN"
+	}
+	return "ok"
+}
+
+// printSummary gibt je Projekt eine Zeile aus und liefert die Anzahl der Fehlschläge
+func printSummary(results []projectResult, total time.Duration) int {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Project < results[j].Project
+	})
+	fmt.Fprint(os.Stderr, "\n"+summaryTable(results, total))
+
+	failed := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failed++
+			fmt.Fprintf(os.Stderr, "\n--- %s (%s) ---\n%s", r.Project, r.Dir, r.Output)
+		}
+	}
+	// Auf stdout nur die erstellten Archive, wie beim einfachen Backup
+	for _, r := range results {
+		if r.Err == nil && r.Archive != "" {
+			fmt.Println(r.Archive)
+		}
+	}
+	return failed
+}
+
+// summaryTable ist der Bericht eines Mehrprojekt-Laufs als Text
+func summaryTable(results []projectResult, total time.Duration) string {
+	var b strings.Builder
+	failed := 0
+	var size int64
+	fmt.Fprintf(&b, "%-30s %-15s %10s %8s %8s %9s\n", "Projekt", "Status", "Größe", "Dauer", "Dateien", "Warnungen")
+	for _, r := range results {
+		fmt.Fprintf(&b, "%-30s %-15s %10s %8v %8d %9d\n", r.Project, r.status(), formatSize(r.Size),
+			r.Duration.Round(time.Second), r.Files, len(r.Warnings))
+		if r.Err != nil {
+			failed++
+		}
+		size += r.Size
+	}
+	fmt.Fprintf(&b, "\n%d Projekte in %v, %s, %d fehlgeschlagen\n", len(results), total.Round(time.Second), formatSize(size), failed)
+	for _, r := range results {
+		switch {
+		case r.Err != nil:
+			fmt.Fprintf(&b, "\n%s: %s\n", r.Project, r.Error)
+		case len(r.Warnings) > 0:
+			fmt.Fprintf(&b, "\n%s:\n", r.Project)
+			for _, warning := range r.Warnings {
+				fmt.Fprintf(&b, "  - %s\n", warning)
+			}
+		}
+	}
+	return b.String()
+}
+
+// expandHome ersetzt ein führendes ~/ durch das Home-Verzeichnis
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// sourceDirs löst die Einträge von Sources auf; Muster wie ~/code/* sind erlaubt
+func sourceDirs(sources []string) ([]string, error) {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, source := range sources {
+		source = expandHome(source)
+		matches, err := filepath.Glob(source)
+		if err != nil {
+			return nil, fmt.Errorf("ungültiges Muster in Sources: %s", source)
+		}
+		if len(matches) == 0 {
+			logMessage(LogWarning, "Quelle %s nicht gefunden", source)
+		}
+		for _, match := range matches {
+			abs, err := filepath.Abs(match)
+			if err != nil {
+				return nil, err
+			}
+			if info, err := os.Stat(abs); err != nil || !info.IsDir() || seen[abs] {
+				continue
+			}
+			seen[abs] = true
+			dirs = append(dirs, abs)
+		}
+	}
+	return dirs, nil
+}
+
+// projectDirs liefert die Unterverzeichnisse von root ohne versteckte Ordner und ohne
+// Backup-Verzeichnisse; root/Backup ist das Standardziel der Projekte darin
+func projectDirs(root, backupDir string) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var dirs []string
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		dir := filepath.Join(root, entry.Name())
+		if dir == filepath.Clean(backupDir) || dir == filepath.Join(root, "Backup") {
+			continue
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
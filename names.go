@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unicode/utf8"
+)
+
+// Ab dieser Länge scheitern viele Dateisysteme und ältere tar-Implementierungen
+const maxPortablePathLength = 255
+
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// nameIssue beschreibt, warum ein Archivname auf anderen Systemen Probleme machen kann
+func nameIssue(name string) string {
+	switch {
+	case !utf8.ValidString(name):
+		return "kein gültiges UTF-8"
+	case strings.ContainsAny(name, "\n\r"):
+		return "enthält Zeilenumbrüche"
+	case len(name) > maxPortablePathLength:
+		return fmt.Sprintf("Pfad länger als %d Zeichen", maxPortablePathLength)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if isWindowsUnsafe(part) {
+			return "unter Windows nicht zulässig"
+		}
+	}
+	return ""
+}
+
+func isWindowsUnsafe(part string) bool {
+	if part == "" {
+		return false
+	}
+	stem := strings.ToUpper(strings.SplitN(part, ".", 2)[0])
+	return windowsReservedNames[stem] ||
+		strings.ContainsAny(part, `<>:"\|?*`) ||
+		strings.HasSuffix(part, ".") || strings.HasSuffix(part, " ")
+}
+
+// sanitizePath ersetzt problematische Zeichen und reservierte Namen in jeder Pfadkomponente
+func sanitizePath(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		part = strings.ToValidUTF8(part, "_")
+		part = strings.Map(func(r rune) rune {
+			if r < 0x20 || strings.ContainsRune(`<>:"\|?*`, r) {
+				return '_'
+			}
+			return r
+		}, part)
+		part = strings.TrimRight(part, ". ")
+		if part == "" && parts[i] != "" {
+			part = "_"
+		}
+		if windowsReservedNames[strings.ToUpper(strings.SplitN(part, ".", 2)[0])] {
+			part = "_" + part
+		}
+		parts[i] = part
+	}
+	return strings.Join(parts, "/")
+}
+
+// isNameError erkennt Fehler, die das Zieldateisystem wegen des Namens meldet
+func isNameError(err error) bool {
+	return errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.ENAMETOOLONG) ||
+		errors.Is(err, syscall.EILSEQ)
+}
+
+// caseInsensitiveDir prüft in einem temporären Unterverzeichnis, ob das Dateisystem unter
+// dir Groß- und Kleinschreibung gleich behandelt (üblich unter Windows und macOS). Das
+// Unterverzeichnis wird danach wieder entfernt.
+func caseInsensitiveDir(dir string) bool {
+	probe, err := os.MkdirTemp(existingParent(dir), ".backup-case-probe-")
+	if err != nil {
+		return false
+	}
+	defer os.RemoveAll(probe)
+	if err := os.WriteFile(filepath.Join(probe, "probe"), nil, 0600); err != nil {
+		return false
+	}
+	_, err = os.Lstat(filepath.Join(probe, "PROBE"))
+	return err == nil
+}
+
+// resolveCaseConflicts legt für Einträge, die sich nur in der Groß-/Kleinschreibung
+// unterscheiden, den Zielnamen fest: "rename" hängt " (2)" usw. an, "skip" lässt den
+// späteren Eintrag aus (Zielname ""), "overwrite" behält den Namen. Die Namen müssen in
+// Archivreihenfolge vorliegen, Verzeichnisse also vor ihrem Inhalt.
+func resolveCaseConflicts(names []string, mode string) (map[string]string, []string) {
+	final := make(map[string]string)
+	used := make(map[string]string) // kleingeschriebener Zielname -> Eintrag
+	var conflicts []string
+	var resolve func(name string) string
+	resolve = func(name string) string {
+		if target, ok := final[name]; ok {
+			return target
+		}
+		parent, base := "", name
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			parent, base = resolve(name[:i]), name[i+1:]
+			if parent == "" {
+				final[name] = ""
+				return ""
+			}
+		}
+		target := path.Join(parent, base)
+		if other, ok := used[strings.ToLower(target)]; ok {
+			switch mode {
+			case "skip":
+				conflicts = append(conflicts, fmt.Sprintf("%q: übersprungen, kollidiert mit %q", name, other))
+				target = ""
+			case "rename":
+				target = path.Join(parent, freeCaseName(parent, base, used))
+				conflicts = append(conflicts, fmt.Sprintf("%q -> %q (kollidiert mit %q)", name, target, other))
+			default:
+				conflicts = append(conflicts, fmt.Sprintf("%q: überschreibt %q", name, other))
+			}
+		}
+		if target != "" {
+			used[strings.ToLower(target)] = name
+		}
+		final[name] = target
+		return target
+	}
+	for _, name := range names {
+		resolve(name)
+	}
+	return final, conflicts
+}
+
+// freeCaseName liefert "name (2).ext", "name (3).ext" usw., je nachdem was noch frei ist
+func freeCaseName(parent, base string, used map[string]string) string {
+	ext := path.Ext(base)
+	if ext == base {
+		ext = ""
+	}
+	stem := strings.TrimSuffix(base, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		if _, taken := used[strings.ToLower(path.Join(parent, candidate))]; !taken {
+			return candidate
+		}
+	}
+}
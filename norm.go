@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// macOS liefert Dateinamen meist zerlegt (NFD: "a" + U+0308), Linux und Windows
+// zusammengesetzt (NFC: "ä"). Ohne einheitliche Form entstehen beim Wiederherstellen auf
+// dem jeweils anderen System scheinbar doppelte Dateien. Die Tabellen in normtables.go
+// decken alle kanonischen Zerlegungen ab, Hangul wird rechnerisch behandelt.
+
+var normalizationForms = []string{"nfc", "nfd"}
+
+// Hangul-Silben werden rechnerisch zerlegt und zusammengesetzt
+const (
+	hangulSBase  = 0xAC00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11A7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+var decompositions = func() map[rune][2]rune {
+	m := make(map[rune][2]rune, len(compositions)+len(nonComposingDecompositions))
+	for pair, composed := range compositions {
+		m[composed] = pair
+	}
+	for r, pair := range nonComposingDecompositions {
+		m[r] = pair
+	}
+	return m
+}()
+
+// normalizeName bringt name in die Form "nfc" oder "nfd"; bei "" bleibt name unverändert
+func normalizeName(name, form string) string {
+	if form == "" || !utf8.ValidString(name) || isASCII(name) {
+		return name
+	}
+	runes := decompose(name)
+	if form == "nfc" {
+		runes = compose(runes)
+	}
+	return string(runes)
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// decompose zerlegt alle Zeichen vollständig und sortiert Akzente kanonisch
+func decompose(s string) []rune {
+	var runes []rune
+	for _, r := range s {
+		runes = appendDecomposed(runes, r)
+	}
+	// Folgen von Akzenten stabil nach Kombinationsklasse sortieren
+	for i := 1; i < len(runes); i++ {
+		for j := i; j > 0; j-- {
+			a, b := combiningClasses[runes[j-1]], combiningClasses[runes[j]]
+			if a == 0 || b == 0 || a <= b {
+				break
+			}
+			runes[j-1], runes[j] = runes[j], runes[j-1]
+		}
+	}
+	return runes
+}
+
+func appendDecomposed(runes []rune, r rune) []rune {
+	if s := r - hangulSBase; s >= 0 && s < hangulSCount {
+		runes = append(runes, hangulLBase+s/hangulNCount, hangulVBase+(s%hangulNCount)/hangulTCount)
+		if t := s % hangulTCount; t != 0 {
+			runes = append(runes, hangulTBase+t)
+		}
+		return runes
+	}
+	if pair, ok := decompositions[r]; ok {
+		runes = appendDecomposed(runes, pair[0])
+		if pair[1] == 0 {
+			return runes
+		}
+		return appendDecomposed(runes, pair[1])
+	}
+	return append(runes, r)
+}
+
+// compose setzt zerlegte Zeichen wieder zusammen; ein Akzent wird nicht mit dem
+// Grundzeichen verbunden, wenn ein Akzent gleicher Klasse dazwischen steht
+func compose(runes []rune) []rune {
+	out := make([]rune, 0, len(runes))
+	starter, lastClass := -1, uint8(0)
+	for _, r := range runes {
+		class := combiningClasses[r]
+		if starter >= 0 && (len(out)-1 == starter || lastClass != 0 && lastClass < class) {
+			if composed, ok := composePair(out[starter], r); ok {
+				out[starter] = composed
+				continue
+			}
+		}
+		if class == 0 {
+			starter = len(out)
+		}
+		lastClass = class
+		out = append(out, r)
+	}
+	return out
+}
+
+func composePair(a, b rune) (rune, bool) {
+	if l, v := a-hangulLBase, b-hangulVBase; l >= 0 && l < hangulLCount && v >= 0 && v < hangulVCount {
+		return hangulSBase + (l*hangulVCount+v)*hangulTCount, true
+	}
+	if s, t := a-hangulSBase, b-hangulTBase; s >= 0 && s < hangulSCount && s%hangulTCount == 0 && t > 0 && t < hangulTCount {
+		return a + t, true
+	}
+	composed, ok := compositions[[2]rune{a, b}]
+	return composed, ok
+}
+
+// nameNormalizer normalisiert Pfade komponentenweise. Gibt es neben einem Eintrag schon
+// einen anderen mit der normalisierten Form seines Namens, bleibt der Name unverändert,
+// damit keiner der beiden den anderen überschreibt.
+type nameNormalizer struct {
+	form string
+	// exists meldet, ob es neben rel einen anderen Eintrag namens sibling gibt
+	exists    func(rel, sibling string) bool
+	names     map[string]string // ursprünglicher Pfad -> normalisierter Pfad
+	taken     map[string]bool
+	Conflicts []string
+}
+
+func newNameNormalizer(form string, exists func(rel, sibling string) bool) *nameNormalizer {
+	return &nameNormalizer{form: form, exists: exists, names: make(map[string]string), taken: make(map[string]bool)}
+}
+
+// name liefert den normalisierten Pfad für rel (mit "/" getrennt)
+func (n *nameNormalizer) name(rel string) string {
+	if n == nil || n.form == "" {
+		return rel
+	}
+	if name, ok := n.names[rel]; ok {
+		return name
+	}
+	dir, parent, base := "", "", rel
+	if i := strings.LastIndex(rel, "/"); i >= 0 {
+		dir, base = rel[:i], rel[i+1:]
+		parent = n.name(dir)
+	}
+	target := normalizeName(base, n.form)
+	if target != base {
+		sibling := path.Join(dir, target)
+		if n.taken[path.Join(parent, target)] || n.exists(rel, sibling) {
+			n.Conflicts = append(n.Conflicts, fmt.Sprintf("%+q: nicht nach %s normalisiert, %+q gibt es bereits",
+				rel, strings.ToUpper(n.form), sibling))
+			target = base
+		}
+	}
+	name := path.Join(parent, target)
+	n.names[rel] = name
+	n.taken[name] = true
+	return name
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestNormalizeNameRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		nfc, nfd string
+	}{
+		{"Müller.txt", "Mu\u0308ller.txt"},
+		{"がぎぐ_パ.txt", "か\u3099き\u3099く\u3099_ハ\u309A.txt"},
+		{"한글.md", "\u1112\u1161\u11AB\u1100\u1173\u11AF.md"},
+		{"Ελληνικά ΐ", "Ελληνικα\u0301 ι\u0308\u0301"},
+		{"йод", "и\u0306од"},
+		{"ṩ", "s\u0323\u0307"},
+		{"ক্ষো", "ক\u09CDষ\u09C7\u09BE"},
+		// Von NFC ausgenommen: bleibt zerlegt
+		{"\u0915\u093C", "\u0915\u093C"},
+	} {
+		if got := normalizeName(tc.nfd, "nfc"); got != tc.nfc {
+			t.Errorf("NFC von %+q = %+q, erwartet %+q", tc.nfd, got, tc.nfc)
+		}
+		if got := normalizeName(tc.nfc, "nfd"); got != tc.nfd {
+			t.Errorf("NFD von %+q = %+q, erwartet %+q", tc.nfc, got, tc.nfd)
+		}
+		if got := normalizeName(normalizeName(tc.nfc, "nfd"), "nfc"); got != tc.nfc {
+			t.Errorf("NFC(NFD(%+q)) = %+q", tc.nfc, got)
+		}
+	}
+}
+
+func TestNormalizeNameSingletonsAndOrder(t *testing.T) {
+	// Ångström-Zeichen und Ohm-Zeichen werden durch Å und Ω ersetzt
+	if got := normalizeName("\u212B\u2126", "nfc"); got != "ÅΩ" {
+		t.Errorf("Ersatzzeichen: %+q", got)
+	}
+	if got := normalizeName("\u0958", "nfc"); got != "\u0915\u093C" {
+		t.Errorf("Ausgenommene Zusammensetzung: %+q", got)
+	}
+	// Akzente werden kanonisch sortiert: Punkt unten (220) vor Punkt oben (230)
+	if got := normalizeName("s\u0307\u0323", "nfc"); got != "ṩ" {
+		t.Errorf("Reihenfolge: %+q", got)
+	}
+	if got := normalizeName("q\u0307\u0323", "nfd"); got != "q\u0323\u0307" {
+		t.Errorf("Reihenfolge ohne Zusammensetzung: %+q", got)
+	}
+}
+
+func TestNameNormalizerKeepsConflicts(t *testing.T) {
+	existing := map[string]bool{"docs/Mu\u0308ller.txt": true, "docs/Müller.txt": true}
+	names := newNameNormalizer("nfc", func(rel, sibling string) bool { return existing[sibling] })
+	if got := names.name("docs/Mu\u0308ller.txt"); got != "docs/Mu\u0308ller.txt" {
+		t.Errorf("Name trotz vorhandener NFC-Form geändert: %+q", got)
+	}
+	if len(names.Conflicts) != 1 {
+		t.Errorf("Konflikte: %q", names.Conflicts)
+	}
+	if got := names.name("Ba\u0308r/x"); got != "Bär/x" {
+		t.Errorf("Verzeichnisname nicht normalisiert: %+q", got)
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// NotifyConfig legt fest, wohin Berichte und Meldungen geschickt werden
+type NotifyConfig struct {
+	Webhook string // URL, an die der Bericht als JSON gesendet wird
+	Email   string // Empfänger, Versand über sendmail
+	// Eigener Body für den Webhook als Go-Template, z.B.
+	// {"text": {{json (printf "%s: %s" .Project .Status)}}}; leer = Standard-JSON
+	WebhookBody string
+	// Betreff der E-Mails als Go-Template, z.B. "[backup] {{.Project}} {{.Status}}"
+	EmailSubject string
+	// Anlässe für Nachrichten: "success" (einzelnes Backup erfolgreich), "failure"
+	// (Backup oder Prüfung fehlgeschlagen), "summary" (Bericht von "all"), "capacity"
+	// (Backup-Ziel bald voll); Standard: failure, summary und capacity
+	Events []string
+	// Text der Chat-Nachrichten je Anlass als Go-Template, z.B.
+	// {"failure": "Backup {{.Project}} fehlgeschlagen: {{.Error}}"}; Standard: Betreff und Text
+	Messages map[string]string
+	Slack    SlackConfig
+	Telegram TelegramConfig
+	Matrix   MatrixConfig
+	Ntfy     NtfyConfig
+	MQTT     MQTTConfig
+}
+
+// SlackConfig: entweder eine Incoming-Webhook-URL oder ein Bot-Token mit Kanal
+type SlackConfig struct {
+	WebhookURL string
+	Token      string
+	Channel    string
+	Events     []string // weicht von Notify.Events ab, falls gesetzt
+}
+
+// TelegramConfig: Token des Bots (von @BotFather) und ID des Chats
+type TelegramConfig struct {
+	Token  string
+	ChatID string
+	APIURL string   // eigener Bot-API-Server, Standard https://api.telegram.org
+	Events []string // weicht von Notify.Events ab, falls gesetzt
+}
+
+// MatrixConfig: Homeserver, Access-Token eines (Bot-)Kontos und Raum-ID wie !abc:example.org
+type MatrixConfig struct {
+	Homeserver  string // z.B. https://matrix.example.org
+	AccessToken string
+	RoomID      string
+	Events      []string // weicht von Notify.Events ab, falls gesetzt
+}
+
+// NtfyConfig: Push-Nachrichten über ntfy.sh oder einen eigenen ntfy-Server
+type NtfyConfig struct {
+	Server   string // Standard https://ntfy.sh
+	Topic    string
+	Priority string   // "min", "low", "default", "high", "max"/"urgent" oder 1-5
+	Token    string   // Access-Token für geschützte Topics
+	Events   []string // weicht von Notify.Events ab, falls gesetzt, z.B. ["failure"]
+}
+
+var defaultNotifyEvents = []string{"failure", "summary", "capacity"}
+
+// chatProvider ist ein Dienst, der nur einen Nachrichtentext erhält
+type chatProvider struct {
+	name   string
+	events []string
+	send   func(text string) error
+}
+
+// chatProviders liefert die eingerichteten Chat-Dienste
+func (n NotifyConfig) chatProviders() []chatProvider {
+	var providers []chatProvider
+	if n.Slack.WebhookURL != "" || n.Slack.Token != "" {
+		providers = append(providers, chatProvider{"slack", n.Slack.Events, n.Slack.send})
+	}
+	if n.Telegram.Token != "" {
+		providers = append(providers, chatProvider{"telegram", n.Telegram.Events, n.Telegram.send})
+	}
+	if n.Matrix.Homeserver != "" {
+		providers = append(providers, chatProvider{"matrix", n.Matrix.Events, n.Matrix.send})
+	}
+	if n.Ntfy.Topic != "" {
+		providers = append(providers, chatProvider{"ntfy", n.Ntfy.Events, n.Ntfy.send})
+	}
+	return providers
+}
+
+// notification ist eine Nachricht an alle eingerichteten Empfänger; Payload wird bei
+// Webhooks zusätzlich zu Betreff und Text mitgeschickt
+type notification struct {
+	Subject string
+	Text    string
+	Failed  bool
+	Event   string // "success", "failure", "summary" oder "capacity"
+	Payload interface{}
+	Data    runData // Angaben für WebhookBody, EmailSubject und Messages
+}
+
+func (n NotifyConfig) configured() bool {
+	return n.Webhook != "" || n.Email != "" || n.MQTT.Broker != "" || len(n.chatProviders()) > 0
+}
+
+// wants prüft, ob für den Anlass eine Nachricht verschickt werden soll
+func wants(events []string, event string) bool {
+	if len(events) == 0 {
+		events = defaultNotifyEvents
+	}
+	return containsString(events, event)
+}
+
+// notify verschickt die Nachricht an alle Empfänger und meldet Fehler gesammelt
+func notify(config NotifyConfig, message notification) error {
+	var errs []string
+	message.Data.Subject, message.Data.Text = message.Subject, message.Text
+	message.Data.Event = message.Event
+	for _, provider := range config.chatProviders() {
+		events := provider.events
+		if len(events) == 0 {
+			events = config.Events
+		}
+		if !wants(events, message.Event) {
+			continue
+		}
+		text := message.Subject + "\n\n" + message.Text
+		var err error
+		if tmpl := config.Messages[message.Event]; tmpl != "" {
+			text, err = renderTemplate(tmpl, message.Data)
+		}
+		if err == nil {
+			err = provider.send(text)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", provider.name, err))
+		}
+	}
+	if config.MQTT.Broker != "" && (len(config.MQTT.Events) == 0 || containsString(config.MQTT.Events, message.Event)) {
+		if err := publishMQTT(config.MQTT, message); err != nil {
+			errs = append(errs, fmt.Sprintf("mqtt: %v", err))
+		}
+	}
+	if !wants(config.Events, message.Event) {
+		return joinErrors(errs)
+	}
+	if config.Webhook != "" {
+		var err error
+		if config.WebhookBody == "" {
+			err = postWebhook(config.Webhook, message)
+		} else {
+			var body string
+			if body, err = renderTemplate(config.WebhookBody, message.Data); err == nil {
+				err = postJSON(config.Webhook, []byte(body), nil)
+			}
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("webhook: %v", err))
+		}
+	}
+	if config.Email != "" {
+		subject := message.Subject
+		var err error
+		if config.EmailSubject != "" {
+			subject, err = renderTemplate(config.EmailSubject, message.Data)
+		}
+		if err == nil {
+			err = sendMail(config.Email, subject, message.Text)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("e-mail: %v", err))
+		}
+	}
+	return joinErrors(errs)
+}
+
+func joinErrors(errs []string) error {
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+func postWebhook(url string, message notification) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"subject": message.Subject,
+		"text":    message.Text,
+		"failed":  message.Failed,
+		"data":    message.Payload,
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(url, body, nil)
+}
+
+// postJSON sendet body an url und wertet den Statuscode aus
+func postJSON(url string, body []byte, headers map[string]string) error {
+	return postJSONResult(url, body, headers, nil)
+}
+
+// postJSONResult wie postJSON; die Antwort wird zusätzlich nach result dekodiert
+func postJSONResult(url string, body []byte, headers map[string]string, result interface{}) error {
+	return sendJSON(http.MethodPost, url, body, headers, result)
+}
+
+func sendJSON(method, url string, body []byte, headers map[string]string, result interface{}) error {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("antwort %s", resp.Status)
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+// chatResponse ist die gemeinsame Form der Antworten von Slack und Telegram
+type chatResponse struct {
+	OK          bool   `json:"ok"`
+	Error       string `json:"error"`
+	Description string `json:"description"`
+}
+
+func (r chatResponse) err() error {
+	if r.OK {
+		return nil
+	}
+	return fmt.Errorf("abgelehnt: %s%s", r.Error, r.Description)
+}
+
+func (s SlackConfig) send(text string) error {
+	if s.WebhookURL != "" {
+		body, _ := json.Marshal(map[string]string{"text": text})
+		return postJSON(s.WebhookURL, body, nil)
+	}
+	body, _ := json.Marshal(map[string]string{"channel": s.Channel, "text": text})
+	var resp chatResponse
+	if err := postJSONResult("https://slack.com/api/chat.postMessage", body, map[string]string{"Authorization": "Bearer " + s.Token}, &resp); err != nil {
+		return err
+	}
+	return resp.err()
+}
+
+func (t TelegramConfig) send(text string) error {
+	api := t.APIURL
+	if api == "" {
+		api = "https://api.telegram.org"
+	}
+	body, _ := json.Marshal(map[string]string{"chat_id": t.ChatID, "text": text})
+	var resp chatResponse
+	if err := postJSONResult(strings.TrimSuffix(api, "/")+"/bot"+t.Token+"/sendMessage", body, nil, &resp); err != nil {
+		// Das Token steht in der URL und soll nicht im Log landen
+		return fmt.Errorf("%s", strings.ReplaceAll(err.Error(), t.Token, "***"))
+	}
+	return resp.err()
+}
+
+func sendMail(to, subject, text string) error {
+	cmd := exec.Command("sendmail", "-t")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("To: %s\nSubject: %s\nContent-Type: text/plain; charset=utf-8\n\n%s\n", to, subject, text))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sendmail: %v %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (m MatrixConfig) send(text string) error {
+	// Die Transaktions-ID verhindert doppelte Nachrichten, falls der Server sie doppelt erhält
+	txnID := fmt.Sprintf("backup-%s-%d", runID, time.Now().UnixNano())
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimSuffix(m.Homeserver, "/"), url.PathEscape(m.RoomID), txnID)
+	body, _ := json.Marshal(map[string]string{"msgtype": "m.text", "body": text})
+	return sendJSON(http.MethodPut, endpoint, body, map[string]string{"Authorization": "Bearer " + m.AccessToken}, nil)
+}
+
+var ntfyPriorities = map[string]int{"min": 1, "low": 2, "default": 3, "high": 4, "max": 5, "urgent": 5,
+	"1": 1, "2": 2, "3": 3, "4": 4, "5": 5}
+
+func (n NtfyConfig) send(text string) error {
+	server := n.Server
+	if server == "" {
+		server = "https://ntfy.sh"
+	}
+	// Die erste Zeile wird zum Titel der Push-Nachricht
+	title, message := "Backup", text
+	if first, rest, ok := strings.Cut(text, "\n"); ok {
+		title, message = first, strings.TrimSpace(rest)
+	}
+	payload := map[string]interface{}{"topic": n.Topic, "title": title, "message": message}
+	if priority, ok := ntfyPriorities[n.Priority]; ok {
+		payload["priority"] = priority
+	}
+	body, _ := json.Marshal(payload)
+	var headers map[string]string
+	if n.Token != "" {
+		headers = map[string]string{"Authorization": "Bearer " + n.Token}
+	}
+	return postJSON(strings.TrimSuffix(server, "/"), body, headers)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Ein laufendes Backup lässt sich mit "pause" sofort anhalten und mit "resume" später
+// fortsetzen, ohne den bisherigen Fortschritt zu verlieren. Die Befehle schicken SIGUSR1
+// bzw. SIGUSR2 an den Prozess aus state.json; angehalten lesen Worker und Schreiber
+// keine weiteren Dateien, das Kompressionsprogramm wartet auf Daten.
+
+type pauseGate struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	paused bool
+}
+
+var archivePause = newPauseGate()
+
+func newPauseGate() *pauseGate {
+	g := &pauseGate{}
+	g.cond = sync.NewCond(&g.mu)
+	return g
+}
+
+// wait blockiert, solange das Backup angehalten ist
+func (g *pauseGate) wait() {
+	g.mu.Lock()
+	for g.paused {
+		g.cond.Wait()
+	}
+	g.mu.Unlock()
+}
+
+// set hält an oder setzt fort und meldet, ob sich der Zustand geändert hat
+func (g *pauseGate) set(paused bool) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.paused == paused {
+		return false
+	}
+	g.paused = paused
+	g.cond.Broadcast()
+	return true
+}
+
+// handlePauseSignals hält das Backup bei SIGUSR1 an und setzt es bei SIGUSR2 fort
+func handlePauseSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range signals {
+			paused := sig == syscall.SIGUSR1
+			if !archivePause.set(paused) {
+				continue
+			}
+			if paused {
+				fmt.Fprintln(os.Stderr, colorize(colorYellow, `‖ Backup angehalten, fortsetzen mit "backup-tool resume"`))
+			} else {
+				fmt.Fprintln(os.Stderr, colorize(colorGreen, "▶ Backup wird fortgesetzt"))
+			}
+			setRunPaused(paused)
+		}
+	}()
+}
+
+func runPause(args []string) error {
+	flags := flag.NewFlagSet("pause", flag.ExitOnError)
+	flags.Parse(args)
+	return signalRunningBackup(syscall.SIGUSR1, "angehalten")
+}
+
+func runResume(args []string) error {
+	flags := flag.NewFlagSet("resume", flag.ExitOnError)
+	flags.Parse(args)
+	return signalRunningBackup(syscall.SIGUSR2, "fortgesetzt")
+}
+
+func signalRunningBackup(sig syscall.Signal, action string) error {
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	state, err := loadState(config.BackupDir)
+	if err != nil {
+		return err
+	}
+	run, ok := state.Projects[projectName]
+	if !ok || run.Result != "running" || run.PID == 0 {
+		return fmt.Errorf("für %s läuft kein Backup", projectName)
+	}
+	// Nach einem Absturz kann die PID inzwischen einem anderen Programm gehören, das an
+	// SIGUSR1 sterben würde
+	if exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", run.PID)); err == nil {
+		if self, err := os.Executable(); err == nil && filepath.Base(exe) != filepath.Base(self) {
+			return fmt.Errorf("backup von %s läuft nicht mehr (Prozess %d ist %s)", projectName, run.PID, exe)
+		}
+	}
+	if err := syscall.Kill(run.PID, sig); err != nil {
+		return fmt.Errorf("backup-prozess %d nicht erreichbar: %v", run.PID, err)
+	}
+	fmt.Fprintf(os.Stderr, "Backup von %s (Lauf %s) %s\n", projectName, run.RunID, action)
+	return nil
+}
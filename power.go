@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Geplante Läufe (--scheduled, aus Timer oder cron) sollen einen Laptop nicht im Akkubetrieb
+// leeren: Unter MinBattery Prozent fällt das Backup aus und wird beim nächsten Termin
+// nachgeholt, ein laufendes Backup hält an, bis das Netzteil wieder angeschlossen ist.
+// SkipMetered lässt geplante Läufe mit Remote-Ziel über getaktete Verbindungen ausfallen.
+
+// powerStatus ist der Zustand der Akkus; known ist false ohne Akku oder auf anderen Systemen
+type powerStatus struct {
+	known     bool
+	onBattery bool
+	percent   int
+}
+
+// lowBattery meldet, ob der Rechner im Akkubetrieb unter MinBattery Prozent liegt
+func lowBattery(config *Config, status powerStatus) bool {
+	return config.MinBattery > 0 && status.known && status.onBattery && status.percent < config.MinBattery
+}
+
+// deferralReason liefert den Grund, ein geplantes Backup jetzt auszulassen, oder ""
+func deferralReason(config *Config) string {
+	if status := readPowerStatus(); lowBattery(config, status) {
+		return fmt.Sprintf("Akkubetrieb mit %d%%, weniger als MinBattery %d%%", status.percent, config.MinBattery)
+	}
+	if config.SkipMetered && config.Remote != "" && meteredConnection() {
+		return "getaktete Netzwerkverbindung, Übertragung auf " + config.Remote + " entfällt"
+	}
+	return ""
+}
+
+// deferRun lässt das geplante Backup ausfallen und vermerkt es in state.json. Ein Eintrag
+// "running" bleibt stehen: Er gehört einem laufenden Backup, dessen PID pause und resume
+// brauchen, oder zeigt einen abgebrochenen Lauf an.
+func deferRun(config *Config, project, reason string) {
+	logMessage(LogWarning, "Geplantes Backup zurückgestellt: %s", reason)
+	now := time.Now().UTC()
+	run := RunState{Result: "deferred", Started: now, Finished: now, Error: reason}
+	err := updateState(config.BackupDir, func(state *State) {
+		if state.Projects[project].Result != "running" {
+			state.Projects[project] = run
+		}
+	})
+	if err != nil {
+		// Das Ziel ist womöglich gerade nicht eingehängt
+		logMessage(LogDebug, "Konnte %s nicht schreiben: %v", stateFileName, err)
+	}
+}
+
+// watchPower hält ein laufendes geplantes Backup an, sobald der Akku unter MinBattery
+// fällt, und setzt es fort, wenn das Netzteil angeschlossen wird
+func watchPower(config *Config) {
+	if config.MinBattery <= 0 || !readPowerStatus().known {
+		return
+	}
+	go func() {
+		paused := false
+		for range time.Tick(time.Minute) {
+			status := readPowerStatus()
+			low := lowBattery(config, status)
+			if low == paused {
+				continue
+			}
+			if !archivePause.set(low) {
+				// Schon mit "pause" angehalten bzw. mit "resume" fortgesetzt; ein von Hand
+				// angehaltenes Backup setzt erst "resume" fort
+				if !low {
+					paused = false
+				}
+				continue
+			}
+			paused = low
+			if low {
+				fmt.Fprintln(os.Stderr, colorize(colorYellow, fmt.Sprintf("‖ Akku bei %d%%, Backup angehalten bis zum Anschluss des Netzteils", status.percent)))
+			} else {
+				fmt.Fprintln(os.Stderr, colorize(colorGreen, "▶ Netzbetrieb, Backup wird fortgesetzt"))
+			}
+			setRunPaused(low)
+		}
+	}()
+}
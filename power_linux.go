@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readPowerStatus liest die Akkus aus /sys/class/power_supply; bei mehreren Akkus zählt
+// die gemeinsame Restladung
+func readPowerStatus() powerStatus {
+	var status powerStatus
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	var now, full int
+	online := false
+	for _, supply := range supplies {
+		read := func(name string) string {
+			data, _ := os.ReadFile(filepath.Join(supply, name))
+			return strings.TrimSpace(string(data))
+		}
+		switch read("type") {
+		case "Mains", "USB":
+			if read("online") == "1" {
+				online = true
+			}
+		case "Battery":
+			if read("scope") == "Device" {
+				// Akkus von Maus und Tastatur
+				continue
+			}
+			percent, err := strconv.Atoi(read("capacity"))
+			if err != nil {
+				continue
+			}
+			status.known = true
+			now += percent
+			full += 100
+			if read("status") == "Discharging" {
+				status.onBattery = true
+			}
+		}
+	}
+	if status.known {
+		status.percent = now * 100 / full
+		status.onBattery = status.onBattery && !online
+	}
+	return status
+}
+
+// meteredConnection fragt NetworkManager, ob die Verbindung getaktet ist (auch geschätzt,
+// z.B. beim Tethering über das Handy); ohne NetworkManager gilt sie als unbegrenzt
+func meteredConnection() bool {
+	out, err := exec.Command("busctl", "get-property", "org.freedesktop.NetworkManager",
+		"/org/freedesktop/NetworkManager", "org.freedesktop.NetworkManager", "Metered").Output()
+	if err != nil {
+		return false
+	}
+	// NMMetered: 1 = ja, 3 = vermutlich ja
+	switch strings.TrimSpace(string(out)) {
+	case "u 1", "u 3":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+// Auf anderen Systemen sind Akku und Verbindungsart unbekannt; geplante Backups laufen immer
+func readPowerStatus() powerStatus {
+	return powerStatus{}
+}
+
+func meteredConnection() bool {
+	return false
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Zentral gepflegte Vorgaben (ExcludesFrom, ProfilesFrom) können per HTTPS geladen
+// werden. Mit "#sha256=<prüfsumme>" am Ende der URL wird der Inhalt festgelegt; eine
+// geänderte Datei wird dann abgelehnt, bis die Prüfsumme angepasst ist.
+const presetCacheTTL = time.Hour
+
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://")
+}
+
+// loadPreset liest eine lokale Datei oder lädt eine URL, bei Bedarf aus dem Cache
+func loadPreset(source string) ([]byte, error) {
+	if !isURL(source) {
+		return os.ReadFile(source)
+	}
+	url, pin, _ := strings.Cut(source, "#sha256=")
+	if !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("%s: nur HTTPS-Adressen sind erlaubt", url)
+	}
+	cache := presetCachePath(url)
+	if info, err := os.Stat(cache); err == nil && time.Since(info.ModTime()) < presetCacheTTL {
+		if data, err := os.ReadFile(cache); err == nil {
+			return data, checkPresetPin(url, data, pin)
+		}
+	}
+
+	data, err := fetchPreset(url)
+	if err == nil {
+		if err := checkPresetPin(url, data, pin); err != nil {
+			return nil, err
+		}
+		os.MkdirAll(filepath.Dir(cache), 0755)
+		if err := os.WriteFile(cache, data, 0644); err != nil {
+			logMessage(LogWarning, "Vorgabe %s konnte nicht zwischengespeichert werden: %v", url, err)
+		}
+		return data, nil
+	}
+	// Ohne Netz mit dem letzten Stand weiterarbeiten
+	cached, cacheErr := os.ReadFile(cache)
+	if cacheErr != nil {
+		return nil, fmt.Errorf("%s: %v", url, err)
+	}
+	logMessage(LogWarning, "Vorgabe %s nicht erreichbar (%v), verwende den Stand aus dem Cache", url, err)
+	return cached, checkPresetPin(url, cached, pin)
+}
+
+func fetchPreset(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("antwort %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+}
+
+func checkPresetPin(url string, data []byte, pin string) error {
+	if pin == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, pin) {
+		return fmt.Errorf("%s: prüfsumme %s stimmt nicht mit der festgelegten %s überein", url, actual, pin)
+	}
+	return nil
+}
+
+func presetCachePath(url string) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, "backup-tool", "presets", hex.EncodeToString(sum[:8]))
+}
+
+// loadProfilesFrom liest Profile aus JSON-Dateien oder URLs der Form {"name": {...}}
+func loadProfilesFrom(sources []string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile)
+	for _, source := range sources {
+		data, err := loadPreset(source)
+		if err != nil {
+			return nil, err
+		}
+		var fragment map[string]Profile
+		if err := json.Unmarshal(data, &fragment); err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+		for name, profile := range fragment {
+			profiles[name] = profile
+		}
+	}
+	return profiles, nil
+}
+
+// mergeSharedProfiles ergänzt Profiles um die Profile aus ProfilesFrom; lokal
+// definierte Profile gleichen Namens haben Vorrang
+func mergeSharedProfiles(config *Config) error {
+	if len(config.ProfilesFrom) == 0 {
+		return nil
+	}
+	shared, err := loadProfilesFrom(config.ProfilesFrom)
+	if err != nil {
+		return fmt.Errorf("ProfilesFrom: %v", err)
+	}
+	if config.Profiles == nil {
+		config.Profiles = make(map[string]Profile)
+	}
+	for name, profile := range shared {
+		if _, local := config.Profiles[name]; !local {
+			config.Profiles[name] = profile
+		}
+	}
+	return nil
+}
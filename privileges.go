@@ -0,0 +1,56 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// dropPrivileges wechselt als root zum Benutzer RunAs, nachdem das Backup-Ziel angelegt
+// ist. Das Lesen der Quelle, Hooks und Kompressor laufen dann ohne root-Rechte. Neu
+// angelegte Verzeichnisse des Ziels gehen an den Benutzer, damit er darin schreiben kann.
+func dropPrivileges(name string, created []string) error {
+	account, err := user.Lookup(name)
+	if err != nil {
+		return fmt.Errorf("RunAs: %v", err)
+	}
+	uid, _ := strconv.Atoi(account.Uid)
+	gid, _ := strconv.Atoi(account.Gid)
+	if os.Geteuid() == uid {
+		return nil
+	}
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("RunAs %s ist nur als root möglich", name)
+	}
+	for _, dir := range created {
+		if err := os.Chown(dir, uid, gid); err != nil {
+			return err
+		}
+	}
+	var groups []int
+	if ids, err := account.GroupIds(); err == nil {
+		for _, id := range ids {
+			if n, err := strconv.Atoi(id); err == nil {
+				groups = append(groups, n)
+			}
+		}
+	}
+	// Reihenfolge wichtig: ohne root lassen sich Gruppen nicht mehr ändern
+	if err := syscall.Setgroups(groups); err != nil {
+		return fmt.Errorf("RunAs: Gruppen: %v", err)
+	}
+	if err := syscall.Setgid(gid); err != nil {
+		return fmt.Errorf("RunAs: Gruppe %d: %v", gid, err)
+	}
+	if err := syscall.Setuid(uid); err != nil {
+		return fmt.Errorf("RunAs: Benutzer %d: %v", uid, err)
+	}
+	os.Setenv("HOME", account.HomeDir)
+	os.Setenv("USER", account.Username)
+	logMessage(LogInfo, "Rechte abgegeben, laufe weiter als %s", account.Username)
+	return nil
+}
@@ -0,0 +1,7 @@
+package main
+
+import "fmt"
+
+func dropPrivileges(name string, created []string) error {
+	return fmt.Errorf("RunAs wird unter Windows nicht unterstützt")
+}
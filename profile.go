@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Profile überschreibt einzelne Einstellungen für Läufe mit --profile, z.B. ein
+// Langzeitarchiv mit xz neben den schnellen täglichen Backups oder ein "quiet"-Profil
+// mit wenigen Workern und gedrosselter Übertragung für Läufe tagsüber
+type Profile struct {
+	Compression      string
+	CompressionLevel int
+	Workers          int
+	BandwidthLimit   string
+	Nice             int
+}
+
+// applyProfile übernimmt die gesetzten Werte des Profils in die Konfiguration
+func applyProfile(config *Config, name string) error {
+	if name == "" {
+		return nil
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		var names []string
+		for known := range config.Profiles {
+			names = append(names, known)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unbekanntes Profil %q (vorhanden: %s)", name, strings.Join(names, ", "))
+	}
+	if profile.Compression != "" {
+		config.Compression = profile.Compression
+		config.CompressionLevel = 0
+	}
+	if profile.CompressionLevel != 0 {
+		config.CompressionLevel = profile.CompressionLevel
+	}
+	if profile.Workers != 0 {
+		config.Workers = profile.Workers
+	}
+	if profile.BandwidthLimit != "" {
+		config.BandwidthLimit = profile.BandwidthLimit
+	}
+	if profile.Nice != 0 {
+		config.Nice = profile.Nice
+	}
+	logMessage(LogInfo, "Verwende Profil %s", name)
+	return nil
+}
+
+// applyPriority senkt die Priorität des Prozesses; neue Threads und Kompressionsprogramme
+// erben sie. Unter Linux gilt die Priorität je Thread, daher werden alle vorhandenen
+// Threads angepasst.
+func applyPriority(nice int) error {
+	if nice == 0 {
+		return nil
+	}
+	if nice < 0 || nice > 19 {
+		return fmt.Errorf("ungültiger Nice-Wert %d (möglich: 1-19)", nice)
+	}
+	tasks, err := os.ReadDir("/proc/self/task")
+	if err != nil {
+		return syscall.Setpriority(syscall.PRIO_PROCESS, 0, nice)
+	}
+	for _, task := range tasks {
+		tid, err := strconv.Atoi(task.Name())
+		if err != nil {
+			continue
+		}
+		if err := syscall.Setpriority(syscall.PRIO_PROCESS, tid, nice); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressEvents meldet den Fortschritt eines Backups an Oberflächen (GUI, TUI), damit
+// sie nicht den Log-Text auswerten müssen. Nicht gesetzte Rückrufe werden übergangen;
+// sie laufen im Schreiber bzw. im meldenden Abschnitt und sollten nicht blockieren.
+type progressEvents struct {
+	OnFileStart   func(name string, size int64)
+	OnFileDone    func(name string, size int64, err error) // err: Eintrag nicht gesichert
+	OnPhaseChange func(phase string)                       // Abschnitte wie bei Tracing, am Ende "finished" oder "failed"
+	OnWarning     func(message string)
+}
+
+var events progressEvents
+
+func (e *progressEvents) fileStart(name string, size int64) {
+	if e.OnFileStart != nil {
+		e.OnFileStart(name, size)
+	}
+}
+
+func (e *progressEvents) fileDone(name string, size int64, err error) {
+	if e.OnFileDone != nil {
+		e.OnFileDone(name, size, err)
+	}
+}
+
+func (e *progressEvents) phaseChange(phase string) {
+	if e.OnPhaseChange != nil {
+		e.OnPhaseChange(phase)
+	}
+}
+
+func (e *progressEvents) warning(message string) {
+	if e.OnWarning != nil {
+		e.OnWarning(message)
+	}
+}
+
+// statusEvent ist eine Zeile der Ausgabe von --status-fd
+type statusEvent struct {
+	Time    time.Time
+	Event   string // "file-start", "file-done", "phase" oder "warning"
+	Name    string `json:",omitempty"`
+	Size    int64  `json:",omitempty"`
+	Phase   string `json:",omitempty"`
+	Message string `json:",omitempty"`
+	Error   string `json:",omitempty"`
+}
+
+// openStatusFD schreibt alle Ereignisse als JSON-Zeilen in den Dateideskriptor fd, den
+// das aufrufende Programm bereitstellt (z.B. "3>status.jsonl" oder eine Pipe)
+func openStatusFD(fd int) error {
+	out := os.NewFile(uintptr(fd), "status")
+	if _, err := out.Stat(); err != nil {
+		return fmt.Errorf("--status-fd %d ist nicht geöffnet: %v", fd, err)
+	}
+	var mu sync.Mutex
+	encoder := json.NewEncoder(out)
+	emit := func(event statusEvent) {
+		event.Time = time.Now().UTC()
+		mu.Lock()
+		defer mu.Unlock()
+		encoder.Encode(event)
+	}
+	events = progressEvents{
+		OnFileStart: func(name string, size int64) {
+			emit(statusEvent{Event: "file-start", Name: name, Size: size})
+		},
+		OnFileDone: func(name string, size int64, err error) {
+			event := statusEvent{Event: "file-done", Name: name, Size: size}
+			if err != nil {
+				event.Error = err.Error()
+			}
+			emit(event)
+		},
+		OnPhaseChange: func(phase string) {
+			emit(statusEvent{Event: "phase", Phase: phase})
+		},
+		OnWarning: func(message string) {
+			emit(statusEvent{Event: "warning", Message: message})
+		},
+	}
+	return nil
+}
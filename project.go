@@ -0,0 +1,318 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// projectIdentity bestimmt den Namen, unter dem ein Projekt gesichert wird. Eine ProjectID
+// aus config.json hat Vorrang. Sonst gilt der Verzeichnisname, bzw. der neue Name, wenn
+// das Projekt mit "project rename" umbenannt wurde. Belegt bereits ein anderes Verzeichnis
+// den Namen im Katalog, wird ein Kürzel des Pfads angehängt, damit sich gleichnamige
+// Projekte weder Aufbewahrung noch Verlauf teilen.
+func projectIdentity(config *Config, sourceDir string) (string, error) {
+	if config.ProjectID != "" {
+		if !isValidBackupName(config.ProjectID) {
+			return "", fmt.Errorf("ungültige ProjectID %q", config.ProjectID)
+		}
+		return config.ProjectID, nil
+	}
+	name := filepath.Base(sourceDir)
+	unique := name + "-" + pathHash(sourceDir)
+	// Umbenannt werden kann das Projekt unter seinem einfachen wie unter dem eindeutigen Namen
+	for _, previous := range []string{name, unique} {
+		if renamed, ok := resolveAlias(config, previous); ok && hasBackupsFrom(config, renamed, sourceDir) {
+			logMessage(LogDebug, "Projekt %s wurde in %s umbenannt", previous, renamed)
+			return renamed, nil
+		}
+	}
+	catalog, err := loadCatalog(projectCatalogDir(config, name))
+	if err != nil {
+		return name, nil
+	}
+	if hasBackupsFrom(config, unique, sourceDir) {
+		return unique, nil
+	}
+	taken := false
+	for _, entry := range catalog.Backups {
+		if entry.Project != name || entry.SourceDir == "" {
+			continue
+		}
+		if entry.SourceDir == sourceDir {
+			return name, nil
+		}
+		taken = true
+	}
+	// Auch ein umbenanntes Projekt belegt seinen früheren Namen weiter
+	if _, renamed := catalog.Aliases[name]; taken || renamed {
+		logMessage(LogDebug, "Projektname %s ist bereits belegt, verwende %s", name, unique)
+		return unique, nil
+	}
+	return name, nil
+}
+
+// resolveAlias folgt den Aliasen eines früheren Projektnamens bis zum aktuellen Namen; beim
+// Layout "project" steht jeder Alias im Katalog des jeweils früheren Namens
+func resolveAlias(config *Config, name string) (string, bool) {
+	current, found := name, false
+	for i := 0; i < 16; i++ {
+		catalog, err := loadCatalog(projectCatalogDir(config, current))
+		if err != nil {
+			break
+		}
+		next, ok := catalog.Aliases[current]
+		if !ok || next == name {
+			break
+		}
+		current, found = next, true
+	}
+	return current, found
+}
+
+// hasBackupsFrom meldet, ob es Backups des Projekts aus diesem Verzeichnis gibt
+func hasBackupsFrom(config *Config, project, sourceDir string) bool {
+	catalog, err := loadCatalog(projectCatalogDir(config, project))
+	if err != nil {
+		return false
+	}
+	for _, entry := range catalog.Backups {
+		if entry.Project == project && entry.SourceDir == sourceDir {
+			return true
+		}
+	}
+	return false
+}
+
+// projectCatalogDir liefert das Verzeichnis mit dem Katalog eines Projekts; config.BackupDir
+// ist dabei noch das Backup-Verzeichnis vor der Auswahl nach Layout
+func projectCatalogDir(config *Config, project string) string {
+	if config.Layout == "project" {
+		return filepath.Join(config.BackupDir, project)
+	}
+	return config.BackupDir
+}
+
+// pathHash ist ein kurzes, stabiles Kürzel eines Verzeichnispfads
+func pathHash(path string) string {
+	sum := sha256.Sum256([]byte(path))
+	return hex.EncodeToString(sum[:4])
+}
+
+// runProject verwaltet die Identität des Projekts
+func runProject(args []string) error {
+	if len(args) == 0 || args[0] != "rename" {
+		return fmt.Errorf("verwendung: backup-tool project rename [--from <alter-name>] <neuer-name>")
+	}
+	flags := flag.NewFlagSet("project rename", flag.ExitOnError)
+	from := flags.String("from", "", "bisheriger Projektname, z.B. nach dem Umbenennen des Verzeichnisses (Standard: aktueller Name)")
+	flags.Parse(args[1:])
+	if flags.NArg() != 1 {
+		return fmt.Errorf("verwendung: backup-tool project rename [--from <alter-name>] <neuer-name>")
+	}
+	newName := flags.Arg(0)
+	if !isValidBackupName(newName) || newName == "" {
+		return fmt.Errorf("ungültiger Projektname %q", newName)
+	}
+
+	config, sourceDir, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	oldName := projectName
+	if *from != "" {
+		oldName = *from
+	}
+	if oldName == newName {
+		return fmt.Errorf("das Projekt heißt bereits %s", newName)
+	}
+	oldDir, newDir := config.backupRoot, config.backupRoot
+	if config.Layout == "project" {
+		oldDir, newDir = filepath.Join(oldDir, oldName), filepath.Join(newDir, newName)
+	}
+
+	oldCatalog, err := loadCatalog(oldDir)
+	if err != nil {
+		return err
+	}
+	entries := oldCatalog.forProject(oldName)
+	if len(entries) == 0 {
+		return fmt.Errorf("keine Backups von %s im Katalog", oldName)
+	}
+	if existing, err := loadCatalog(newDir); err == nil && len(existing.forProject(newName)) > 0 {
+		return fmt.Errorf("es gibt bereits Backups unter dem Namen %s", newName)
+	}
+
+	// Archive, Manifeste und Inventuren umbenennen
+	renamed, undo, err := renameBackupFiles(oldDir, newDir, oldName, newName)
+	if err != nil {
+		return err
+	}
+
+	rename := func(file string) string {
+		if file == "" || backupFileProject(file) != oldName {
+			return file
+		}
+		return newName + strings.TrimPrefix(file, oldName)
+	}
+	for i := range entries {
+		entries[i].Project = newName
+		entries[i].File = rename(entries[i].File)
+		entries[i].SameAs = rename(entries[i].SameAs)
+		entries[i].SourceDir = sourceDir
+	}
+	// Erst die neuen Einträge anlegen, dann die alten entfernen; scheitert ein Schritt,
+	// werden die vorherigen zurückgenommen, damit Katalog und Dateien zusammenpassen
+	err = updateCatalog(newDir, func(c *Catalog) {
+		for _, entry := range entries {
+			c.add(entry)
+		}
+	})
+	if err != nil {
+		undo()
+		return err
+	}
+	err = updateCatalog(oldDir, func(c *Catalog) {
+		kept := c.Backups[:0]
+		for _, entry := range c.Backups {
+			if entry.Project != oldName {
+				kept = append(kept, entry)
+			}
+		}
+		c.Backups = kept
+		addAlias(c, oldName, newName)
+	})
+	if err == nil && projectName != oldName && projectName != newName {
+		// Mit --from nach dem Umbenennen des Verzeichnisses: der Name, unter dem das
+		// Verzeichnis jetzt gesichert würde, soll ebenfalls auf den neuen Namen führen
+		currentDir := config.backupRoot
+		if config.Layout == "project" {
+			currentDir = filepath.Join(currentDir, projectName)
+		}
+		if err = os.MkdirAll(currentDir, 0755); err == nil {
+			err = updateCatalog(currentDir, func(c *Catalog) { addAlias(c, projectName, newName) })
+		}
+	}
+	if err != nil {
+		if rollbackErr := updateCatalog(newDir, func(c *Catalog) {
+			for _, entry := range entries {
+				c.remove(entry.File)
+			}
+		}); rollbackErr != nil {
+			logMessage(LogError, "Katalog in %s konnte nicht zurückgesetzt werden: %v", newDir, rollbackErr)
+		}
+		undo()
+		return err
+	}
+
+	if state, err := loadState(oldDir); err == nil {
+		if run, ok := state.Projects[oldName]; ok {
+			saveRunState(newDir, newName, run)
+		}
+	}
+	if config.ProjectID != "" {
+		if err := saveConfigValues(configPath(), map[string]interface{}{"ProjectID": newName}); err != nil {
+			return fmt.Errorf("fehler beim Speichern der Konfiguration: %v", err)
+		}
+	}
+	fmt.Printf("✓ %s in %s umbenannt (%d Backups, %d Dateien)\n", oldName, newName, len(entries), renamed)
+	if config.Remote != "" {
+		fmt.Println("Hinweis: Backups auf dem Remote-Ziel behalten ihren bisherigen Namen")
+	}
+	return nil
+}
+
+// addAlias lässt den früheren Namen auf den neuen zeigen, ebenso ältere Aliase
+func addAlias(c *Catalog, oldName, newName string) {
+	if c.Aliases == nil {
+		c.Aliases = make(map[string]string)
+	}
+	c.Aliases[oldName] = newName
+	for alias, target := range c.Aliases {
+		if target == oldName {
+			c.Aliases[alias] = newName
+		}
+	}
+}
+
+// renameBackupFiles verschiebt die Dateien eines Projekts unter den neuen Namen und passt
+// Projekt und Archivnamen in den Manifesten an. undo macht alle Umbenennungen rückgängig;
+// bei einem Fehler ist das bereits geschehen.
+func renameBackupFiles(oldDir, newDir, oldName, newName string) (int, func(), error) {
+	type renamedFile struct {
+		from, to string
+		manifest []byte // ursprünglicher Inhalt eines Manifests
+	}
+	var done []renamedFile
+	undo := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			file := done[i]
+			if file.manifest != nil {
+				if err := os.WriteFile(file.to, file.manifest, 0644); err != nil {
+					logMessage(LogError, "Manifest %s konnte nicht zurückgesetzt werden: %v", file.to, err)
+				}
+			}
+			if err := moveFile(file.to, file.from); err != nil {
+				logMessage(LogError, "%s konnte nicht zurückbenannt werden: %v", file.to, err)
+			}
+		}
+	}
+
+	if err := os.MkdirAll(newDir, 0755); err != nil {
+		return 0, nil, err
+	}
+	files, err := os.ReadDir(oldDir)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, file := range files {
+		if file.IsDir() || backupFileProject(file.Name()) != oldName {
+			continue
+		}
+		source := filepath.Join(oldDir, file.Name())
+		target := filepath.Join(newDir, newName+strings.TrimPrefix(file.Name(), oldName))
+		if err := moveBackupFile(source, target); err != nil {
+			undo()
+			return 0, nil, err
+		}
+		done = append(done, renamedFile{from: source, to: target})
+		if strings.HasSuffix(target, ".manifest.json") {
+			original, err := renameManifest(target, oldName, newName)
+			done[len(done)-1].manifest = original
+			if err != nil {
+				undo()
+				return 0, nil, fmt.Errorf("fehler beim Anpassen von %s: %v", target, err)
+			}
+		}
+	}
+	return len(done), undo, nil
+}
+
+// renameManifest trägt den neuen Projekt- und Archivnamen in ein Manifest ein und liefert
+// den bisherigen Inhalt, auch wenn das Schreiben scheitert
+func renameManifest(path, oldName, newName string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, err
+	}
+	if manifest.Project == oldName {
+		manifest.Project = newName
+	}
+	if backupFileProject(manifest.Archive) == oldName {
+		manifest.Archive = newName + strings.TrimPrefix(manifest.Archive, oldName)
+	}
+	updated, err := json.MarshalIndent(&manifest, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return data, os.WriteFile(path, updated, 0644)
+}
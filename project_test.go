@@ -0,0 +1,108 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRenameBackupFilesUpdatesManifest(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "api_backup_2024-01-01_12-00-00.tar.gz")
+	if err := os.WriteFile(archive, []byte("archiv"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveManifest(archive, newManifest(archive, "api", nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	renamed, _, err := renameBackupFiles(dir, dir, "api", "service")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renamed != 2 {
+		t.Errorf("%d Dateien umbenannt, erwartet 2", renamed)
+	}
+	manifest, err := loadManifest(filepath.Join(dir, "service_backup_2024-01-01_12-00-00.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Project != "service" || manifest.Archive != "service_backup_2024-01-01_12-00-00.tar.gz" {
+		t.Errorf("Manifest nicht angepasst: Project %q, Archive %q", manifest.Project, manifest.Archive)
+	}
+}
+
+func TestRenameBackupFilesRollsBack(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "api_backup_2024-01-01_12-00-00.tar.gz")
+	if err := os.WriteFile(archive, []byte("archiv"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveManifest(archive, newManifest(archive, "api", nil)); err != nil {
+		t.Fatal(err)
+	}
+	original, err := os.ReadFile(manifestPath(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Das Manifest wird vor dem Archiv umbenannt; das Archiv scheitert am vorhandenen Ziel
+	if err := os.WriteFile(filepath.Join(dir, "service_backup_2024-01-01_12-00-00.tar.gz"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := renameBackupFiles(dir, dir, "api", "service"); err == nil {
+		t.Fatal("Umbenennen trotz vorhandenem Ziel erfolgreich")
+	}
+	data, err := os.ReadFile(manifestPath(archive))
+	if err != nil {
+		t.Fatalf("Manifest nicht zurückbenannt: %v", err)
+	}
+	if string(data) != string(original) {
+		t.Error("Manifest nicht auf den ursprünglichen Inhalt zurückgesetzt")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "service_backup_2024-01-01_12-00-00.manifest.json")); !os.IsNotExist(err) {
+		t.Errorf("umbenanntes Manifest liegt noch da (%v)", err)
+	}
+}
+
+func TestProjectIdentityAfterRenamingUniqueName(t *testing.T) {
+	for _, layout := range []string{"flat", "project"} {
+		t.Run(layout, func(t *testing.T) {
+			root := t.TempDir()
+			config := &Config{BackupDir: root, Layout: layout}
+			other, own := "/src/a/api", "/src/b/api"
+			unique := "api-" + pathHash(own)
+			save := func(project string, catalog *Catalog) {
+				dir := projectCatalogDir(config, project)
+				if err := os.MkdirAll(dir, 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := saveCatalog(dir, catalog); err != nil {
+					t.Fatal(err)
+				}
+			}
+			created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+			otherEntry := CatalogEntry{Project: "api", File: "api_backup_1.tar.gz", Created: created, SourceDir: other}
+			renamedEntry := CatalogEntry{Project: "service", File: "service_backup_1.tar.gz", Created: created, SourceDir: own}
+			// Zustand nach "project rename service" im Verzeichnis own, das unique hieß
+			if layout == "flat" {
+				save("", &Catalog{
+					Backups: []CatalogEntry{otherEntry, renamedEntry},
+					Aliases: map[string]string{unique: "service"},
+				})
+			} else {
+				save("api", &Catalog{Backups: []CatalogEntry{otherEntry}})
+				save(unique, &Catalog{Aliases: map[string]string{unique: "service"}})
+				save("service", &Catalog{Backups: []CatalogEntry{renamedEntry}})
+			}
+
+			if name, err := projectIdentity(config, own); err != nil || name != "service" {
+				t.Errorf("Identität nach dem Umbenennen %q (%v), erwartet service", name, err)
+			}
+			if name, err := projectIdentity(config, other); err != nil || name != "api" {
+				t.Errorf("Identität des anderen Projekts %q (%v), erwartet api", name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runPrune löscht Backups, die über die Aufbewahrung hinausgehen. Mit --remote wird das
+// Remote-Ziel aufgeräumt; bei RemoteAppendOnly ist das der einzige Weg, dort etwas zu
+// löschen, und läuft typischerweise mit anderen Zugangsdaten oder direkt auf dem NAS
+// (--target). Dabei werden die einzelnen Einträge aus catalog.d in catalog.json übernommen.
+func runPrune(args []string) error {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	fromRemote := flags.Bool("remote", false, "Remote-Ziel statt des lokalen Backup-Verzeichnisses aufräumen")
+	target := flags.String("target", "", "Verzeichnis des Remote-Ziels, falls es hier anders eingebunden ist")
+	all := flags.Bool("all", false, "alle Projekte aufräumen")
+	dryRun := flags.Bool("dry-run", false, "nur anzeigen, was gelöscht würde")
+	policySpec := flags.String("policy", "", "Aufbewahrung statt Retention bzw. MaxBackups (mit --remote RemoteRetention), z.B. last=3,daily=7,weekly=4,monthly=12")
+	simulate := flags.Bool("simulate", false, "die Aufbewahrung auf alle Backups im Katalog anwenden und zeigen, welche sie überstanden hätten")
+	flags.Parse(args)
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	dir := config.BackupDir
+	if *fromRemote || *target != "" {
+		dir = *target
+		if dir == "" {
+			remote, err := openRemote(config)
+			if err != nil {
+				return err
+			}
+			dir = remote.root
+		}
+	}
+	retention := configRetention
+	if dir != config.BackupDir {
+		retention = remoteRetention
+	}
+	policy, err := retention(config)
+	if *policySpec != "" {
+		policy, err = parseRetentionPolicy(*policySpec)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Auf dem Remote-Ziel sichern oder räumen womöglich gerade andere Rechner
+	if dir != config.BackupDir && !*dryRun && !*simulate {
+		release, err := acquireLease(dir)
+		if err != nil {
+			return err
+		}
+		defer release()
+	}
+	// Nur Einzeleinträge, die jetzt schon da sind, landen gleich in catalog.json
+	entryFiles, _ := filepath.Glob(filepath.Join(dir, catalogEntriesDir, "*.json"))
+	catalog, err := loadCatalog(dir)
+	if err != nil {
+		return err
+	}
+	projects := []string{projectName}
+	if *all {
+		projects = catalog.projects()
+	}
+	if *simulate {
+		current, err := retention(config)
+		if err != nil {
+			return err
+		}
+		for _, project := range projects {
+			simulateRetention(project, catalog.forProject(project), policy, current)
+		}
+		return nil
+	}
+
+	var removed []string
+	for _, project := range projects {
+		for _, entry := range policy.removals(catalog.forProject(project)) {
+			fmt.Printf("Lösche %s vom %s\n", entry.File, formatDateTime(entry.Created))
+			removed = append(removed, entry.File)
+		}
+	}
+	if *dryRun {
+		fmt.Printf("%d Backups würden gelöscht\n", len(removed))
+		return nil
+	}
+
+	if err := deleteArchives(dir, removed, "prune, Aufbewahrung "+policy.String()); err != nil {
+		return err
+	}
+	// Diese Einträge stehen jetzt in catalog.json; später hinzugekommene bleiben liegen
+	if err := checkLease(dir); err != nil {
+		return err
+	}
+	for _, file := range entryFiles {
+		os.Remove(file)
+	}
+	os.Remove(filepath.Join(dir, catalogEntriesDir))
+
+	fmt.Printf("✓ %d Backups in %s gelöscht\n", len(removed), dir)
+	return nil
+}
+
+// simulateRetention zeigt für alle Backups im Katalog, ob sie die vorgeschlagene
+// Aufbewahrung überstanden hätten, und vergleicht mit der aktuellen
+func simulateRetention(project string, entries []CatalogEntry, policy, current retentionPolicy) {
+	kept, keptNow := policy.apply(entries), current.apply(entries)
+	fmt.Printf("Projekt %s, Aufbewahrung %s (aktuell %s):\n", project, policy, current)
+	survived, changed := 0, 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if entry.SameAs != "" || entry.File == "" {
+			continue
+		}
+		mark, reasons := "✗", "gelöscht"
+		if kept[entry.File] != nil {
+			mark, reasons = "✓", strings.Join(kept[entry.File], ", ")
+			survived++
+		}
+		note := ""
+		if (kept[entry.File] != nil) != (keptNow[entry.File] != nil) {
+			note = "  (abweichend von aktuell)"
+			changed++
+		}
+		fmt.Printf("  %s %s  %-32s %s%s\n", mark, formatDateTime(entry.Created), reasons, formatSize(entry.Size), note)
+	}
+	fmt.Printf("  %d Backups blieben erhalten, %d Abweichungen zur aktuellen Aufbewahrung\n\n", survived, changed)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Mit ReadOnlySource (--read-only-source) schreibt ein Backup nachweislich nichts in das
+// Quellverzeichnis: Ziele darin werden abgelehnt, und Schreibproben wie die von
+// checkPermissions brechen ab, statt dort Dateien anzulegen. Hooks sind eigene Programme
+// und davon ausgenommen.
+
+// readOnlySource ist das geschützte Quellverzeichnis, leer ohne ReadOnlySource
+var readOnlySource string
+
+// enforceReadOnlySource prüft alle Orte, an die ein Backup schreibt
+func enforceReadOnlySource(config *Config, sourceDir string) error {
+	readOnlySource = sourceDir
+	for name, dir := range map[string]string{
+		"BackupDir": config.backupRoot,
+		"SpoolDir":  config.SpoolDir,
+	} {
+		if dir != "" && isWithin(sourceDir, dir) {
+			return fmt.Errorf("%s %s liegt im Quellverzeichnis, das mit ReadOnlySource nicht beschrieben werden darf", name, dir)
+		}
+	}
+	if len(config.PreHooks)+len(config.PostHooks) > 0 {
+		logMessage(LogWarning, "ReadOnlySource gilt nicht für Hooks, sie laufen im Quellverzeichnis")
+	}
+	return nil
+}
+
+// assertWritable bricht ab, bevor in das geschützte Quellverzeichnis geschrieben würde
+func assertWritable(path string) error {
+	if readOnlySource != "" && isWithin(readOnlySource, path) {
+		return fmt.Errorf("schreiben in %s verweigert: liegt im Quellverzeichnis (ReadOnlySource)", path)
+	}
+	return nil
+}
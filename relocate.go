@@ -0,0 +1,317 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// runRelocate zieht das ganze Backup-Verzeichnis (Archive, Manifeste, Kataloge, Status
+// und den Snapshot-Speicher) an einen neuen Ort um, z.B. auf eine größere Platte oder
+// ein eingebundenes NAS. Jede Datei wird beim Kopieren gehasht und danach am Ziel erneut
+// gelesen; die Quelle wird erst gelöscht, wenn alle Dateien übereinstimmen.
+func runRelocate(args []string) error {
+	flags := flag.NewFlagSet("relocate", flag.ExitOnError)
+	keep := flags.Bool("copy", false, "nur kopieren, das bisherige Backup-Verzeichnis bleibt erhalten")
+	dryRun := flags.Bool("dry-run", false, "nur anzeigen, was umgezogen würde")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Verwendung: backup-tool relocate [--copy] [--dry-run] NEUES-BACKUP-VERZEICHNIS")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("kein neues Backup-Verzeichnis angegeben")
+	}
+
+	config, sourceDir, _, err := loadProject()
+	if err != nil {
+		return err
+	}
+	root := config.backupRoot
+	target := expandPath(flags.Arg(0), sourceDir)
+	if rel, err := filepath.Rel(root, target); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("%s liegt innerhalb von %s", target, root)
+	}
+	if entries, err := os.ReadDir(target); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s ist nicht leer", target)
+	}
+	if err := checkMounted(target); err != nil {
+		return err
+	}
+	if *dryRun {
+		return relocateTree(root, target, *keep, true)
+	}
+
+	// Kein Backup darf während des Umzugs neue Dateien anlegen: Katalog und state.json
+	// bleiben gesperrt, ein neues Backup wartet in startRun. Andere Rechner, die das
+	// Verzeichnis als Remote-Ziel nutzen, halten sich an die Lease.
+	dirs := relocateDirs(root)
+	err = withRelocateLocks(dirs, func() error {
+		if err := checkNoRunningBackup(dirs); err != nil {
+			return err
+		}
+		return relocateTree(root, target, *keep, false)
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Hinweis: \"BackupDir\": %q in config.json der Projekte setzen\n", target)
+	return nil
+}
+
+// relocateTree kopiert alle Dateien unter root nach target, prüft sie und löscht danach
+// ohne keep genau die kopierten Dateien in root
+func relocateTree(root, target string, keep, dryRun bool) error {
+	var files []string
+	var total int64
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		// Sperrdateien und halbe Schreibvorgänge gehören nicht zum Bestand
+		if !d.IsDir() && relocateSkipped(path) {
+			return nil
+		}
+		files = append(files, path)
+		if info, err := d.Info(); err == nil && d.Type().IsRegular() {
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if free, err := freeSpace(existingParent(target)); err == nil && free < total {
+		return fmt.Errorf("auf %s sind nur %s frei, benötigt werden %s", target, formatSize(free), formatSize(total))
+	}
+	if dryRun {
+		fmt.Printf("%d Dateien (%s) würden von %s nach %s umziehen\n", len(files), formatSize(total), root, target)
+		return nil
+	}
+
+	// Zuerst alles kopieren und prüfen, erst dann die Quelle anfassen
+	sums, err := catalogSums(root)
+	if err != nil {
+		return err
+	}
+	links := make(map[uint64]string)
+	var dirs []string
+	for _, path := range files {
+		rel, _ := filepath.Rel(root, path)
+		dst := filepath.Join(target, rel)
+		if err := relocateEntry(path, dst, links, sums[path]); err != nil {
+			return fmt.Errorf("%s: %v (%s bleibt unverändert)", rel, err, root)
+		}
+		if info, err := os.Lstat(path); err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+	}
+	// Verzeichniszeiten erst am Ende, das Anlegen der Dateien hätte sie verändert
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil {
+			rel, _ := filepath.Rel(root, dir)
+			os.Chtimes(filepath.Join(target, rel), info.ModTime(), info.ModTime())
+		}
+	}
+	fmt.Fprintln(os.Stderr, colorize(colorGreen, fmt.Sprintf("✓ %d Dateien (%s) nach %s kopiert und geprüft", len(files), formatSize(total), target)))
+	// Das Protokoll zieht mit um
+	if rel, err := filepath.Rel(root, auditDir); err == nil {
+		auditDir = filepath.Join(target, rel)
+	}
+	audit("relocate", target, "Backup-Verzeichnis von "+root)
+
+	if keep {
+		return nil
+	}
+	// Nur löschen, was kopiert und geprüft wurde; Verzeichnisse zuletzt und nur, wenn sie
+	// danach leer sind. Sperrdateien und halbe Schreibvorgänge bleiben liegen.
+	for i := len(files) - 1; i >= 0; i-- {
+		path := files[i]
+		info, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("kopie ist vollständig, aber %s fehlt: %v", path, err)
+		}
+		if info.IsDir() {
+			os.Remove(path)
+			continue
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("kopie ist vollständig, aber %s konnte nicht gelöscht werden: %v", path, err)
+		}
+	}
+	if _, err := os.Stat(root); err == nil {
+		fmt.Fprintf(os.Stderr, "Umgezogene Dateien in %s gelöscht; Sperrdateien und unvollständige Dateien sind dort geblieben\n", root)
+	} else {
+		fmt.Fprintln(os.Stderr, "Bisheriges Backup-Verzeichnis "+root+" gelöscht")
+	}
+	return nil
+}
+
+// relocateSkipped erkennt Sperrdateien, Leases und halbe Schreibvorgänge
+func relocateSkipped(path string) bool {
+	for _, suffix := range []string{".lock", ".lease", ".tmp", ".part"} {
+		if strings.HasSuffix(path, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// relocateDirs liefert root und alle Projektverzeichnisse darunter mit Katalog oder state.json
+func relocateDirs(root string) []string {
+	dirs := []string{root}
+	seen := map[string]bool{root: true}
+	for _, name := range []string{catalogFileName, stateFileName} {
+		matches, _ := filepath.Glob(filepath.Join(root, "*", name))
+		for _, match := range matches {
+			if dir := filepath.Dir(match); !seen[dir] {
+				seen[dir] = true
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	return dirs
+}
+
+// withRelocateLocks führt fn aus, während Lease, Katalog und state.json in allen dirs
+// gesperrt sind
+func withRelocateLocks(dirs []string, fn func() error) error {
+	if len(dirs) == 0 {
+		return fn()
+	}
+	dir := dirs[0]
+	return withLease(dir, func() error {
+		return withLock(filepath.Join(dir, catalogFileName), func() error {
+			return withLock(filepath.Join(dir, stateFileName), func() error {
+				return withRelocateLocks(dirs[1:], fn)
+			})
+		})
+	})
+}
+
+// checkNoRunningBackup lehnt den Umzug ab, solange state.json ein laufendes Backup nennt
+func checkNoRunningBackup(dirs []string) error {
+	for _, dir := range dirs {
+		state, err := loadState(dir)
+		if err != nil {
+			return err
+		}
+		for project, run := range state.Projects {
+			if run.Result == "running" {
+				return fmt.Errorf("backup von %s läuft (Lauf %s, Prozess %d); nach einem Absturz bereinigt das nächste Backup den Eintrag in %s",
+					project, run.RunID, run.PID, filepath.Join(dir, stateFileName))
+			}
+		}
+	}
+	return nil
+}
+
+// catalogSums liefert die Prüfsummen aus allen Katalogen unterhalb von root, damit ein
+// schon vor dem Umzug beschädigtes Archiv nicht unbemerkt mitwandert
+func catalogSums(root string) (map[string]string, error) {
+	sums := make(map[string]string)
+	dirs := []string{root}
+	catalogs, _ := filepath.Glob(filepath.Join(root, "*", catalogFileName))
+	for _, path := range catalogs {
+		dirs = append(dirs, filepath.Dir(path))
+	}
+	for _, dir := range dirs {
+		catalog, err := loadCatalog(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range catalog.Backups {
+			if entry.SHA256 != "" && entry.SameAs == "" {
+				sums[filepath.Join(dir, entry.File)] = entry.SHA256
+			}
+		}
+	}
+	return sums, nil
+}
+
+// relocateEntry legt Verzeichnis, Symlink oder Datei am Ziel an. Mehrfach verlinkte
+// Dateien (Snapshot-Speicher) bleiben am Ziel Hardlinks auf eine einzige Kopie.
+func relocateEntry(src, dst string, links map[uint64]string, want string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.IsDir():
+		return os.MkdirAll(dst, info.Mode().Perm()|0700)
+	case info.Mode()&os.ModeSymlink != 0:
+		link, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(link, dst)
+	case !info.Mode().IsRegular():
+		return nil
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Nlink > 1 {
+		if first, ok := links[stat.Ino]; ok {
+			return os.Link(first, dst)
+		}
+		links[stat.Ino] = dst
+	}
+
+	sum, err := copyHashed(src, dst, info)
+	if err != nil {
+		os.Remove(dst)
+		return err
+	}
+	if want != "" && sum != want {
+		os.Remove(dst)
+		return fmt.Errorf("prüfsumme %s passt nicht zum Katalog, das Archiv war schon vorher beschädigt (scrub)", sum[:12])
+	}
+	copied, err := hashFile(dst)
+	if err != nil {
+		return err
+	}
+	if copied != sum {
+		os.Remove(dst)
+		return fmt.Errorf("kopie am Ziel weicht ab")
+	}
+	return nil
+}
+
+// copyHashed kopiert eine Datei samt Rechten und Zeit und liefert die Prüfsumme der Quelle
+func copyHashed(src, dst string, info os.FileInfo) (string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(out, hash), in); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	os.Chtimes(dst, info.ModTime(), info.ModTime())
+	if err := os.Chmod(dst, info.Mode().Perm()); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
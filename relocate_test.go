@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRelocateRemovesOnlyCopiedFiles(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "backups")
+	target := filepath.Join(t.TempDir(), "neu")
+	files := map[string]string{
+		"p_backup_1.tar.gz":            "archiv",
+		"p/p_backup_2.tar.gz":          "archiv 2",
+		"p_backup_3.tar.gz.part":       "halb",
+		"p_backup_4.tar.gz.tmp":        "halb",
+		catalogFileName + ".lock":      "",
+		"p/" + stateFileName + ".lock": "",
+	}
+	for name, body := range files {
+		path := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := relocateTree(root, target, false, false); err != nil {
+		t.Fatal(err)
+	}
+	for name, body := range files {
+		_, errOld := os.Stat(filepath.Join(root, name))
+		data, errNew := os.ReadFile(filepath.Join(target, name))
+		if relocateSkipped(name) {
+			if errOld != nil || errNew == nil {
+				t.Errorf("%s: nicht umzuziehende Datei gelöscht oder kopiert (%v, %v)", name, errOld, errNew)
+			}
+			continue
+		}
+		if !os.IsNotExist(errOld) || errNew != nil || string(data) != body {
+			t.Errorf("%s: Quelle %v, Ziel %q (%v)", name, errOld, data, errNew)
+		}
+	}
+}
+
+func TestRelocateRefusesRunningBackup(t *testing.T) {
+	root := t.TempDir()
+	project := filepath.Join(root, "p")
+	os.Mkdir(project, 0755)
+	run := RunState{RunID: "abcd", Result: "running", Started: time.Now().UTC(), PID: os.Getpid()}
+	if err := saveRunState(project, "p", run); err != nil {
+		t.Fatal(err)
+	}
+	dirs := relocateDirs(root)
+	if len(dirs) != 2 {
+		t.Fatalf("Verzeichnisse %q", dirs)
+	}
+	err := withRelocateLocks(dirs, func() error { return checkNoRunningBackup(dirs) })
+	if err == nil {
+		t.Error("Umzug trotz laufendem Backup erlaubt")
+	}
+	run.Result = "success"
+	saveRunState(project, "p", run)
+	if err := checkNoRunningBackup(dirs); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,496 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// remoteDir ist ein entferntes Backup-Ziel, das als Verzeichnis eingebunden ist
+// (NAS-Freigabe, SSHFS, externe Platte). Es hat denselben Aufbau wie das lokale
+// Backup-Verzeichnis: Archive, Manifeste und catalog.json.
+type remoteDir struct {
+	root string
+	// appendOnly: nur neue Dateien anlegen, nichts überschreiben oder löschen. Katalogeinträge
+	// landen dann einzeln in catalog.d, aufgeräumt wird getrennt mit "prune --remote".
+	appendOnly bool
+}
+
+func openRemote(config *Config) (*remoteDir, error) {
+	if config.Remote == "" {
+		return nil, fmt.Errorf("kein Remote-Ziel konfiguriert (Remote in config.json)")
+	}
+	info, err := os.Stat(config.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("remote-Ziel %s nicht erreichbar: %v", config.Remote, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("remote-Ziel %s ist kein Verzeichnis", config.Remote)
+	}
+	return &remoteDir{root: config.Remote, appendOnly: config.RemoteAppendOnly}, nil
+}
+
+func (r *remoteDir) path(name string) string {
+	return filepath.Join(r.root, name)
+}
+
+// put schreibt eine Datei erst unter temporärem Namen, damit auf dem Ziel nie halbe Dateien liegen
+func (r *remoteDir) put(name string, src io.Reader) error {
+	if err := r.checkNew(name); err != nil {
+		return err
+	}
+	tmp := r.path(name + ".part")
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, src); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, r.path(name))
+}
+
+// checkNew verhindert im Modus appendOnly, dass eine vorhandene Datei ersetzt wird
+func (r *remoteDir) checkNew(name string) error {
+	if !r.appendOnly {
+		return nil
+	}
+	if _, err := os.Lstat(r.path(name)); err == nil {
+		return fmt.Errorf("%s existiert bereits auf dem Remote-Ziel (RemoteAppendOnly)", name)
+	}
+	return nil
+}
+
+// addEntry trägt ein Backup in den entfernten Katalog ein
+func (r *remoteDir) addEntry(entry CatalogEntry) error {
+	if r.appendOnly {
+		return addCatalogEntryFile(r.root, entry)
+	}
+	return withLease(r.root, func() error {
+		return updateCatalog(r.root, func(c *Catalog) {
+			c.add(entry)
+		})
+	})
+}
+
+func (r *remoteDir) putFile(localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return r.put(filepath.Base(localPath), f)
+}
+
+// uploadBackup überträgt ein Archiv samt Manifest auf das Remote-Ziel und trägt es
+// dort in den Katalog ein
+func uploadBackup(config *Config, backupFile string, entry CatalogEntry) error {
+	remote, err := openRemote(config)
+	if err != nil {
+		return err
+	}
+	limit, err := bandwidthLimit(config, "")
+	if err != nil {
+		return err
+	}
+	logMessage(LogInfo, "Übertrage %s nach %s...", filepath.Base(backupFile), remote.root)
+	if err := remote.checkNew(filepath.Base(backupFile)); err != nil {
+		return err
+	}
+	check := func(part string) error {
+		return verifyUpload(config.RemoteVerify, backupFile, part, entry.SHA256)
+	}
+	if err := resumableCopy(backupFile, remote.path(filepath.Base(backupFile)), limit, check); err != nil {
+		return err
+	}
+	// Das Manifest nennt alle Dateinamen im Klartext und bleibt bei verschlüsselten Archiven lokal
+	if _, err := os.Stat(manifestPath(backupFile)); err == nil && !entry.Encrypted {
+		if err := remote.putFile(manifestPath(backupFile)); err != nil {
+			return err
+		}
+	}
+	// Die Bestätigung enthält keine Dateinamen und begleitet das Archiv immer
+	if _, err := os.Stat(attestationPath(backupFile)); err == nil {
+		if err := remote.putFile(attestationPath(backupFile)); err != nil {
+			return err
+		}
+	}
+	return remote.addEntry(entry)
+}
+
+// Stichproben der Prüfung "sample": Anfang, Ende und dazwischen zufällig verteilte Bereiche
+const (
+	verifySamples    = 16
+	verifySampleSize = 64 << 10
+)
+
+// verifyUpload vergleicht die Kopie auf dem Remote-Ziel mit dem lokalen Archiv, bevor
+// sie unter ihrem endgültigen Namen erscheint. "full" liest die Kopie ganz und vergleicht
+// die Prüfsumme, "sample" (Standard) nur Größe und einzelne Bereiche, "off" prüft nicht.
+// Netzlaufwerke liefern die Daten dabei möglicherweise aus dem lokalen Zwischenspeicher.
+func verifyUpload(mode, local, copied, sum string) error {
+	switch mode {
+	case "off":
+		return nil
+	case "full":
+		if sum == "" {
+			var err error
+			if sum, err = hashFile(local); err != nil {
+				return err
+			}
+		}
+		remoteSum, err := hashFile(copied)
+		if err != nil {
+			return fmt.Errorf("remote-Kopie nicht lesbar: %v", err)
+		}
+		if remoteSum != sum {
+			return fmt.Errorf("prüfsumme der remote-Kopie weicht ab (%s statt %s)", remoteSum, sum)
+		}
+		logMessage(LogInfo, "Remote-Kopie geprüft: SHA256 stimmt überein")
+		return nil
+	}
+
+	a, err := os.Open(local)
+	if err != nil {
+		return err
+	}
+	defer a.Close()
+	b, err := os.Open(copied)
+	if err != nil {
+		return fmt.Errorf("remote-Kopie nicht lesbar: %v", err)
+	}
+	defer b.Close()
+	localInfo, err := a.Stat()
+	if err != nil {
+		return err
+	}
+	remoteInfo, err := b.Stat()
+	if err != nil {
+		return err
+	}
+	size := localInfo.Size()
+	if remoteInfo.Size() != size {
+		return fmt.Errorf("remote-Kopie hat %d statt %d Bytes", remoteInfo.Size(), size)
+	}
+	offsets := []int64{0, max(0, size-verifySampleSize)}
+	for i := 2; i < verifySamples && size > verifySampleSize; i++ {
+		offsets = append(offsets, rand.Int63n(size-verifySampleSize))
+	}
+	bufA, bufB := make([]byte, verifySampleSize), make([]byte, verifySampleSize)
+	for _, offset := range offsets {
+		n, err := a.ReadAt(bufA, offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if _, err := b.ReadAt(bufB[:n], offset); err != nil && err != io.EOF {
+			return fmt.Errorf("remote-Kopie nicht lesbar: %v", err)
+		}
+		if !bytes.Equal(bufA[:n], bufB[:n]) {
+			return fmt.Errorf("remote-Kopie weicht ab Byte %d vom lokalen Archiv ab", offset)
+		}
+	}
+	logMessage(LogDebug, "Remote-Kopie geprüft: %d Stichproben stimmen überein", len(offsets))
+	return nil
+}
+
+// runSyncMetadata kopiert Katalog und Manifeste auf das Remote-Ziel, damit ein anderer
+// Rechner Backups auflisten kann, ohne Archive herunterzuladen
+func runSyncMetadata(args []string) error {
+	flags := flag.NewFlagSet("sync-metadata", flag.ExitOnError)
+	flags.Parse(args)
+
+	config, _, _, err := loadProject()
+	if err != nil {
+		return err
+	}
+	remote, err := openRemote(config)
+	if err != nil {
+		return err
+	}
+
+	local, err := loadCatalog(config.BackupDir)
+	if err != nil {
+		return err
+	}
+	private := make(map[string]bool)
+	for _, entry := range local.Backups {
+		if entry.Encrypted {
+			private[manifestPath(filepath.Join(config.BackupDir, entry.File))] = true
+		}
+	}
+	all, err := filepath.Glob(filepath.Join(config.BackupDir, "*.manifest.json"))
+	if err != nil {
+		return err
+	}
+	var manifests []string
+	for _, manifest := range all {
+		if !private[manifest] {
+			manifests = append(manifests, manifest)
+		}
+	}
+	for _, manifest := range manifests {
+		if remote.appendOnly && remote.checkNew(filepath.Base(manifest)) != nil {
+			continue
+		}
+		if err := remote.putFile(manifest); err != nil {
+			return fmt.Errorf("fehler beim Übertragen von %s: %v", filepath.Base(manifest), err)
+		}
+	}
+
+	// Einträge anderer Rechner im entfernten Katalog bleiben erhalten
+	if remote.appendOnly {
+		existing, err := loadCatalog(remote.root)
+		if err != nil {
+			return err
+		}
+		for _, entry := range local.Backups {
+			if _, ok := existing.find(entry.File); ok {
+				continue
+			}
+			if err := remote.addEntry(entry); err != nil {
+				return fmt.Errorf("fehler beim Übertragen des Katalogs: %v", err)
+			}
+		}
+	} else {
+		err = withLease(remote.root, func() error {
+			return updateCatalog(remote.root, func(c *Catalog) {
+				for _, entry := range local.Backups {
+					c.add(entry)
+				}
+			})
+		})
+		if err != nil {
+			return fmt.Errorf("fehler beim Übertragen des Katalogs: %v", err)
+		}
+	}
+
+	fmt.Printf("✓ Katalog (%d Einträge) und %d Manifeste nach %s übertragen\n", len(local.Backups), len(manifests), remote.root)
+	return nil
+}
+
+// runList listet die Backups des Projekts laut lokalem oder entferntem Katalog
+func runList(args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	fromRemote := flags.Bool("remote", false, "Katalog des Remote-Ziels verwenden")
+	all := flags.Bool("all", false, "Backups aller Projekte anzeigen")
+	contents := flags.Bool("contents", false, "Inhalt eines Archivs anzeigen (Standard: neuestes Backup)")
+	flags.Parse(args)
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	dir := config.BackupDir
+	if *fromRemote {
+		remote, err := openRemote(config)
+		if err != nil {
+			return err
+		}
+		dir = remote.root
+	}
+
+	if *contents {
+		archive, err := selectBackup(dir, projectName, "", flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		return listContents(archive)
+	}
+
+	catalog, err := loadCatalog(dir)
+	if *all && !*fromRemote && config.Layout == "project" {
+		catalog, err = loadLayoutCatalogs(config.backupRoot)
+	}
+	if err != nil {
+		return err
+	}
+
+	var entries []CatalogEntry
+	if *all {
+		projects := make(map[string]bool)
+		for _, entry := range catalog.Backups {
+			if !projects[entry.Project] {
+				projects[entry.Project] = true
+				entries = append(entries, catalog.forProject(entry.Project)...)
+			}
+		}
+	} else {
+		entries = catalog.forProject(projectName)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("Keine Backups im Katalog von %s\n", dir)
+		return nil
+	}
+
+	var totalSize int64
+	for _, entry := range entries {
+		totalSize += entry.Size
+		details := []string{formatSize(entry.Size)}
+		if entry.Tag != "" {
+			details = append(details, entry.Tag)
+		}
+		if entry.Git != nil {
+			details = append(details, entry.Git.String())
+		}
+		if entry.SameAs != "" {
+			details = append(details, "identisch mit "+entry.SameAs)
+		}
+		fmt.Printf("%-12s %s vom %s (%s)\n", entry.Project, entry.File,
+			formatDateTime(entry.Created), strings.Join(details, ", "))
+	}
+	fmt.Printf("\nGesamtanzahl Backups: %d\nGesamtgröße: %s\n", len(entries), formatSize(totalSize))
+	return nil
+}
+
+// downloadBackup holt ein Archiv samt Manifest vom Remote-Ziel in das lokale Backup-Verzeichnis.
+// Abgebrochene Übertragungen werden beim nächsten Aufruf fortgesetzt.
+func downloadBackup(remote *remoteDir, file, localDir string, limit int64) (string, error) {
+	target := filepath.Join(localDir, file)
+	if _, err := os.Stat(target); err == nil {
+		logMessage(LogInfo, "%s liegt bereits lokal vor", file)
+		return target, nil
+	}
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return "", err
+	}
+
+	logMessage(LogInfo, "Lade %s von %s...", file, remote.root)
+	// Mit der Prüfsumme aus dem Katalog fällt auch eine unbemerkt abweichende Teildatei auf
+	var check func(part string) error
+	if catalog, err := loadCatalog(remote.root); err == nil {
+		if entry, ok := catalog.find(file); ok && entry.SHA256 != "" {
+			check = func(part string) error {
+				sum, err := hashFile(part)
+				if err != nil {
+					return err
+				}
+				if sum != entry.SHA256 {
+					return fmt.Errorf("prüfsumme von %s weicht vom Katalog ab (%s statt %s)", file, sum, entry.SHA256)
+				}
+				return nil
+			}
+		}
+	}
+	if err := resumableCopy(remote.path(file), target, limit, check); err != nil {
+		return "", err
+	}
+	manifest := filepath.Base(manifestPath(target))
+	if _, err := os.Stat(remote.path(manifest)); err == nil {
+		os.Remove(manifestPath(target))
+		if err := copyFile(remote.path(manifest), manifestPath(target)); err != nil {
+			logMessage(LogWarning, "Manifest konnte nicht geladen werden: %v", err)
+		}
+	}
+	return target, nil
+}
+
+// runFetch lädt das neueste Backup eines Projekts vom Remote-Ziel und stellt es in
+// einem neuen Verzeichnis wieder her
+func runFetch(args []string) error {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	to := flags.String("to", "", "Zielverzeichnis (Standard: ./<projekt>)")
+	limitFlag := flags.String("limit", "", "Höchstgeschwindigkeit pro Sekunde, z.B. 2MB (Standard: BandwidthLimit aus config.json)")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("verwendung: backup-tool fetch [--to verzeichnis] <projekt>")
+	}
+	projectName := flags.Arg(0)
+
+	config, _, _, err := loadProject()
+	if err != nil {
+		return err
+	}
+	remote, err := openRemote(config)
+	if err != nil {
+		return err
+	}
+	limit, err := bandwidthLimit(config, *limitFlag)
+	if err != nil {
+		return err
+	}
+
+	targetDir := *to
+	if targetDir == "" {
+		targetDir = projectName
+	}
+	targetDir, err = filepath.Abs(targetDir)
+	if err != nil {
+		return err
+	}
+	if entries, err := os.ReadDir(targetDir); err == nil && len(entries) > 0 {
+		return fmt.Errorf("%s existiert bereits und ist nicht leer", targetDir)
+	}
+
+	catalog, err := loadCatalog(remote.root)
+	if err != nil {
+		return err
+	}
+	entries := catalog.forProject(projectName)
+	if len(entries) == 0 {
+		return fmt.Errorf("keine Backups von %s auf %s gefunden (sync-metadata ausgeführt?)", projectName, remote.root)
+	}
+	latest := entries[len(entries)-1]
+	logMessage(LogInfo, "Neuestes Backup: %s vom %s", latest.archiveFile(), formatDateTime(latest.Created))
+
+	backupFile, err := downloadBackup(remote, latest.archiveFile(), config.BackupDir, limit)
+	if err != nil {
+		return fmt.Errorf("fehler beim Herunterladen: %v", err)
+	}
+	err = updateCatalog(config.BackupDir, func(c *Catalog) {
+		entry := latest
+		entry.SameAs = ""
+		entry.File = latest.archiveFile()
+		c.add(entry)
+	})
+	if err != nil {
+		logMessage(LogWarning, "Konnte Backup nicht im Katalog vermerken: %v", err)
+	}
+
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return err
+	}
+	// Das Ziel ist neu, es gibt nichts zu überschreiben
+	return restoreBackup(backupFile, projectName, targetDir, extractOptions{}, true)
+}
+
+// bandwidthLimit liefert die Übertragungsgrenze in Bytes pro Sekunde; der Wert des
+// Kommandozeilenparameters hat Vorrang vor der Konfiguration
+func bandwidthLimit(config *Config, flagValue string) (int64, error) {
+	if flagValue != "" {
+		return parseSize(flagValue)
+	}
+	return parseSize(config.BandwidthLimit)
+}
+
+// listContents zeigt die Einträge eines Archivs ähnlich wie tar -tv
+func listContents(archivePath string) error {
+	count := 0
+	err := walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+		name := header.Name
+		if header.Linkname != "" {
+			name += " -> " + header.Linkname
+		}
+		fmt.Printf("%s %10s %s %s\n", header.FileInfo().Mode(), formatSize(header.Size),
+			formatDateTime(header.ModTime), name)
+		count++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fehler beim Lesen von %s: %v", archivePath, err)
+	}
+	fmt.Printf("\n%d Einträge in %s\n", count, filepath.Base(archivePath))
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runRepack komprimiert vorhandene Archive neu, z.B. um Jahre alter gzip-Archive auf zstd
+// umzustellen. Der tar-Strom bleibt Byte für Byte erhalten, damit auch Rechte, Zeiten
+// und Besitzer unverändert sind; das neue Archiv ersetzt das alte erst, wenn sein
+// entpackter Inhalt übereinstimmt. Katalog und Manifest werden angepasst.
+func runRepack(args []string) error {
+	flags := flag.NewFlagSet("repack", flag.ExitOnError)
+	compressionName := flags.String("compression", "", "neue Kompression (Standard: Compression aus config.json)")
+	levelFlag := flags.Int("level", 0, "Kompressionsstufe (Standard: Standardstufe der Kompression)")
+	all := flags.Bool("all", false, "alle Archive des Projekts mit anderer Kompression umpacken")
+	passwordEnv := flags.String("new-password-env", "", "7z: neues Passwort aus dieser Umgebungsvariable; gelesen wird mit BACKUP_7Z_PASSWORD")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Verwendung: backup-tool repack [--compression NAME] [--level N] [--all | BACKUP...]")
+		flags.PrintDefaults()
+	}
+	// Optionen dürfen auch hinter den Archiven stehen
+	var backups []string
+	for flags.Parse(args); flags.NArg() > 0; flags.Parse(args) {
+		backups = append(backups, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+	if len(backups) == 0 && !*all {
+		flags.Usage()
+		return fmt.Errorf("kein Backup angegeben")
+	}
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if *compressionName == "" {
+		*compressionName = config.Compression
+	}
+	format, err := compressionByName(*compressionName)
+	if err != nil {
+		return err
+	}
+	if err := format.available(); err != nil {
+		return err
+	}
+	level, err := format.level(*levelFlag)
+	if err != nil {
+		return err
+	}
+	if *passwordEnv != "" {
+		if format.Name != "7z" {
+			return fmt.Errorf("--new-password-env gibt es nur für die Kompression 7z")
+		}
+		if os.Getenv(*passwordEnv) == "" {
+			return fmt.Errorf("umgebungsvariable %s ist leer", *passwordEnv)
+		}
+	}
+
+	// Gelesen wird jedes Archiv mit dem alten, geschrieben mit dem neuen Passwort
+	oldPassword, newPassword := sevenZipPassword(), sevenZipPassword()
+	if *passwordEnv != "" {
+		newPassword = os.Getenv(*passwordEnv)
+	}
+
+	catalog, err := loadCatalog(config.BackupDir)
+	if err != nil {
+		return err
+	}
+	if *all {
+		for _, entry := range catalog.forProject(projectName) {
+			if entry.SameAs != "" || entry.File == "" || entry.Compression == "zip" || entry.Compression == "snapshot" {
+				continue
+			}
+			if entry.Compression != format.Name || *passwordEnv != "" {
+				backups = append(backups, entry.File)
+			}
+		}
+	}
+
+	repacked := 0
+	var sizeBefore, sizeAfter int64
+	for _, backup := range backups {
+		path, err := selectBackup(config.BackupDir, projectName, "", backup)
+		if err != nil {
+			return err
+		}
+		if isSnapshot(path) || isZipFile(path) {
+			return fmt.Errorf("%s: nur tar-Archive lassen sich umpacken", filepath.Base(path))
+		}
+		before, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		target, err := repackArchive(path, format, level, oldPassword, newPassword)
+		if err != nil {
+			return fmt.Errorf("fehler beim Umpacken von %s: %v", filepath.Base(path), err)
+		}
+		after, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		if err := updateRepacked(config.BackupDir, path, target, format, format.Name == "7z" && newPassword != ""); err != nil {
+			return err
+		}
+		if err := reattest(config, path, target); err != nil {
+			logMessage(LogWarning, "%s: %v", filepath.Base(target), err)
+		}
+		sizeBefore += before.Size()
+		sizeAfter += after.Size()
+		repacked++
+		fmt.Printf("%s -> %s (%s -> %s)\n", filepath.Base(path), filepath.Base(target), formatSize(before.Size()), formatSize(after.Size()))
+	}
+	fmt.Fprintln(os.Stderr, colorize(colorGreen, fmt.Sprintf("✓ %d Archive mit %s (Stufe %d) neu komprimiert, %s statt %s",
+		repacked, format.Name, level, formatSize(sizeAfter), formatSize(sizeBefore))))
+	if config.Remote != "" && repacked > 0 {
+		fmt.Fprintln(os.Stderr, "Kopien auf dem Remote-Ziel bleiben unverändert")
+	}
+	return nil
+}
+
+// repackArchive schreibt den tar-Strom von path mit format neu und liefert den Pfad des
+// neuen Archivs; das alte ist danach gelöscht. 7z-Archive werden mit oldPassword gelesen
+// und mit newPassword geschrieben.
+func repackArchive(path string, format *compressionFormat, level int, oldPassword, newPassword string) (string, error) {
+	source, err := compressedFileWithPassword(path, oldPassword)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+
+	// Bei gleicher Endung hätten altes und neues Archiv denselben Namen; 7z leitet den
+	// inneren Namen aus dem Dateinamen ab, daher ein eigenes Verzeichnis statt .tmp
+	name := strings.TrimSuffix(filepath.Base(path), archiveExtension(path)) + format.Extension
+	target := filepath.Join(filepath.Dir(path), name)
+	tmpDir, err := os.MkdirTemp(filepath.Dir(path), ".repack-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+	tmp := filepath.Join(tmpDir, name)
+
+	out, err := format.createWithPassword(tmp, level, newPassword)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(out, io.TeeReader(source, hash)); err != nil {
+		abortWriter(out)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	if err := source.Close(); err != nil {
+		return "", err
+	}
+
+	// Den entpackten Inhalt des neuen Archivs mit dem alten vergleichen
+	check, err := compressedFileWithPassword(tmp, newPassword)
+	if err != nil {
+		return "", err
+	}
+	defer check.Close()
+	checkHash := sha256.New()
+	if _, err := io.Copy(checkHash, check); err != nil {
+		return "", fmt.Errorf("neues Archiv nicht lesbar: %v", err)
+	}
+	if !bytes.Equal(checkHash.Sum(nil), hash.Sum(nil)) {
+		return "", fmt.Errorf("inhalt des neuen Archivs weicht ab")
+	}
+
+	// Die Aufbewahrung sortiert nach Änderungszeit, sie muss die des Backups bleiben
+	if info, err := os.Stat(path); err == nil {
+		os.Chtimes(tmp, info.ModTime(), info.ModTime())
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return "", err
+	}
+	if target != path {
+		if err := os.Remove(path); err != nil {
+			return "", err
+		}
+	}
+	audit("repack", target, "neu komprimiert aus "+filepath.Base(path))
+	return target, nil
+}
+
+// updateRepacked trägt das neue Archiv in Katalog und Manifest ein; Markierungen, die auf
+// das alte verweisen, zeigen danach auf das neue
+func updateRepacked(backupDir, oldPath, newPath string, format *compressionFormat, encrypted bool) error {
+	oldFile, newFile := filepath.Base(oldPath), filepath.Base(newPath)
+	sum, err := hashFile(newPath)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(newPath)
+	if err != nil {
+		return err
+	}
+	if manifest, err := loadManifest(newPath); err == nil {
+		manifest.Archive = newFile
+		if err := saveManifest(newPath, manifest); err != nil {
+			return err
+		}
+	}
+	return updateCatalog(backupDir, func(c *Catalog) {
+		for i, entry := range c.Backups {
+			if entry.SameAs == oldFile {
+				c.Backups[i].SameAs = newFile
+			}
+			if entry.File != oldFile {
+				continue
+			}
+			c.Backups[i].File = newFile
+			c.Backups[i].Size = info.Size()
+			c.Backups[i].Compression = format.Name
+			c.Backups[i].Encrypted = encrypted
+			c.Backups[i].SHA256 = sum
+		}
+	})
+}
+
+// reattest ersetzt die Bestätigung des alten Archivs; ohne Schlüssel entfällt sie, denn
+// die Prüfsumme darin gilt nicht mehr
+func reattest(config *Config, oldPath, newPath string) error {
+	if _, err := os.Stat(attestationPath(oldPath)); err != nil {
+		return nil
+	}
+	os.Remove(attestationPath(oldPath))
+	if config.AttestationKey == "" {
+		return fmt.Errorf("bestätigung entfernt, zum neuen Signieren fehlt AttestationKey")
+	}
+	manifest, err := loadManifest(newPath)
+	if err != nil {
+		return fmt.Errorf("bestätigung entfernt, Manifest fehlt: %v", err)
+	}
+	sum, err := hashFile(newPath)
+	if err != nil {
+		return err
+	}
+	return writeAttestation(config.AttestationKey, newPath, manifest, sum)
+}
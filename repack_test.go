@@ -0,0 +1,71 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Ein Ersatz für 7z, der das Passwort jedes Aufrufs festhält und den Inhalt nur mit der
+// 7z-Kennung versieht
+const fake7zArchiver = `#!/bin/sh
+read -r pw
+echo "$1 $pw" >> "$FAKE_DIR/log"
+for last; do archive=$prev; prev=$last; done
+case "$1" in
+a) printf '\067\172\274\257\047\034' > "$archive"; cat "$last" >> "$archive" ;;
+e) tail -c +7 "$last" ;;
+esac
+`
+
+func TestRepackKeepsPasswordsPerArchive(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "7z"), []byte(fake7zArchiver), 0755); err != nil {
+		t.Fatal(err)
+	}
+	fakeDir := t.TempDir()
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("FAKE_DIR", fakeDir)
+	t.Setenv("BACKUP_7Z_PASSWORD", "alt")
+
+	format, err := compressionByName("7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	var archives []string
+	for _, name := range []string{"p_backup_1.tar.7z", "p_backup_2.tar.7z"} {
+		path := filepath.Join(dir, name)
+		w, err := format.create(path, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, "tar-strom "+name)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		archives = append(archives, path)
+	}
+	os.Remove(filepath.Join(fakeDir, "log"))
+
+	for _, path := range archives {
+		if _, err := repackArchive(path, format, 5, "alt", "neu"); err != nil {
+			t.Fatalf("%s: %v", filepath.Base(path), err)
+		}
+	}
+	if got := os.Getenv("BACKUP_7Z_PASSWORD"); got != "alt" {
+		t.Errorf("BACKUP_7Z_PASSWORD nach dem Umpacken %q", got)
+	}
+	log, _ := os.ReadFile(filepath.Join(fakeDir, "log"))
+	// Je Archiv: mit dem alten Passwort lesen, mit dem neuen schreiben und prüfen; Lesen
+	// und Schreiben laufen gleichzeitig, daher ohne feste Reihenfolge
+	calls := strings.Fields(strings.ReplaceAll(string(log), " ", "-"))
+	sort.Strings(calls)
+	want := []string{"a-neu", "a-neu", "e-alt", "e-alt", "e-neu", "e-neu"}
+	if strings.Join(calls, " ") != strings.Join(want, " ") {
+		t.Errorf("Aufrufe von 7z: %q, erwartet %q", calls, want)
+	}
+}
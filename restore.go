@@ -0,0 +1,999 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Akzeptierte Formate für restore --at, jeweils in der Zeitzone der Anzeige (TimeZone)
+var restoreTimeLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+	time.RFC3339,
+}
+
+func parseRestoreTime(value string) (time.Time, error) {
+	for _, layout := range restoreTimeLayouts {
+		t, err := time.ParseInLocation(layout, value, displayLocation)
+		if err == nil {
+			// Ein reines Datum meint das Ende des Tages
+			if !strings.Contains(layout, "15") && layout != time.RFC3339 {
+				t = t.Add(24*time.Hour - time.Second)
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unbekanntes Zeitformat: %q (erwartet z.B. \"2024-05-01 13:00\")", value)
+}
+
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	at := flags.String("at", "", "neuestes Backup zu oder vor diesem Zeitpunkt wiederherstellen (z.B. \"2024-05-01 13:00\")")
+	subtree := flags.String("path", "", "nur diesen Teilbaum des Archivs wiederherstellen (z.B. src/parser)")
+	to := flags.String("to", "", "Zielverzeichnis (Standard: Projektverzeichnis)")
+	strip := flags.Int("strip", -1, "Anzahl führender Pfadkomponenten, die entfernt werden (Standard: bei --path und --to die Komponenten von --path)")
+	yes := flags.Bool("yes", false, "ohne Rückfrage wiederherstellen")
+	sanitize := flags.Bool("sanitize-names", false, "unter Windows unzulässige Namen beim Wiederherstellen immer umbenennen")
+	normalize := flags.String("normalize", "", "Unicode-Form der wiederhergestellten Namen: nfc (Linux, Windows) oder nfd (macOS)")
+	caseConflicts := flags.String("case-conflicts", "", "Namen, die sich nur in Groß-/Kleinschreibung unterscheiden: rename, skip oder overwrite (Standard: rename, wenn das Ziel sie nicht unterscheidet)")
+	preserveOwner := flags.Bool("preserve-owner", false, "Besitzer aus dem Archiv übernehmen; unbekannte Benutzer werden dem aktuellen Benutzer zugeordnet")
+	noPreservePerms := flags.Bool("no-preserve-perms", false, "Zugriffsrechte aus dem Archiv ignorieren und die umask verwenden")
+	fromRemote := flags.Bool("remote", false, "Backup vom Remote-Ziel herunterladen (abgebrochene Downloads werden fortgesetzt)")
+	limitFlag := flags.String("limit", "", "Höchstgeschwindigkeit beim Herunterladen pro Sekunde, z.B. 2MB")
+	stream := flags.Bool("stream", false, "mit --remote direkt vom Remote-Ziel entpacken, ohne das Archiv herunterzuladen")
+	flags.Parse(args)
+
+	*normalize = strings.ToLower(*normalize)
+	if *normalize != "" && !containsString(normalizationForms, *normalize) {
+		return fmt.Errorf("ungültige Normalisierung %q (nfc oder nfd)", *normalize)
+	}
+	if *caseConflicts != "" && !containsString([]string{"rename", "skip", "overwrite"}, *caseConflicts) {
+		return fmt.Errorf("ungültiger Wert für --case-conflicts: %q (rename, skip oder overwrite)", *caseConflicts)
+	}
+
+	config, sourceDir, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+
+	if *stream && !*fromRemote {
+		return fmt.Errorf("--stream gibt es nur zusammen mit --remote")
+	}
+	if *stream && *limitFlag != "" {
+		return fmt.Errorf("--limit gilt nur für das Herunterladen, nicht für --stream")
+	}
+
+	var backupFile string
+	var planManifest *Manifest
+	if *stream {
+		backupFile, planManifest, err = streamRemoteBackup(config, projectName, *at, flags.Arg(0))
+		if err == errNoStream {
+			backupFile, err = fetchRemoteBackup(config, projectName, *at, flags.Arg(0), *limitFlag)
+		}
+	} else if *fromRemote {
+		backupFile, err = fetchRemoteBackup(config, projectName, *at, flags.Arg(0), *limitFlag)
+	} else {
+		backupFile, err = selectBackup(config.BackupDir, projectName, *at, flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	if planManifest != nil && planManifest.Entries == nil {
+		// Älteres Manifest ohne Verzeichnisse und Links: Vorschau und Namen aus dem Archiv
+		logMessage(LogInfo, "Manifest ohne Verzeichnisse und Links, das Archiv wird vorab einmal zusätzlich gelesen")
+		planManifest = nil
+	}
+
+	targetDir := sourceDir
+	if *to != "" {
+		targetDir, err = filepath.Abs(*to)
+		if err != nil {
+			return err
+		}
+	}
+
+	opts := extractOptions{
+		Subtree:       cleanArchivePath(*subtree),
+		Strip:         *strip,
+		SanitizeNames: *sanitize,
+		Normalize:     *normalize,
+		CaseConflicts: *caseConflicts,
+		PreserveOwner: *preserveOwner,
+		IgnorePerms:   *noPreservePerms,
+		planManifest:  planManifest,
+	}
+	if opts.Strip < 0 {
+		opts.Strip = 0
+		// Mit eigenem Ziel landet der Inhalt von --path direkt im Zielverzeichnis
+		if *to != "" && opts.Subtree != "" {
+			opts.Strip = len(strings.Split(opts.Subtree, "/"))
+		}
+	}
+
+	return restoreBackup(backupFile, projectName, targetDir, opts, *yes)
+}
+
+// restoreBackup zeigt die Vorschau, fragt (außer bei yes) nach und stellt das Archiv wieder her
+func restoreBackup(backupFile, projectName, targetDir string, opts extractOptions, yes bool) error {
+	meta, err := checkArchiveFormat(backupFile)
+	if err != nil {
+		return err
+	}
+	if meta.FormatVersion > 1 {
+		logMessage(LogInfo, "Archiv von backup-tool %s (Format %d), erstellt am %s auf %s",
+			meta.ToolVersion, meta.FormatVersion, formatDateTime(meta.Created), meta.Host)
+	}
+	if meta.Git != nil {
+		logMessage(LogInfo, "Stand des Repositorys: %s", meta.Git)
+	}
+
+	if err := prepareRestoreNames(backupFile, targetDir, &opts); err != nil {
+		return fmt.Errorf("fehler beim Lesen des Archivs: %v", err)
+	}
+
+	var plan *restorePlan
+	if opts.planManifest != nil {
+		plan, err = planFromManifest(opts.planManifest, targetDir, opts)
+	} else {
+		plan, err = planRestore(backupFile, targetDir, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("fehler beim Lesen des Archivs: %v", err)
+	}
+	if plan.Files+plan.Others == 0 && opts.Subtree != "" {
+		return fmt.Errorf("%s ist im Archiv nicht enthalten", opts.Subtree)
+	}
+	printRestorePlan(plan, targetDir)
+	if !yes && !confirm("Wiederherstellung starten?") {
+		return fmt.Errorf("abgebrochen")
+	}
+
+	logMessage(LogInfo, "Stelle %s nach %s wieder her", filepath.Base(backupFile), targetDir)
+	if len(plan.Overwritten) > 0 {
+		audit("restore-overwrite", targetDir, "aus "+filepath.Base(backupFile), plan.Overwritten...)
+	}
+	result, err := extractArchive(backupFile, targetDir, opts)
+	if err != nil {
+		return fmt.Errorf("fehler beim Wiederherstellen: %v", err)
+	}
+	fmt.Printf("✓ %d Einträge aus %s wiederhergestellt\n", result.Count, filepath.Base(backupFile))
+	printExtractReport(result)
+
+	return verifyRestore(backupFile, projectName, targetDir, opts, result)
+}
+
+func printExtractReport(result *extractResult) {
+	if len(result.Renamed) > 0 {
+		originals := make([]string, 0, len(result.Renamed))
+		for original := range result.Renamed {
+			originals = append(originals, original)
+		}
+		sort.Strings(originals)
+		renamed := make([]string, len(originals))
+		for i, original := range originals {
+			renamed[i] = fmt.Sprintf("%q -> %q", original, result.Renamed[original])
+		}
+		logMessage(LogWarning, "%d Einträge mussten umbenannt werden:%s", len(result.Renamed), problemList(renamed))
+	}
+	if len(result.Skipped) > 0 {
+		skipped := make([]string, len(result.Skipped))
+		for i, name := range result.Skipped {
+			skipped[i] = fmt.Sprintf("%q", name)
+		}
+		logMessage(LogWarning, "%d Einträge konnten nicht angelegt werden und wurden übersprungen:%s", len(result.Skipped), problemList(skipped))
+	}
+}
+
+// verifyRestore vergleicht die wiederhergestellten Dateien mit den Prüfsummen aus dem Manifest
+func verifyRestore(backupFile, projectName, targetDir string, opts extractOptions, result *extractResult) error {
+	logMessage(LogInfo, "Verifiziere wiederhergestellte Dateien...")
+	manifest, err := loadManifest(backupFile)
+	if err != nil {
+		// Ältere Backups haben kein Manifest, dann dient das Archiv selbst als Referenz
+		logMessage(LogWarning, "Kein Manifest gefunden (%v), berechne Prüfsummen aus dem Archiv", err)
+		manifest, err = buildManifest(backupFile, projectName)
+		if err != nil {
+			return fmt.Errorf("fehler beim Lesen des Archivs: %v", err)
+		}
+	}
+
+	var mismatches []string
+	checked := 0
+	skipped := make(map[string]bool)
+	for _, name := range result.Skipped {
+		skipped[name] = true
+	}
+	for _, file := range manifest.Files {
+		name, ok := restoreName(file.name(), opts)
+		if !ok || skipped[name] {
+			continue
+		}
+		if renamed, ok := result.Renamed[name]; ok {
+			name = renamed
+		}
+		checked++
+		sum, err := hashFile(filepath.Join(targetDir, filepath.FromSlash(name)))
+		if err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("%s: %v", name, err))
+		} else if sum != file.SHA256 {
+			mismatches = append(mismatches, fmt.Sprintf("%s: Prüfsumme weicht ab", name))
+		}
+	}
+
+	if len(mismatches) > 0 {
+		for _, mismatch := range mismatches {
+			logMessage(LogError, "%s", mismatch)
+		}
+		return fmt.Errorf("%d von %d wiederhergestellten Dateien stimmen nicht mit dem Backup überein", len(mismatches), checked)
+	}
+	fmt.Printf("✓ %d Dateien erfolgreich verifiziert\n", checked)
+	return nil
+}
+
+// selectBackup bestimmt das wiederherzustellende Archiv: eine explizit angegebene Datei,
+// sonst das neueste Backup laut Katalog (optional zu oder vor dem Zeitpunkt at)
+func selectBackup(backupDir, projectName, at, explicit string) (string, error) {
+	if explicit != "" {
+		if _, err := os.Stat(explicit); err == nil {
+			return explicit, nil
+		}
+		return filepath.Join(backupDir, explicit), nil
+	}
+
+	catalog, err := loadCatalog(backupDir)
+	if err != nil {
+		return "", err
+	}
+
+	until := time.Now()
+	if at != "" {
+		until, err = parseRestoreTime(at)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	entry, ok := catalog.latestBefore(projectName, until)
+	if !ok {
+		return "", fmt.Errorf("kein Backup von %s zu oder vor %s im Katalog gefunden", projectName, formatDateTime(until))
+	}
+	logMessage(LogInfo, "Gewähltes Backup: %s vom %s", entry.File, formatDateTime(entry.Created))
+	return filepath.Join(backupDir, entry.archiveFile()), nil
+}
+
+// fetchRemoteBackup wählt ein Backup im Katalog des Remote-Ziels und lädt es herunter
+func fetchRemoteBackup(config *Config, projectName, at, explicit, limitFlag string) (string, error) {
+	remote, err := openRemote(config)
+	if err != nil {
+		return "", err
+	}
+	limit, err := bandwidthLimit(config, limitFlag)
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Base(explicit)
+	if explicit == "" {
+		selected, err := selectBackup(remote.root, projectName, at, "")
+		if err != nil {
+			return "", err
+		}
+		file = filepath.Base(selected)
+	}
+	backupFile, err := downloadBackup(remote, file, config.BackupDir, limit)
+	if err != nil {
+		return "", fmt.Errorf("fehler beim Herunterladen: %v", err)
+	}
+	return backupFile, nil
+}
+
+var errNoStream = errors.New("archiv lässt sich nicht streamen")
+
+// streamRemoteBackup wählt ein Backup auf dem Remote-Ziel und liefert seinen Pfad dort,
+// damit es ohne lokale Kopie entpackt wird. zip-Archive werden über ihr Inhaltsverzeichnis
+// gezielt gelesen; bei tar-Archiven liefert das Manifest die Vorschau und die Zielnamen
+// (--normalize, Groß-/Kleinschreibung), sodass der komprimierte Strom nur einmal übertragen
+// wird. Vorab wird nur sein Anfang mit den Metadaten gelesen, ein zweites Mal nur für
+// Hardlinks, die aus dem Teilbaum von --path herauszeigen. Ohne Manifest (z.B. verschlüsselte
+// Archive) folgt errNoStream und das Archiv wird wie bisher heruntergeladen.
+func streamRemoteBackup(config *Config, projectName, at, explicit string) (string, *Manifest, error) {
+	remote, err := openRemote(config)
+	if err != nil {
+		return "", nil, err
+	}
+	file := filepath.Base(explicit)
+	if explicit == "" {
+		selected, err := selectBackup(remote.root, projectName, at, "")
+		if err != nil {
+			return "", nil, err
+		}
+		file = filepath.Base(selected)
+	}
+	backupFile := remote.path(file)
+	if _, err := os.Stat(backupFile); err != nil {
+		return "", nil, err
+	}
+	if isZipFile(backupFile) {
+		logMessage(LogInfo, "Lese %s direkt von %s (nur die benötigten Einträge)", file, remote.root)
+		return backupFile, nil, nil
+	}
+	manifest, err := loadManifest(backupFile)
+	if err != nil {
+		logMessage(LogInfo, "Kein Manifest zu %s auf dem Remote-Ziel, lade das Archiv herunter", file)
+		return "", nil, errNoStream
+	}
+	logMessage(LogInfo, "Entpacke %s direkt von %s", file, remote.root)
+	return backupFile, manifest, nil
+}
+
+type extractOptions struct {
+	Subtree       string // nur Einträge unterhalb dieses Pfads (relativ zum Archiv)
+	Strip         int    // Anzahl führender Pfadkomponenten, die entfernt werden
+	SanitizeNames bool   // problematische Namen immer umbenennen, nicht erst bei Fehlern
+	Normalize     string // Unicode-Form der Namen: "nfc", "nfd" oder "" (wie im Archiv)
+	// Umgang mit Namen, die sich nur in der Groß-/Kleinschreibung unterscheiden: "rename",
+	// "skip" oder "overwrite"; leer = "rename", wenn das Ziel sie nicht unterscheidet
+	CaseConflicts string
+	PreserveOwner bool // Besitzer aus dem Archiv übernehmen (meist nur als root möglich)
+	IgnorePerms   bool // Rechte aus dem Archiv ignorieren und die umask verwenden
+
+	owners    *ownerMapper
+	names     *nameNormalizer
+	caseNames map[string]string // Name -> Zielname, "" = überspringen
+	// Vorschau und Zielnamen aus dem Manifest statt aus dem Archiv, damit ein gestreamtes
+	// tar-Archiv nur einmal gelesen wird
+	planManifest *Manifest
+	// Symlinks, die diese Wiederherstellung angelegt hat; nur über sie wird nichts geschrieben
+	symlinks map[string]bool
+}
+
+// ownerMapper ordnet Besitzer aus dem Archiv lokalen Benutzern und Gruppen zu.
+// Bevorzugt wird der Name, unbekannte Besitzer werden dem aktuellen Benutzer zugeordnet.
+type ownerMapper struct {
+	users  map[string]int
+	groups map[string]int
+}
+
+func newOwnerMapper() *ownerMapper {
+	return &ownerMapper{users: make(map[string]int), groups: make(map[string]int)}
+}
+
+func (m *ownerMapper) resolve(header *tar.Header) (int, int) {
+	uid := m.lookup(m.users, header.Uname, header.Uid, os.Getuid(), func(name string) (string, error) {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		return u.Uid, nil
+	}, func(id string) error {
+		_, err := user.LookupId(id)
+		return err
+	})
+	gid := m.lookup(m.groups, header.Gname, header.Gid, os.Getgid(), func(name string) (string, error) {
+		g, err := user.LookupGroup(name)
+		if err != nil {
+			return "", err
+		}
+		return g.Gid, nil
+	}, func(id string) error {
+		_, err := user.LookupGroupId(id)
+		return err
+	})
+	return uid, gid
+}
+
+func (m *ownerMapper) lookup(cache map[string]int, name string, id, fallback int,
+	byName func(string) (string, error), byID func(string) error) int {
+	key := name + ":" + strconv.Itoa(id)
+	if cached, ok := cache[key]; ok {
+		return cached
+	}
+	result := fallback
+	if name != "" {
+		if local, err := byName(name); err == nil {
+			result, _ = strconv.Atoi(local)
+		}
+	} else if byID(strconv.Itoa(id)) == nil {
+		result = id
+	}
+	cache[key] = result
+	return result
+}
+
+type extractResult struct {
+	Count   int
+	Renamed map[string]string // Name laut Archiv -> tatsächlich angelegter Name
+	Skipped []string
+}
+
+// cleanArchivePath normalisiert einen Pfad auf die Form der Archiveinträge ("src/x", ohne "./")
+func cleanArchivePath(name string) string {
+	name = path.Clean(filepath.ToSlash(name))
+	name = strings.TrimPrefix(name, "/")
+	if name == "." {
+		return ""
+	}
+	return name
+}
+
+// mapEntryName wendet Teilbaum-Filter und Strip auf einen Eintragsnamen an
+func mapEntryName(name string, opts extractOptions) (string, bool) {
+	name = cleanArchivePath(name)
+	if name == "" {
+		return "", false
+	}
+	if opts.Subtree != "" && name != opts.Subtree && !strings.HasPrefix(name, opts.Subtree+"/") {
+		return "", false
+	}
+	if opts.Strip > 0 {
+		parts := strings.Split(name, "/")
+		if len(parts) <= opts.Strip {
+			return "", false
+		}
+		name = strings.Join(parts[opts.Strip:], "/")
+	}
+	return name, true
+}
+
+// walkArchive ruft fn für jeden Eintrag eines Archivs auf; r liefert den Inhalt des Eintrags
+func walkArchive(archivePath string, fn func(header *tar.Header, r io.Reader) error) error {
+	f, tr, err := openArchive(archivePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	for {
+		archivePause.wait()
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Metadaten und Wiederherstellungsanleitung gehören nicht zum gesicherten Projekt
+		if isToolEntry(header.Name) {
+			continue
+		}
+		if err := fn(header, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// openArchive öffnet ein Archiv zum Lesen; Format und Kompression werden am Inhalt erkannt
+func openArchive(archivePath string) (io.Closer, entryReader, error) {
+	if isSnapshot(archivePath) {
+		s, err := openSnapshot(archivePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return s, s, nil
+	}
+	if isZipFile(archivePath) {
+		z, err := openZip(archivePath)
+		if err != nil {
+			return nil, nil, err
+		}
+		return z, z, nil
+	}
+	r, err := compressedFile(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, tar.NewReader(r), nil
+}
+
+// restoreTarget bildet einen Archiveintrag auf seinen Zielpfad ab; false bedeutet überspringen
+func restoreTarget(header *tar.Header, targetDir string, opts extractOptions) (string, bool) {
+	name, ok := restoreName(header.Name, opts)
+	if !ok {
+		return "", false
+	}
+	target := filepath.Join(targetDir, filepath.FromSlash(name))
+	if !isWithin(targetDir, target) {
+		logMessage(LogWarning, "Überspringe Eintrag außerhalb des Zielverzeichnisses: %s", header.Name)
+		return "", false
+	}
+	return target, true
+}
+
+type restorePlan struct {
+	Files       int
+	Others      int // Verzeichnisse, Links und Spezialdateien
+	TotalSize   int64
+	Created     []string // neu anzulegende Dateien
+	Overwritten []string // vorhandene Dateien mit abweichendem Inhalt
+	Unchanged   int      // vorhandene Dateien mit gleicher Größe und Änderungszeit
+}
+
+// planRestore ermittelt, welche Dateien eine Wiederherstellung anlegen oder überschreiben würde
+func planRestore(archivePath, targetDir string, opts extractOptions) (*restorePlan, error) {
+	plan := &restorePlan{}
+	err := walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+		if header.Typeflag != tar.TypeReg {
+			plan.addOther(header.Name, opts)
+			return nil
+		}
+		return plan.add(header, targetDir, opts)
+	})
+	return plan, err
+}
+
+// planFromManifest ermittelt dasselbe wie planRestore anhand der Dateien und übrigen Einträge im Manifest
+func planFromManifest(manifest *Manifest, targetDir string, opts extractOptions) (*restorePlan, error) {
+	plan := &restorePlan{}
+	for _, file := range manifest.Files {
+		header := &tar.Header{Name: file.name(), Size: file.Size, ModTime: file.ModTime, Typeflag: tar.TypeReg}
+		if err := plan.add(header, targetDir, opts); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range manifest.Entries {
+		plan.addOther(entry.name(), opts)
+	}
+	return plan, nil
+}
+
+// addOther zählt einen Eintrag ohne Inhalt, der wiederhergestellt würde
+func (plan *restorePlan) addOther(name string, opts extractOptions) {
+	if _, ok := restoreName(name, opts); ok {
+		plan.Others++
+	}
+}
+
+func (plan *restorePlan) add(header *tar.Header, targetDir string, opts extractOptions) error {
+	target, ok := restoreTarget(header, targetDir, opts)
+	if !ok {
+		return nil
+	}
+	plan.Files++
+	plan.TotalSize += header.Size
+
+	rel, _ := filepath.Rel(targetDir, target)
+	info, err := os.Lstat(target)
+	switch {
+	case os.IsNotExist(err):
+		plan.Created = append(plan.Created, rel)
+	case err != nil:
+		return err
+	case info.Mode().IsRegular() && info.Size() == header.Size && sameModTime(info.ModTime(), header.ModTime):
+		plan.Unchanged++
+	default:
+		plan.Overwritten = append(plan.Overwritten, rel)
+	}
+	return nil
+}
+
+// sameModTime vergleicht Änderungszeiten mit der Sekundengenauigkeit von tar
+func sameModTime(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+func printRestorePlan(plan *restorePlan, targetDir string) {
+	const maxListed = 20
+
+	fmt.Printf("\nWiederherstellung nach %s:\n", targetDir)
+	fmt.Printf("  Dateien:        %d (%s)\n", plan.Files, formatSize(plan.TotalSize))
+	fmt.Printf("  Neu:            %d\n", len(plan.Created))
+	fmt.Printf("  Überschrieben:  %d\n", len(plan.Overwritten))
+	fmt.Printf("  Unverändert:    %d\n", plan.Unchanged)
+	if plan.Others > 0 {
+		fmt.Printf("  Verzeichnisse, Links und Spezialdateien: %d\n", plan.Others)
+	}
+
+	if len(plan.Overwritten) > 0 {
+		fmt.Println("\nFolgende Dateien werden überschrieben:")
+		for i, name := range plan.Overwritten {
+			if i == maxListed {
+				fmt.Printf("  ... und %d weitere\n", len(plan.Overwritten)-maxListed)
+				break
+			}
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	fmt.Println()
+}
+
+// confirm fragt auf der Konsole nach einer Bestätigung; ohne Eingabe gilt "nein"
+func confirm(question string) bool {
+	fmt.Printf("%s [j/N] ", question)
+	reader := bufio.NewReader(os.Stdin)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "j" || answer == "ja" || answer == "y" || answer == "yes"
+}
+
+// restoreName liefert den Zielnamen eines Eintrags relativ zum Zielverzeichnis
+func restoreName(name string, opts extractOptions) (string, bool) {
+	name, ok := mapEntryName(name, opts)
+	if ok && opts.SanitizeNames {
+		name = sanitizePath(name)
+	}
+	if !ok {
+		return "", false
+	}
+	name = opts.names.name(name)
+	if target, found := opts.caseNames[name]; found {
+		return target, target != ""
+	}
+	return name, true
+}
+
+// prepareRestoreNames legt vor dem Wiederherstellen für alle Einträge die Zielnamen fest.
+// Einträge, deren normalisierter Name schon im Archiv vorkommt, behalten ihren Namen,
+// sonst würde einer den anderen überschreiben. Unterscheidet das Ziel nicht zwischen
+// Groß- und Kleinschreibung, werden kollidierende Einträge umbenannt.
+func prepareRestoreNames(archivePath, targetDir string, opts *extractOptions) error {
+	caseMode := opts.CaseConflicts
+	if caseMode == "" && caseInsensitiveDir(targetDir) {
+		logMessage(LogInfo, "%s unterscheidet nicht zwischen Groß- und Kleinschreibung", targetDir)
+		caseMode = "rename"
+	}
+	if opts.Normalize == "" && caseMode == "" {
+		return nil
+	}
+
+	var order []string
+	entries := make(map[string]bool)
+	add := func(name string) {
+		if name, ok := restoreName(name, *opts); ok && !entries[name] {
+			entries[name] = true
+			order = append(order, name)
+		}
+	}
+	if opts.planManifest != nil {
+		// Gestreamtes Archiv: Die Namen stammen aus dem Manifest, damit es nur einmal
+		// gelesen wird
+		for _, name := range manifestEntryNames(opts.planManifest) {
+			add(name)
+		}
+	} else {
+		err := walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+			add(header.Name)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if opts.Normalize != "" {
+		names := newNameNormalizer(opts.Normalize, func(rel, sibling string) bool {
+			return entries[sibling]
+		})
+		changed := 0
+		for i, name := range order {
+			if order[i] = names.name(name); order[i] != name {
+				changed++
+			}
+		}
+		if changed > 0 {
+			logMessage(LogInfo, "%d Namen werden nach %s normalisiert", changed, strings.ToUpper(opts.Normalize))
+		}
+		if len(names.Conflicts) > 0 {
+			logMessage(LogWarning, "%d Einträge behalten ihren Namen, weil es die normalisierte Form schon gibt:%s",
+				len(names.Conflicts), problemList(names.Conflicts))
+		}
+		opts.names = names
+	}
+
+	if caseMode != "" {
+		var conflicts []string
+		opts.caseNames, conflicts = resolveCaseConflicts(order, caseMode)
+		if len(conflicts) > 0 {
+			logMessage(LogWarning, "%d Einträge unterscheiden sich nur in der Groß-/Kleinschreibung:%s", len(conflicts), problemList(conflicts))
+		}
+	}
+	return nil
+}
+
+// manifestEntryNames liefert alle Einträge eines Manifests (Dateien, Verzeichnisse und
+// Links) in der Reihenfolge eines Archivs: wie beim Sichern nach Namen sortiert, jedes
+// Verzeichnis vor seinem Inhalt
+func manifestEntryNames(manifest *Manifest) []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		for dir := name; dir != "." && dir != "/" && dir != "" && !seen[dir]; dir = path.Dir(dir) {
+			seen[dir] = true
+			names = append(names, dir)
+		}
+	}
+	for _, file := range manifest.Files {
+		add(file.name())
+	}
+	for _, entry := range manifest.Entries {
+		add(cleanArchivePath(entry.name()))
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return archiveOrderLess(names[i], names[j])
+	})
+	return names
+}
+
+// archiveOrderLess vergleicht Pfade Komponente für Komponente, wie filepath.WalkDir sie besucht
+func archiveOrderLess(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		if as[i] != bs[i] {
+			return as[i] < bs[i]
+		}
+	}
+	return len(as) < len(bs)
+}
+
+// extractArchive entpackt ein Archiv nach targetDir und liefert die Anzahl der Einträge
+func extractArchive(archivePath, targetDir string, opts extractOptions) (*extractResult, error) {
+	result := &extractResult{Renamed: make(map[string]string)}
+	opts.symlinks = make(map[string]bool)
+	if opts.PreserveOwner {
+		opts.owners = newOwnerMapper()
+	}
+	// Hardlinks, deren Ziel nicht mit wiederhergestellt wird: Name des Ziels im Archiv -> Pfade
+	outsideLinks := make(map[string][]string)
+	err := walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+		target, ok := restoreTarget(header, targetDir, opts)
+		if !ok {
+			return nil
+		}
+		if header.Typeflag == tar.TypeLink {
+			if _, ok := restoreName(header.Linkname, opts); !ok {
+				source := cleanArchivePath(header.Linkname)
+				outsideLinks[source] = append(outsideLinks[source], target)
+				return nil
+			}
+		}
+		if original, _ := mapEntryName(header.Name, opts); opts.SanitizeNames && original != sanitizePath(original) {
+			result.Renamed[original] = sanitizePath(original)
+		}
+		err := extractEntry(r, header, targetDir, target, opts)
+
+		// Lehnt das Zieldateisystem den Namen ab, mit bereinigtem Namen erneut versuchen
+		if isNameError(err) {
+			name, _ := filepath.Rel(targetDir, target)
+			name = filepath.ToSlash(name)
+			clean := sanitizePath(name)
+			if clean != name {
+				err = extractEntry(r, header, targetDir, filepath.Join(targetDir, filepath.FromSlash(clean)), opts)
+				if err == nil {
+					result.Renamed[name] = clean
+				}
+			}
+			if isNameError(err) {
+				result.Skipped = append(result.Skipped, name)
+				return nil
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", header.Name, err)
+		}
+		result.Count++
+		return nil
+	})
+	if err == nil && len(outsideLinks) > 0 {
+		err = extractOutsideLinks(archivePath, targetDir, opts, outsideLinks, result)
+	}
+	return result, err
+}
+
+// extractOutsideLinks legt Hardlinks, deren Ziel außerhalb des gewählten Teilbaums liegt,
+// als eigenständige Dateien an. Den Inhalt liefert ein zweiter Durchgang durch das Archiv.
+func extractOutsideLinks(archivePath, targetDir string, opts extractOptions, links map[string][]string, result *extractResult) error {
+	logMessage(LogInfo, "%d Hardlinks zeigen aus dem Teilbaum heraus und werden als eigene Dateien angelegt", len(links))
+	err := walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+		name := cleanArchivePath(header.Name)
+		targets, ok := links[name]
+		if !ok || header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		delete(links, name)
+		if err := extractEntry(r, header, targetDir, targets[0], opts); err != nil {
+			return fmt.Errorf("%s: %v", targets[0], err)
+		}
+		result.Count++
+		for _, target := range targets[1:] {
+			if err := copyRestoredFile(targets[0], target, targetDir, opts); err != nil {
+				return fmt.Errorf("%s: %v", target, err)
+			}
+			result.Count++
+		}
+		return nil
+	})
+	// Ziele, die im Archiv fehlen, lassen sich nicht anlegen
+	for _, targets := range links {
+		for _, target := range targets {
+			rel, _ := filepath.Rel(targetDir, target)
+			result.Skipped = append(result.Skipped, filepath.ToSlash(rel))
+		}
+	}
+	return err
+}
+
+// copyRestoredFile kopiert eine gerade wiederhergestellte Datei samt Rechten und Zeiten
+func copyRestoredFile(source, target, targetDir string, opts extractOptions) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	header := &tar.Header{Typeflag: tar.TypeReg, Mode: int64(info.Mode().Perm()), ModTime: info.ModTime()}
+	return createEntry(in, header, targetDir, target, extractOptions{symlinks: opts.symlinks})
+}
+
+func extractEntry(r io.Reader, header *tar.Header, targetDir, target string, opts extractOptions) error {
+	if err := createEntry(r, header, targetDir, target, opts); err != nil {
+		return err
+	}
+	if opts.PreserveOwner && opts.owners != nil {
+		uid, gid := opts.owners.resolve(header)
+		if err := os.Lchown(target, uid, gid); err != nil {
+			logMessage(LogWarning, "Besitzer von %s nicht gesetzt: %v", header.Name, err)
+		}
+	}
+	return nil
+}
+
+func createEntry(r io.Reader, header *tar.Header, targetDir, target string, opts extractOptions) error {
+	mode := os.FileMode(header.Mode).Perm()
+	if opts.IgnorePerms {
+		// Die umask des Benutzers entscheidet wie bei neu angelegten Dateien
+		mode = 0666
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if err := mkdirWithin(targetDir, target, opts.symlinks); err != nil {
+			return err
+		}
+		// Ein vorhandener Symlink des Benutzers (z.B. vendor -> ../shared) behält die Rechte seines Ziels
+		if info, err := os.Lstat(target); opts.IgnorePerms || (err == nil && info.Mode()&os.ModeSymlink != 0) {
+			return nil
+		}
+		return os.Chmod(target, mode|0700)
+
+	case tar.TypeReg:
+		if err := mkdirWithin(targetDir, filepath.Dir(target), opts.symlinks); err != nil {
+			return err
+		}
+		// Vorhandene Datei oder Link entfernen, damit nie über einen Symlink geschrieben wird
+		os.Remove(target)
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, r); err != nil {
+			out.Close()
+			return err
+		}
+		if err := out.Close(); err != nil {
+			return err
+		}
+		return os.Chtimes(target, header.ModTime, header.ModTime)
+
+	case tar.TypeSymlink:
+		if err := mkdirWithin(targetDir, filepath.Dir(target), opts.symlinks); err != nil {
+			return err
+		}
+		os.Remove(target)
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return err
+		}
+		if opts.symlinks != nil {
+			opts.symlinks[target] = true
+		}
+		return nil
+
+	case tar.TypeLink:
+		// Ziele außerhalb des Teilbaums behandelt extractOutsideLinks
+		linkname, _ := restoreName(header.Linkname, opts)
+		source := filepath.Join(targetDir, filepath.FromSlash(linkname))
+		if !isWithin(targetDir, source) {
+			return fmt.Errorf("hardlink zeigt aus dem Zielverzeichnis heraus: %s", header.Linkname)
+		}
+		if err := checkSymlinks(targetDir, filepath.Dir(source), opts.symlinks); err != nil {
+			return err
+		}
+		if err := mkdirWithin(targetDir, filepath.Dir(target), opts.symlinks); err != nil {
+			return err
+		}
+		os.Remove(target)
+		return os.Link(source, target)
+
+	case tar.TypeFifo:
+		if err := mkdirWithin(targetDir, filepath.Dir(target), opts.symlinks); err != nil {
+			return err
+		}
+		os.Remove(target)
+		return syscall.Mkfifo(target, uint32(mode))
+
+	case tar.TypeChar, tar.TypeBlock:
+		if err := mkdirWithin(targetDir, filepath.Dir(target), opts.symlinks); err != nil {
+			return err
+		}
+		kind := uint32(syscall.S_IFCHR)
+		if header.Typeflag == tar.TypeBlock {
+			kind = syscall.S_IFBLK
+		}
+		os.Remove(target)
+		if err := mknod(target, kind|uint32(mode), header.Devmajor, header.Devminor); err != nil {
+			// Gerätedateien darf meist nur root anlegen
+			logMessage(LogWarning, "Gerätedatei %s nicht angelegt: %v", header.Name, err)
+		}
+		return nil
+
+	default:
+		logMessage(LogWarning, "Überspringe nicht unterstützten Eintrag: %s", header.Name)
+		return nil
+	}
+}
+
+// mkdirWithin legt dir samt fehlender Elternverzeichnisse unterhalb von targetDir an.
+// Kein Teil des Pfads darf ein Symlink aus dem Archiv sein (created): Sonst könnte ein
+// Archiv erst einen Link auf ein fremdes Verzeichnis und dann Dateien "darin" anlegen.
+// Symlinks, die schon vorher im Zielverzeichnis lagen, hat der Benutzer angelegt; ihnen
+// wird wie bei tar gefolgt.
+func mkdirWithin(targetDir, dir string, created map[string]bool) error {
+	if err := checkSymlinks(targetDir, dir, created); err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, 0755)
+}
+
+// checkSymlinks prüft jeden vorhandenen Teil von name unterhalb von targetDir mit Lstat
+// darauf, ob er ein in dieser Wiederherstellung angelegter Symlink ist
+func checkSymlinks(targetDir, name string, created map[string]bool) error {
+	rel, err := filepath.Rel(targetDir, name)
+	if err != nil || !isWithin(targetDir, name) {
+		return fmt.Errorf("%s liegt außerhalb des Zielverzeichnisses", name)
+	}
+	if rel == "." {
+		return nil
+	}
+	dir := targetDir
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 && created[dir] {
+			rel, _ := filepath.Rel(targetDir, dir)
+			return fmt.Errorf("%s ist ein Symlink aus dem Archiv, darüber wird nichts angelegt", rel)
+		}
+	}
+	return nil
+}
+
+// isWithin prüft, ob path innerhalb von dir liegt
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
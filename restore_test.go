@@ -0,0 +1,258 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testEntry struct {
+	header tar.Header
+	body   string
+}
+
+// writeTestArchive legt ein .tar.gz mit den angegebenen Einträgen an
+func writeTestArchive(t *testing.T, dir string, entries []testEntry) string {
+	t.Helper()
+	archivePath := filepath.Join(dir, "test_backup_2024-01-01_12-00-00.tar.gz")
+	f, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := entry.header
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		header.Size = int64(len(entry.body))
+		header.ModTime = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+		if err := tw.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(entry.body)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestExtractRefusesWriteThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	if err := os.Mkdir(victim, 0755); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := writeTestArchive(t, dir, []testEntry{
+		{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: victim}},
+		{header: tar.Header{Name: "link/pwned.txt", Typeflag: tar.TypeReg}, body: "pwned"},
+	})
+
+	target := filepath.Join(dir, "restore")
+	if _, err := extractArchive(archivePath, target, extractOptions{}); err == nil {
+		t.Error("Eintrag hinter einem Symlink wurde ohne Fehler entpackt")
+	}
+	if _, err := os.Lstat(filepath.Join(victim, "pwned.txt")); !os.IsNotExist(err) {
+		t.Fatalf("Datei außerhalb des Zielverzeichnisses angelegt (%v)", err)
+	}
+}
+
+func TestExtractRefusesDirThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	if err := os.Mkdir(victim, 0700); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := writeTestArchive(t, dir, []testEntry{
+		{header: tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: victim}},
+		{header: tar.Header{Name: "link/", Typeflag: tar.TypeDir, Mode: 0777}},
+		{header: tar.Header{Name: "link/sub/", Typeflag: tar.TypeDir, Mode: 0755}},
+	})
+
+	target := filepath.Join(dir, "restore")
+	if _, err := extractArchive(archivePath, target, extractOptions{}); err == nil {
+		t.Error("Verzeichnis hinter einem Symlink wurde ohne Fehler angelegt")
+	}
+	info, err := os.Stat(victim)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("Rechte des fremden Verzeichnisses geändert: %v", info.Mode().Perm())
+	}
+	if _, err := os.Lstat(filepath.Join(victim, "sub")); !os.IsNotExist(err) {
+		t.Errorf("Verzeichnis außerhalb des Zielverzeichnisses angelegt (%v)", err)
+	}
+}
+
+func TestExtractFollowsExistingUserSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "checkout")
+	shared := filepath.Join(dir, "shared")
+	for _, d := range []string{target, shared} {
+		if err := os.Mkdir(d, 0750); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../shared", filepath.Join(target, "vendor")); err != nil {
+		t.Fatal(err)
+	}
+	archivePath := writeTestArchive(t, dir, []testEntry{
+		{header: tar.Header{Name: "vendor/", Typeflag: tar.TypeDir, Mode: 0777}},
+		{header: tar.Header{Name: "vendor/lib.go", Typeflag: tar.TypeReg}, body: "package lib\n"},
+	})
+
+	if _, err := extractArchive(archivePath, target, extractOptions{}); err != nil {
+		t.Fatalf("Symlink des Benutzers abgelehnt: %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(shared, "lib.go")); err != nil || string(data) != "package lib\n" {
+		t.Errorf("lib.go = %q (%v)", data, err)
+	}
+	if info, err := os.Stat(shared); err != nil || info.Mode().Perm() != 0750 {
+		t.Errorf("Rechte des verlinkten Verzeichnisses geändert: %v (%v)", info.Mode().Perm(), err)
+	}
+}
+
+func TestExtractKeepsSymlinksInsideTarget(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := writeTestArchive(t, dir, []testEntry{
+		{header: tar.Header{Name: "src/", Typeflag: tar.TypeDir, Mode: 0755}},
+		{header: tar.Header{Name: "src/main.go", Typeflag: tar.TypeReg}, body: "package main\n"},
+		{header: tar.Header{Name: "current", Typeflag: tar.TypeSymlink, Linkname: "src"}},
+	})
+
+	target := filepath.Join(dir, "restore")
+	result, err := extractArchive(archivePath, target, extractOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Count != 3 {
+		t.Errorf("%d Einträge entpackt, erwartet 3", result.Count)
+	}
+	if link, err := os.Readlink(filepath.Join(target, "current")); err != nil || link != "src" {
+		t.Errorf("Symlink current = %q (%v)", link, err)
+	}
+}
+
+func TestExtractSubtreeWithHardlinkOutside(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := writeTestArchive(t, dir, []testEntry{
+		{header: tar.Header{Name: "a/data.txt", Typeflag: tar.TypeReg}, body: "inhalt"},
+		{header: tar.Header{Name: "b/link1", Typeflag: tar.TypeLink, Linkname: "a/data.txt"}},
+		{header: tar.Header{Name: "b/link2", Typeflag: tar.TypeLink, Linkname: "a/data.txt"}},
+		{header: tar.Header{Name: "b/own.txt", Typeflag: tar.TypeReg}, body: "eigen"},
+		{header: tar.Header{Name: "b/own-link", Typeflag: tar.TypeLink, Linkname: "b/own.txt"}},
+	})
+
+	target := filepath.Join(dir, "restore")
+	result, err := extractArchive(archivePath, target, extractOptions{Subtree: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"b/link1": "inhalt", "b/link2": "inhalt", "b/own.txt": "eigen", "b/own-link": "eigen"} {
+		data, err := os.ReadFile(filepath.Join(target, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q (%v), erwartet %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, "a")); !os.IsNotExist(err) {
+		t.Errorf("Verzeichnis außerhalb des Teilbaums angelegt (%v)", err)
+	}
+	if result.Count != 4 || len(result.Skipped) != 0 {
+		t.Errorf("%d Einträge, übersprungen %q", result.Count, result.Skipped)
+	}
+}
+
+func TestPrepareRestoreNamesFromManifest(t *testing.T) {
+	opts := extractOptions{
+		Normalize:     "nfc",
+		planManifest:  &Manifest{Files: []ManifestFile{{Path: "Mu\u0308ller/Bericht.txt"}, {Path: "Mu\u0308ller/bericht.txt"}}},
+		CaseConflicts: "rename",
+	}
+	// Das Archiv wird nicht gelesen, es muss nicht einmal existieren
+	missing := filepath.Join(t.TempDir(), "fehlt.tar.gz")
+	if err := prepareRestoreNames(missing, t.TempDir(), &opts); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := restoreName("Mu\u0308ller/Bericht.txt", opts); name != "Müller/Bericht.txt" {
+		t.Errorf("Name %+q", name)
+	}
+	if name, _ := restoreName("Mu\u0308ller/bericht.txt", opts); name == "Müller/bericht.txt" || name == "Müller/Bericht.txt" {
+		t.Errorf("Konflikt der Groß-/Kleinschreibung nicht aufgelöst: %+q", name)
+	}
+}
+
+func TestManifestPlanIncludesLinksAndDirs(t *testing.T) {
+	src := t.TempDir()
+	os.Mkdir(filepath.Join(src, "leer"), 0755)
+	os.Mkdir(filepath.Join(src, "links"), 0755)
+	if err := os.WriteFile(filepath.Join(src, "Readme.md"), []byte("text"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Symlink("Readme.md", filepath.Join(src, "README.md"))
+	os.Symlink("../Readme.md", filepath.Join(src, "links", "doku"))
+	backupDir := t.TempDir()
+	archivePath := filepath.Join(backupDir, "p_backup_2024-01-01_12-00-00.tar.gz")
+	report, err := createBackup(src, archivePath, archiveOptions{Project: "p", Compression: compressionFormats[0], Workers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := newManifest(archivePath, "p", report.Files)
+	manifest.Entries = report.Entries
+
+	names := manifestEntryNames(manifest)
+	want := []string{"README.md", "Readme.md", "leer", "links", "links/doku"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("Namen %q, erwartet %q", names, want)
+	}
+
+	// Das Ziel unterscheidet nicht zwischen Groß- und Kleinschreibung: der Symlink zählt mit
+	opts := extractOptions{planManifest: manifest, CaseConflicts: "rename"}
+	if err := prepareRestoreNames(archivePath, t.TempDir(), &opts); err != nil {
+		t.Fatal(err)
+	}
+	if name, _ := restoreName("Readme.md", opts); name == "Readme.md" {
+		t.Error("Konflikt mit dem Symlink README.md nicht erkannt")
+	}
+
+	// --path mit nur einem Symlink darin
+	opts = extractOptions{planManifest: manifest, Subtree: "links"}
+	plan, err := planFromManifest(manifest, t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Files != 0 || plan.Others != 2 {
+		t.Errorf("Vorschau für links: %d Dateien, %d weitere Einträge", plan.Files, plan.Others)
+	}
+	if streamed, err := planRestore(archivePath, t.TempDir(), opts); err != nil || streamed.Others != plan.Others {
+		t.Errorf("Vorschau aus dem Archiv: %+v (%v)", streamed, err)
+	}
+}
+
+func TestCaseProbeLeavesNothingBehind(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "ziel")
+	caseInsensitiveDir(target)
+	if entries, _ := os.ReadDir(dir); len(entries) > 0 {
+		t.Errorf("Probe hat %s hinterlassen", entries[0].Name())
+	}
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	caseInsensitiveDir(target)
+	if entries, _ := os.ReadDir(target); len(entries) > 0 {
+		t.Errorf("Probe hat %s im Ziel hinterlassen", entries[0].Name())
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Am Ende jedes Archivs liegt unter .backup-restore/ eine Anleitung samt Skript, Manifest
+// und Prüfsummen, damit sich ein Backup auch ohne backup-tool wiederherstellen lässt.
+// Beim Wiederherstellen mit backup-tool werden diese Einträge wie der Metadaten-Eintrag
+// übergangen.
+const restoreInfoDir = ".backup-restore"
+
+// isToolEntry erkennt Einträge, die backup-tool selbst ins Archiv schreibt
+func isToolEntry(name string) bool {
+	name = cleanArchivePath(name)
+	return name == metaEntryName || name == restoreInfoDir || strings.HasPrefix(name, restoreInfoDir+"/")
+}
+
+// writeRestoreInfo schreibt Anleitung, Skript, Manifest und Prüfsummen ins Archiv
+func writeRestoreInfo(tw entryWriter, backupFile string, meta *ArchiveMeta, report *archiveReport, opts archiveOptions) error {
+	manifest := newManifest(backupFile, opts.Project, report.Files)
+	manifest.Skipped = report.Skipped
+	manifestData, err := json.MarshalIndent(manifest, "", "    ")
+	if err != nil {
+		return err
+	}
+	var sums strings.Builder
+	for _, file := range report.Files {
+		// sha256sum kann Namen mit Zeilenumbrüchen und ungültigem UTF-8 nicht sicher darstellen
+		if file.RawPath != nil || strings.ContainsAny(file.Path, "\n\\") {
+			continue
+		}
+		fmt.Fprintf(&sums, "%s  %s\n", file.SHA256, file.Path)
+	}
+
+	entries := []struct {
+		name string
+		mode int64
+		data string
+	}{
+		{"RESTORE.txt", 0644, restoreText(backupFile, meta, opts)},
+		{"restore.sh", 0755, restoreScript(meta, opts)},
+		{"manifest.json", 0644, string(manifestData)},
+		{"SHA256SUMS", 0644, sums.String()},
+	}
+	for _, entry := range entries {
+		header := &tar.Header{
+			Name:     restoreInfoDir + "/" + entry.name,
+			Typeflag: tar.TypeReg,
+			Mode:     entry.mode,
+			Size:     int64(len(entry.data)),
+			ModTime:  meta.Created,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(entry.data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractCommand liefert den Shell-Befehl, der das Archiv "$archive" nach "$target" entpackt
+func extractCommand(opts archiveOptions) string {
+	switch {
+	case opts.Format == "snapshot":
+		// Die Dateien im Snapshot-Speicher sind schreibgeschützt
+		return `cp -R "$archive"/. "$target" && chmod -R u+w "$target"`
+	case opts.Format == "zip":
+		return `unzip -q "$archive" -d "$target"`
+	case opts.Compression == nil || opts.Compression.Binary == "":
+		return `gzip -dc "$archive" | tar -xf - -C "$target"`
+	case opts.Compression.extractArgs != nil:
+		return opts.Compression.Binary + ` e -so "$archive" | tar -xf - -C "$target"`
+	default:
+		return fmt.Sprintf(`%s %s "$archive" | tar -xf - -C "$target"`,
+			opts.Compression.Binary, strings.Join(opts.Compression.decompressArgs, " "))
+	}
+}
+
+func restoreScript(meta *ArchiveMeta, opts archiveOptions) string {
+	return fmt.Sprintf(`#!/bin/sh
+# Stellt das Backup von %s ohne backup-tool wieder her und prüft die Dateien.
+# Aufruf: sh restore.sh ARCHIV [ZIELVERZEICHNIS]
+set -e
+archive=${1:?"Aufruf: sh restore.sh ARCHIV [ZIELVERZEICHNIS]"}
+target=${2:-%s}
+%s`, meta.Project, shellQuote(meta.SourceDir), restoreSteps(opts))
+}
+
+// restoreSteps entpackt "$archive" nach "$target", prüft die Dateien und räumt auf
+func restoreSteps(opts archiveOptions) string {
+	return fmt.Sprintf(`
+mkdir -p "$target"
+%s
+cd "$target"
+if command -v sha256sum >/dev/null 2>&1; then
+	sha256sum -c --quiet %s/SHA256SUMS && echo "Alle Dateien stimmen mit dem Backup überein"
+else
+	echo "sha256sum nicht gefunden, Prüfung übersprungen" >&2
+fi
+rm -rf %s %s %s
+echo "Wiederhergestellt nach $target"
+`, extractCommand(opts), restoreInfoDir, restoreInfoDir, metaEntryName, snapshotIndexName)
+}
+
+// Zeile, nach der in selbstentpackenden Archiven die Archivdaten folgen
+const selfExtractingMarker = "__BACKUP_ARCHIV__"
+
+// selfExtractingPath liefert den Namen des selbstentpackenden Archivs zu einem Backup
+func selfExtractingPath(backupFile string) string {
+	return strings.TrimSuffix(backupFile, archiveExtension(backupFile)) + ".sh"
+}
+
+// writeSelfExtracting legt neben dem Backup ein Shell-Skript mit angehängtem Archiv an,
+// das sich mit "sh datei.sh [ziel]" ohne backup-tool entpacken lässt
+func writeSelfExtracting(backupFile, project, sourceDir string, opts archiveOptions) (string, error) {
+	target := selfExtractingPath(backupFile)
+	stub := fmt.Sprintf(`#!/bin/sh
+# Selbstentpackendes Backup von %s, erstellt mit backup-tool %s
+# Aufruf: sh %s [ZIELVERZEICHNIS]
+set -e
+target=${1:-%s}
+archive=$(mktemp)
+trap 'rm -f "$archive"' EXIT
+skip=$(awk '/^%s$/ { print NR + 1; exit }' "$0")
+tail -n +"$skip" "$0" > "$archive"
+%sexit 0
+%s
+`, project, toolVersion, filepath.Base(target), shellQuote(filepath.Base(sourceDir)), selfExtractingMarker,
+		restoreSteps(opts), selfExtractingMarker)
+
+	in, err := os.Open(backupFile)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(target+".tmp", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return "", err
+	}
+	_, err = io.WriteString(out, stub)
+	if err == nil {
+		_, err = io.Copy(out, in)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(target+".tmp", target)
+	}
+	if err != nil {
+		os.Remove(target + ".tmp")
+		return "", err
+	}
+	return target, nil
+}
+
+func restoreText(backupFile string, meta *ArchiveMeta, opts archiveOptions) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Backup des Projekts %s\n\n", meta.Project)
+	fmt.Fprintf(&b, "Erstellt:      %s (UTC) auf %s\n", meta.Created.Format(time.DateTime), meta.Host)
+	fmt.Fprintf(&b, "Quelle:        %s\n", meta.SourceDir)
+	if meta.Git != nil {
+		fmt.Fprintf(&b, "Git:           %s\n", meta.Git)
+	}
+	fmt.Fprintf(&b, "Archiv:        %s\n", filepath.Base(backupFile))
+	fmt.Fprintf(&b, "Programm:      backup-tool %s (Archivformat %d)\n\n", meta.ToolVersion, meta.FormatVersion)
+	b.WriteString("Wiederherstellen mit backup-tool im Projektverzeichnis:\n\n")
+	fmt.Fprintf(&b, "    backup-tool restore %s\n\n", filepath.Base(backupFile))
+	b.WriteString("Ohne backup-tool entpackt das Skript restore.sh das Archiv und prüft die Dateien\n")
+	b.WriteString("anhand von SHA256SUMS:\n\n")
+	fmt.Fprintf(&b, "    %s\n", extractCommand(opts))
+	fmt.Fprintf(&b, "        mit archive=%s, target=%s (oder ein anderes Zielverzeichnis)\n\n",
+		filepath.Base(backupFile), shellQuote(meta.SourceDir))
+	b.WriteString("    sh restore.sh ARCHIV [ZIELVERZEICHNIS]\n\n")
+	fmt.Fprintf(&b, "Danach können %s/ und %s im Zielverzeichnis gelöscht werden.\n", restoreInfoDir, metaEntryName)
+	b.WriteString("manifest.json enthält Größe, Änderungszeit und SHA-256 jeder gesicherten Datei.\n")
+	if opts.Format == "snapshot" {
+		fmt.Fprintf(&b, "Im Snapshot enthält %s Rechte und Zeiten der Dateien; er wird beim Kopieren nicht benötigt.\n", snapshotIndexName)
+	}
+	if opts.Compression != nil && opts.Compression.Name == "7z" {
+		b.WriteString("\nDas Archiv kann mit einem Passwort verschlüsselt sein (BACKUP_7Z_PASSWORD); 7z fragt danach.\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// retentionPolicy beschreibt, welche Backups aufbewahrt werden (Großvater-Vater-Sohn):
+// die letzten Last Backups sowie je Stunde, Tag, Woche, Monat und Jahr das neueste
+// Backup für die angegebene Anzahl an Zeiträumen
+type retentionPolicy struct {
+	Last, Hourly, Daily, Weekly, Monthly, Yearly int
+}
+
+// parseRetentionPolicy liest Angaben wie "last=3,daily=7,weekly=4,monthly=12"
+func parseRetentionPolicy(spec string) (retentionPolicy, error) {
+	var policy retentionPolicy
+	fields := map[string]*int{
+		"last": &policy.Last, "hourly": &policy.Hourly, "daily": &policy.Daily,
+		"weekly": &policy.Weekly, "monthly": &policy.Monthly, "yearly": &policy.Yearly,
+	}
+	for _, part := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ' ' }) {
+		key, value, ok := strings.Cut(part, "=")
+		field, known := fields[strings.ToLower(key)]
+		n, err := strconv.Atoi(value)
+		if !ok || !known || err != nil || n < 0 {
+			return policy, fmt.Errorf("ungültige Angabe %q in der Aufbewahrung (z.B. last=3,daily=7,weekly=4,monthly=12,yearly=2)", part)
+		}
+		*field = n
+	}
+	if policy == (retentionPolicy{}) {
+		return policy, fmt.Errorf("aufbewahrung %q behält kein Backup", spec)
+	}
+	return policy, nil
+}
+
+// configRetention liefert die Aufbewahrung aus Retention bzw. MaxBackups
+func configRetention(config *Config) (retentionPolicy, error) {
+	if config.Retention != "" {
+		return parseRetentionPolicy(config.Retention)
+	}
+	return retentionPolicy{Last: retainedBackups(config)}, nil
+}
+
+// remoteRetention liefert die Aufbewahrung auf dem Remote-Ziel: RemoteRetention oder,
+// wenn leer, dieselbe wie lokal
+func remoteRetention(config *Config) (retentionPolicy, error) {
+	if config.RemoteRetention != "" {
+		return parseRetentionPolicy(config.RemoteRetention)
+	}
+	return configRetention(config)
+}
+
+func (p retentionPolicy) String() string {
+	var parts []string
+	for _, field := range []struct {
+		name  string
+		value int
+	}{{"last", p.Last}, {"hourly", p.Hourly}, {"daily", p.Daily}, {"weekly", p.Weekly}, {"monthly", p.Monthly}, {"yearly", p.Yearly}} {
+		if field.value > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", field.name, field.value))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// apply liefert für jedes aufbewahrte Archiv die Gründe; Einträge ohne eigenes Archiv
+// (SameAs) werden nicht berücksichtigt
+func (p retentionPolicy) apply(entries []CatalogEntry) map[string][]string {
+	var archives []CatalogEntry
+	for _, entry := range entries {
+		if entry.SameAs == "" && entry.File != "" {
+			archives = append(archives, entry)
+		}
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].Created.After(archives[j].Created)
+	})
+
+	kept := make(map[string][]string)
+	for i := 0; i < p.Last && i < len(archives); i++ {
+		kept[archives[i].File] = append(kept[archives[i].File], "last")
+	}
+	buckets := []struct {
+		name  string
+		count int
+		key   func(time.Time) string
+	}{
+		{"hourly", p.Hourly, func(t time.Time) string { return t.Format("2006-01-02 15") }},
+		{"daily", p.Daily, func(t time.Time) string { return t.Format("2006-01-02") }},
+		{"weekly", p.Weekly, func(t time.Time) string {
+			year, week := t.ISOWeek()
+			return fmt.Sprintf("%d-%02d", year, week)
+		}},
+		{"monthly", p.Monthly, func(t time.Time) string { return t.Format("2006-01") }},
+		{"yearly", p.Yearly, func(t time.Time) string { return t.Format("2006") }},
+	}
+	for _, bucket := range buckets {
+		seen := 0
+		last := ""
+		for _, entry := range archives {
+			if seen >= bucket.count {
+				break
+			}
+			// Das neueste Backup jedes Zeitraums bleibt, in Ortszeit gerechnet
+			key := bucket.key(entry.Created.Local())
+			if key == last {
+				continue
+			}
+			last = key
+			seen++
+			kept[entry.File] = append(kept[entry.File], bucket.name)
+		}
+	}
+	return kept
+}
+
+// removals liefert die Archive, die nach der Aufbewahrung gelöscht werden, älteste zuerst
+func (p retentionPolicy) removals(entries []CatalogEntry) []CatalogEntry {
+	kept := p.apply(entries)
+	var removed []CatalogEntry
+	for _, entry := range entries {
+		if entry.SameAs == "" && entry.File != "" && kept[entry.File] == nil {
+			removed = append(removed, entry)
+		}
+	}
+	return removed
+}
+
+// applyRetention löscht vor einem Backup die Archive des Projekts, die nicht unter Retention fallen
+func applyRetention(config *Config, project string) error {
+	policy, err := parseRetentionPolicy(config.Retention)
+	if err != nil {
+		return err
+	}
+	return pruneDir(config.BackupDir, project, policy)
+}
+
+// applyRemoteRetention räumt nach der Übertragung das Remote-Ziel nach RemoteRetention
+// auf; welche Backups dort bleiben, ergibt sich allein aus dessen Katalog
+func applyRemoteRetention(config *Config, project string) error {
+	policy, err := parseRetentionPolicy(config.RemoteRetention)
+	if err != nil {
+		return err
+	}
+	remote, err := openRemote(config)
+	if err != nil {
+		return err
+	}
+	// Auswahl und Löschen unter der Lease, damit kein anderer Rechner dazwischen einträgt
+	return withLease(remote.root, func() error {
+		return pruneDir(remote.root, project, policy)
+	})
+}
+
+// pruneDir löscht in dir die Archive des Projekts, die die Aufbewahrung nicht behält
+func pruneDir(dir, project string, policy retentionPolicy) error {
+	catalog, err := loadCatalog(dir)
+	if err != nil {
+		return err
+	}
+	var files []string
+	for _, entry := range policy.removals(catalog.forProject(project)) {
+		files = append(files, entry.File)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	logMessage(LogInfo, "Aufbewahrung %s: lösche %d alte Backups in %s", policy, len(files), dir)
+	return deleteArchives(dir, files, "Aufbewahrung "+policy.String())
+}
+
+// deleteArchives löscht Archive samt Manifest und entfernt sie aus dem Katalog
+func deleteArchives(dir string, files []string, reason string) error {
+	for _, file := range files {
+		if err := checkLease(dir); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, file)
+		logMessage(LogInfo, "Lösche: %s", path)
+		if err := removeBackup(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("fehler beim Löschen von %s: %v", file, err)
+		}
+		os.Remove(manifestPath(path))
+		os.Remove(attestationPath(path))
+		os.Remove(selfExtractingPath(path))
+		audit("delete", path, reason)
+	}
+	if err := checkLease(dir); err != nil {
+		return err
+	}
+	if err := collectSnapshotStore(dir); err != nil {
+		logMessage(LogWarning, "%v", err)
+	}
+	return updateCatalog(dir, func(c *Catalog) {
+		for _, file := range files {
+			c.removeArchive(file)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// runGuarded sichert das Projekt, führt danach einen Befehl aus und bietet bei einem
+// Fehlschlag an, den Stand vor dem Befehl wiederherzustellen
+func runGuarded(args []string) error {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Verwendung: backup-tool run -- <befehl> [argumente...]")
+	}
+	flags.Parse(args)
+
+	command := flags.Args()
+	if len(command) == 0 {
+		flags.Usage()
+		return fmt.Errorf("kein Befehl angegeben")
+	}
+
+	backupFile := runBackup(backupOptions{Tag: "vor: " + strings.Join(command, " ")})
+
+	// Ctrl-C soll nur den Befehl beenden, damit danach noch zurückgesetzt werden kann
+	signal.Reset(os.Interrupt, syscall.SIGTERM)
+	signal.Ignore(os.Interrupt)
+
+	fmt.Fprintf(os.Stderr, "\nFühre aus: %s\n", strings.Join(command, " "))
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+
+	exitCode := 1
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		exitCode = exitErr.ExitCode()
+	}
+	logMessage(LogError, "Befehl fehlgeschlagen: %v", err)
+
+	if confirmKey(fmt.Sprintf("Stand vor dem Befehl aus %s wiederherstellen?", backupFile)) {
+		_, sourceDir, projectName, err := loadProject()
+		if err != nil {
+			return err
+		}
+		// Die Rückfrage ist bereits erfolgt; vom Befehl neu angelegte Dateien bleiben erhalten
+		if err := restoreBackup(backupFile, projectName, sourceDir, extractOptions{}, true); err != nil {
+			return err
+		}
+	}
+	os.Exit(exitCode)
+	return nil
+}
+
+// confirmKey fragt wie confirm nach, wertet aber schon den ersten Tastendruck aus, ohne
+// dass Enter nötig ist. Ist stdin kein Terminal oder fehlt stty, wird eine Zeile gelesen.
+func confirmKey(question string) bool {
+	if !isTerminal(os.Stdin) {
+		return confirm(question)
+	}
+	saved, err := stty("-g")
+	if err != nil {
+		return confirm(question)
+	}
+	if _, err := stty("-icanon", "-echo", "min", "1"); err != nil {
+		return confirm(question)
+	}
+	defer stty(strings.TrimSpace(saved))
+	// Ctrl-C oder SIGTERM während der Frage würden das Programm beenden, ohne dass die
+	// zurückgestellten Funktionen laufen; dann bliebe das Terminal ohne Echo zurück
+	interruptIgnored := signal.Ignored(os.Interrupt)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	answered := make(chan struct{})
+	defer func() {
+		signal.Stop(signals)
+		close(answered)
+		if interruptIgnored {
+			signal.Ignore(os.Interrupt)
+		}
+	}()
+	go func() {
+		select {
+		case sig := <-signals:
+			stty(strings.TrimSpace(saved))
+			fmt.Println()
+			os.Exit(128 + int(sig.(syscall.Signal)))
+		case <-answered:
+		}
+	}()
+
+	fmt.Printf("%s [j/N] ", question)
+	var key [1]byte
+	n, _ := os.Stdin.Read(key[:])
+	answer := n == 1 && strings.ContainsRune("jJyY", rune(key[0]))
+	if answer {
+		fmt.Println("j")
+	} else {
+		fmt.Println("n")
+	}
+	return answer
+}
+
+// stty ändert die Einstellungen des Terminals an stdin
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
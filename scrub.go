@@ -0,0 +1,127 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runScrub berechnet die Prüfsummen der gespeicherten Archive neu und vergleicht sie mit
+// den Werten aus dem Katalog. So fällt schleichender Datenverlust (Bit-Rot) auf, bevor das
+// Backup gebraucht wird. Archive ohne gespeicherte Prüfsumme werden gegen ihr Manifest
+// geprüft und erhalten danach eine.
+func runScrub(args []string) error {
+	flags := flag.NewFlagSet("scrub", flag.ExitOnError)
+	all := flags.Bool("all", false, "Archive aller Projekte prüfen")
+	fromRemote := flags.Bool("remote", false, "Archive auf dem Remote-Ziel prüfen")
+	maxAge := flags.Duration("max-age", 0, "nur Archive prüfen, deren letzte Prüfung länger zurückliegt (z.B. 720h)")
+	flags.Parse(args)
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	dir := config.BackupDir
+	if *fromRemote {
+		remote, err := openRemote(config)
+		if err != nil {
+			return err
+		}
+		dir = remote.root
+	}
+	catalog, err := loadCatalog(dir)
+	if err != nil {
+		return err
+	}
+
+	checked := make(map[string]time.Time)
+	sums := make(map[string]string)
+	var problems []string
+	for _, entry := range catalog.Backups {
+		if entry.SameAs != "" || (!*all && entry.Project != projectName) {
+			continue
+		}
+		if *maxAge > 0 && time.Since(entry.Verified) < *maxAge {
+			continue
+		}
+		path := filepath.Join(dir, entry.File)
+		if isSnapshot(path) {
+			// Snapshots haben keine Gesamtprüfsumme, jede Datei wird gegen den Index geprüft
+			if err := verifyBackup(path); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", entry.File, err))
+				fmt.Printf("FEHLER  %s: %v\n", entry.File, err)
+				continue
+			}
+			fmt.Printf("OK      %s\n", entry.File)
+			checked[entry.File] = time.Now().UTC()
+			continue
+		}
+		sum, err := hashFile(path)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("%s: %v", entry.File, err))
+			fmt.Printf("FEHLER  %s: %v\n", entry.File, err)
+			continue
+		case entry.SHA256 == "":
+			if _, err := verifyArchiveManifest(path); err != nil {
+				problems = append(problems, fmt.Sprintf("%s: %v", entry.File, err))
+				fmt.Printf("FEHLER  %s: %v\n", entry.File, err)
+				continue
+			}
+			sums[entry.File] = sum
+			fmt.Printf("NEU     %s (Prüfsumme erstmals gespeichert)\n", entry.File)
+		case sum != entry.SHA256:
+			problems = append(problems, fmt.Sprintf("%s: Prüfsumme geändert", entry.File))
+			fmt.Printf("FEHLER  %s: Prüfsumme %s, erwartet %s\n", entry.File, sum[:12], entry.SHA256[:12])
+			continue
+		default:
+			fmt.Printf("OK      %s\n", entry.File)
+		}
+		checked[entry.File] = time.Now().UTC()
+	}
+
+	save := func() error {
+		return updateCatalog(dir, func(c *Catalog) {
+			for i, entry := range c.Backups {
+				if verified, ok := checked[entry.File]; ok {
+					c.Backups[i].Verified = verified
+				}
+				if sum, ok := sums[entry.File]; ok {
+					c.Backups[i].SHA256 = sum
+				}
+			}
+		})
+	}
+	// Geprüft wird ohne Lease, das Eintragen der Ergebnisse braucht sie
+	if *fromRemote {
+		err = withLease(dir, save)
+	} else {
+		err = save()
+	}
+	if err != nil {
+		return fmt.Errorf("fehler beim Speichern der Prüfergebnisse: %v", err)
+	}
+
+	fmt.Printf("\n%d Archive geprüft, %d fehlerhaft\n", len(checked)+len(problems), len(problems))
+	if len(problems) == 0 {
+		return nil
+	}
+	if config.Notify.configured() {
+		host, _ := os.Hostname()
+		err := notify(config.Notify, notification{
+			Subject: fmt.Sprintf("Backup: %d beschädigte Archive in %s (%s)", len(problems), dir, host),
+			Text:    strings.Join(problems, "\n"),
+			Failed:  true,
+			Event:   "failure",
+			Payload: problems,
+			Data:    newRunData(projectName, "", 0, 0, "fehlgeschlagen"),
+		})
+		if err != nil {
+			logMessage(LogWarning, "Warnung konnte nicht verschickt werden: %v", err)
+		}
+	}
+	return fmt.Errorf("%d Archive beschädigt oder nicht lesbar", len(problems))
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// secretPatterns beschreiben Dateien, die häufig Schlüssel oder Zugangsdaten enthalten.
+// Die Syntax entspricht den Excludes.
+var secretPatterns = []string{
+	"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519",
+	"*.pem", "*.key", "*.p12", "*.pfx", "*.jks", "*.keystore",
+	".env", ".env.*", ".netrc", ".pgpass", ".npmrc", ".pypirc",
+	"credentials.json", "service-account*.json", "*.tfstate",
+	"**/.aws/credentials", "**/.docker/config.json", "**/.kube/config",
+}
+
+// findSecrets liefert die gesicherten Dateien, die nach Schlüsseln oder Zugangsdaten aussehen
+func findSecrets(files []ManifestFile) []string {
+	var found []string
+	for _, file := range files {
+		if isExcluded(file.Path, false, secretPatterns) {
+			found = append(found, file.Path)
+		}
+	}
+	return found
+}
+
+// checkSecrets warnt vor mitgesicherten Zugangsdaten; mit strict ist das ein Fehler
+func checkSecrets(files []ManifestFile, encrypted, strict bool) error {
+	secrets := findSecrets(files)
+	if len(secrets) == 0 {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("%d Dateien mit möglichen Zugangsdaten im Backup: %v (mit Excludes ausschließen oder ohne --strict-secrets sichern)", len(secrets), secrets)
+	}
+	note := "und werden unverschlüsselt gespeichert"
+	if encrypted {
+		note = "(Archiv ist verschlüsselt)"
+	}
+	logMessage(LogWarning, "%d Dateien sehen nach Schlüsseln oder Zugangsdaten aus %s:", len(secrets), note)
+	for _, secret := range secrets {
+		fmt.Fprintf(os.Stderr, "  %s\n", secret)
+	}
+	return nil
+}
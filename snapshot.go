@@ -0,0 +1,461 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// Mit Format "snapshot" entsteht statt eines Archivs ein Verzeichnis, dessen Dateien
+// Hardlinks in einen gemeinsamen, nach SHA-256 adressierten Speicher sind. Gleiche
+// Dateien (mitgelieferte Abhängigkeiten, Assets) belegen so über alle Projekte und
+// Backups hinweg nur einmal Platz. Rechte, Zeiten und Besitzer stehen im Index, da sich
+// alle Hardlinks einer Datei dieselben Angaben teilen; die Dateien im Speicher sind
+// schreibgeschützt, weil eine Änderung alle Backups mit diesem Inhalt träfe.
+const (
+	snapshotExtension = ".snapshot"
+	snapshotStoreDir  = ".backup-store"
+	snapshotIndexName = ".backup-index.json"
+	// Zwischenstand langer Läufe; ein abgebrochener Snapshot wird beim nächsten Backup
+	// fortgesetzt, statt bereits gespeicherte Dateien erneut zu lesen
+	snapshotCheckpointName = ".backup-checkpoint.json"
+	checkpointInterval     = 10 * time.Second
+)
+
+// snapshotEntry ist ein Eintrag im Index; RawName bewahrt Namen mit ungültigem UTF-8
+type snapshotEntry struct {
+	tar.Header
+	RawName []byte `json:",omitempty"`
+	SHA256  string `json:",omitempty"`
+}
+
+// isSnapshot erkennt Backups im Format "snapshot"
+func isSnapshot(backupPath string) bool {
+	if !strings.HasSuffix(backupPath, snapshotExtension) {
+		return false
+	}
+	info, err := os.Stat(backupPath)
+	return err == nil && info.IsDir()
+}
+
+// snapshotWriter legt die Einträge eines Backups als Verzeichnis an und übernimmt
+// den Inhalt regulärer Dateien in den Speicher
+type snapshotWriter struct {
+	dir, store string
+	entries    []snapshotEntry
+	current    *os.File
+	hash       hash.Hash
+	written    int64 // Bytes der aktuellen Datei
+	Stored     int64 // Bytes, die neu in den Speicher aufgenommen wurden
+	checkpoint snapshotCheckpoint
+	saved      time.Time      // letzter gespeicherter Zwischenstand
+	reused     *snapshotEntry // von reuse bestätigte Datei, deren Header als Nächstes kommt
+}
+
+// snapshotCheckpoint sind die Einträge eines abgebrochenen Snapshots nach Namen
+type snapshotCheckpoint map[string]snapshotEntry
+
+// lookup liefert die Prüfsumme einer unveränderten Datei aus dem Zwischenstand
+func (c snapshotCheckpoint) lookup(name string, size int64, modTime time.Time) (string, bool) {
+	entry, ok := c[name]
+	if !ok || entry.Typeflag != tar.TypeReg || entry.SHA256 == "" || entry.Size != size || !entry.ModTime.Equal(modTime) {
+		return "", false
+	}
+	return entry.SHA256, true
+}
+
+// findSnapshotCheckpoint sucht den neuesten abgebrochenen Snapshot eines Projekts
+func findSnapshotCheckpoint(backupDir, project string) (string, snapshotCheckpoint, error) {
+	matches, err := filepath.Glob(filepath.Join(backupDir, project+"_backup_*"+snapshotExtension))
+	if err != nil {
+		return "", nil, err
+	}
+	for i := len(matches) - 1; i >= 0; i-- {
+		if _, err := os.Stat(filepath.Join(matches[i], snapshotIndexName)); err == nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(matches[i], snapshotCheckpointName))
+		if err != nil {
+			continue
+		}
+		var entries []snapshotEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return "", nil, fmt.Errorf("zwischenstand von %s: %v", filepath.Base(matches[i]), err)
+		}
+		checkpoint := make(snapshotCheckpoint, len(entries))
+		for _, entry := range entries {
+			if entry.RawName != nil {
+				entry.Name = string(entry.RawName)
+			}
+			checkpoint[entry.Name] = entry
+		}
+		return matches[i], checkpoint, nil
+	}
+	return "", nil, nil
+}
+
+func newSnapshotWriter(dir, store string, checkpoint snapshotCheckpoint) (*snapshotWriter, error) {
+	for _, sub := range []string{dir, filepath.Join(store, "objects"), filepath.Join(store, "tmp")} {
+		if err := os.MkdirAll(sub, 0755); err != nil {
+			return nil, err
+		}
+	}
+	return &snapshotWriter{dir: dir, store: store, checkpoint: checkpoint, saved: time.Now()}, nil
+}
+
+func (s *snapshotWriter) target(name string) (string, error) {
+	target := filepath.Join(s.dir, filepath.FromSlash(cleanArchivePath(name)))
+	if !isWithin(s.dir, target) {
+		return "", fmt.Errorf("eintrag liegt außerhalb des Snapshots: %s", name)
+	}
+	return target, nil
+}
+
+// reuse entscheidet, ob eine unveränderte Datei aus dem abgebrochenen Lauf übernommen
+// wird: nur wenn der Zwischenstand passt und die Datei im Snapshot noch vorhanden ist.
+// Bei true schreibt der Aufrufer nur den Header und keinen Inhalt.
+func (s *snapshotWriter) reuse(name string, size int64, modTime time.Time) (string, bool) {
+	sum, ok := s.checkpoint.lookup(name, size, modTime)
+	if !ok {
+		return "", false
+	}
+	target, err := s.target(name)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Lstat(target); err != nil || !info.Mode().IsRegular() || info.Size() != size {
+		return "", false
+	}
+	s.reused = &snapshotEntry{Header: tar.Header{Name: name, Size: size}, SHA256: sum}
+	return sum, true
+}
+
+func (s *snapshotWriter) WriteHeader(header *tar.Header) error {
+	if err := s.finish(); err != nil {
+		return err
+	}
+	if time.Since(s.saved) >= checkpointInterval {
+		if err := s.saveCheckpoint(); err != nil {
+			logMessage(LogWarning, "Zwischenstand konnte nicht gespeichert werden: %v", err)
+		}
+	}
+	entry := snapshotEntry{Header: *header}
+	if !utf8.ValidString(header.Name) {
+		entry.RawName = []byte(header.Name)
+	}
+	s.entries = append(s.entries, entry)
+
+	target, err := s.target(header.Name)
+	if err != nil {
+		return err
+	}
+	if reused := s.reused; reused != nil {
+		s.reused = nil
+		if header.Typeflag != tar.TypeReg || header.Name != reused.Name || header.Size != reused.Size {
+			return fmt.Errorf("übernommene Datei %s passt nicht zum Header %s", reused.Name, header.Name)
+		}
+		// Unveränderte Datei eines abgebrochenen Laufs, liegt schon im Snapshot
+		s.entries[len(s.entries)-1].SHA256 = reused.SHA256
+		return nil
+	}
+	if header.Typeflag != tar.TypeDir {
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if s.checkpoint != nil {
+			os.Remove(target)
+		}
+	}
+	switch header.Typeflag {
+	case tar.TypeDir:
+		// Rechte aus dem Index gelten erst beim Wiederherstellen, damit der Snapshot beschreibbar bleibt
+		return os.MkdirAll(target, 0755)
+	case tar.TypeSymlink:
+		return os.Symlink(header.Linkname, target)
+	case tar.TypeLink:
+		source, err := s.target(header.Linkname)
+		if err != nil {
+			return err
+		}
+		return os.Link(source, target)
+	case tar.TypeReg:
+		if header.Size == 0 {
+			// Leere Dateien nicht teilen, sonst erreicht ihr Inhalt schnell die Hardlink-Grenze
+			return os.WriteFile(target, nil, 0444)
+		}
+		f, err := os.CreateTemp(filepath.Join(s.store, "tmp"), "object-*")
+		if err != nil {
+			return err
+		}
+		s.current, s.hash, s.written = f, sha256.New(), 0
+		return nil
+	}
+	// Geräte und FIFOs stehen nur im Index
+	return nil
+}
+
+func (s *snapshotWriter) Write(p []byte) (int, error) {
+	if s.current == nil {
+		return len(p), nil
+	}
+	s.hash.Write(p)
+	n, err := s.current.Write(p)
+	s.written += int64(n)
+	return n, err
+}
+
+// finish übernimmt die zuletzt geschriebene Datei in den Speicher und verlinkt sie
+func (s *snapshotWriter) finish() error {
+	if s.current == nil {
+		return nil
+	}
+	tmp := s.current.Name()
+	defer os.Remove(tmp)
+	err := s.current.Close()
+	s.current = nil
+	if err != nil {
+		return err
+	}
+	entry := &s.entries[len(s.entries)-1]
+	if s.written != entry.Size {
+		// Nie eine unvollständige Datei verlinken, ihr Inhalt fehlte sonst ohne Fehlermeldung
+		return fmt.Errorf("%s: %d von %d Bytes geschrieben", entry.Name, s.written, entry.Size)
+	}
+	entry.SHA256 = hex.EncodeToString(s.hash.Sum(nil))
+	object := snapshotObject(s.store, entry.SHA256)
+	if err := os.MkdirAll(filepath.Dir(object), 0755); err != nil {
+		return err
+	}
+	// os.Link statt Umbenennen: gleichzeitige Backups mit demselben Inhalt teilen sich ein Objekt
+	if err := os.Chmod(tmp, 0444); err != nil {
+		return err
+	}
+	if err := os.Link(tmp, object); err == nil {
+		s.Stored += entry.Size
+	} else if !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	target, err := s.target(entry.Name)
+	if err != nil {
+		return err
+	}
+	if err := os.Link(object, target); err != nil {
+		if !errors.Is(err, syscall.EMLINK) {
+			return err
+		}
+		// Hardlink-Grenze des Dateisystems erreicht: eigene Kopie statt eines weiteren Links
+		s.Stored += entry.Size
+		return copyFile(object, target)
+	}
+	return nil
+}
+
+func (s *snapshotWriter) Close() error {
+	if err := s.finish(); err != nil {
+		return err
+	}
+	if s.checkpoint != nil {
+		if err := s.removeStale(); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(s.dir, snapshotIndexName), data, 0444); err != nil {
+		return err
+	}
+	os.Remove(filepath.Join(s.dir, snapshotCheckpointName))
+	return nil
+}
+
+// saveCheckpoint speichert die vollständig geschriebenen Einträge als Zwischenstand
+func (s *snapshotWriter) saveCheckpoint() error {
+	s.saved = time.Now()
+	data, err := json.Marshal(s.entries)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, snapshotCheckpointName)
+	if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// removeStale löscht beim Fortsetzen, was aus dem abgebrochenen Lauf stammt und in der
+// Quelle nicht mehr vorkommt
+func (s *snapshotWriter) removeStale() error {
+	keep := map[string]bool{snapshotCheckpointName: true}
+	for _, entry := range s.entries {
+		name := cleanArchivePath(entry.Name)
+		for name != "." && name != "" {
+			keep[name] = true
+			name = path.Dir(name)
+		}
+	}
+	return filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == s.dir {
+			return err
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil || keep[filepath.ToSlash(rel)] {
+			return err
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+func snapshotObject(store, sum string) string {
+	return filepath.Join(store, "objects", sum[:2], sum)
+}
+
+// snapshotReader liefert die Einträge eines Snapshots in der Reihenfolge des Index und
+// prüft den Inhalt jeder Datei gegen ihre Prüfsumme
+type snapshotReader struct {
+	dir     string
+	entries []snapshotEntry
+	next    int
+	current *os.File
+	hash    hash.Hash
+	sum     string
+}
+
+func openSnapshot(dir string) (*snapshotReader, error) {
+	data, err := os.ReadFile(filepath.Join(dir, snapshotIndexName))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot ohne Index: %v", err)
+	}
+	var entries []snapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("index von %s: %v", filepath.Base(dir), err)
+	}
+	return &snapshotReader{dir: dir, entries: entries}, nil
+}
+
+func (r *snapshotReader) Next() (*tar.Header, error) {
+	r.closeCurrent()
+	if r.next >= len(r.entries) {
+		return nil, io.EOF
+	}
+	entry := r.entries[r.next]
+	r.next++
+	header := entry.Header
+	if entry.RawName != nil {
+		header.Name = string(entry.RawName)
+	}
+	if header.Typeflag == tar.TypeReg && header.Size > 0 {
+		f, err := os.Open(filepath.Join(r.dir, filepath.FromSlash(cleanArchivePath(header.Name))))
+		if err != nil {
+			return nil, err
+		}
+		r.current, r.hash, r.sum = f, sha256.New(), entry.SHA256
+	}
+	return &header, nil
+}
+
+func (r *snapshotReader) Read(p []byte) (int, error) {
+	if r.current == nil {
+		return 0, io.EOF
+	}
+	n, err := r.current.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(r.hash.Sum(nil)) != r.sum {
+		return n, fmt.Errorf("inhalt von %s stimmt nicht mit der Prüfsumme im Index überein", r.current.Name())
+	}
+	return n, err
+}
+
+func (r *snapshotReader) closeCurrent() {
+	if r.current != nil {
+		r.current.Close()
+		r.current = nil
+	}
+}
+
+func (r *snapshotReader) Close() error {
+	r.closeCurrent()
+	return nil
+}
+
+// removeBackup löscht ein Archiv oder einen Snapshot
+func removeBackup(backupPath string) error {
+	if isSnapshot(backupPath) {
+		return os.RemoveAll(backupPath)
+	}
+	return os.Remove(backupPath)
+}
+
+// findSnapshotStore sucht den Speicher im Backup-Verzeichnis oder, beim Layout
+// "project", eine Ebene darüber; "" wenn es keinen gibt
+func findSnapshotStore(backupDir string) string {
+	for _, dir := range []string{backupDir, filepath.Dir(backupDir)} {
+		store := filepath.Join(dir, snapshotStoreDir)
+		if info, err := os.Stat(store); err == nil && info.IsDir() {
+			return store
+		}
+	}
+	return ""
+}
+
+// collectSnapshotStore entfernt Objekte, auf die kein Snapshot mehr verweist, und
+// liegengebliebene temporäre Dateien abgebrochener Läufe
+func collectSnapshotStore(backupDir string) error {
+	store := findSnapshotStore(backupDir)
+	if store == "" {
+		return nil
+	}
+	var removed int
+	var freed int64
+	err := filepath.WalkDir(filepath.Join(store, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok && stat.Nlink == 1 {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+			freed += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("aufräumen des Snapshot-Speichers: %v", err)
+	}
+	if tmp, err := os.ReadDir(filepath.Join(store, "tmp")); err == nil {
+		for _, entry := range tmp {
+			if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > 24*time.Hour {
+				os.Remove(filepath.Join(store, "tmp", entry.Name()))
+			}
+		}
+	}
+	if removed > 0 {
+		logMessage(LogInfo, "Snapshot-Speicher: %d nicht mehr verwendete Objekte gelöscht (%s)", removed, formatSize(freed))
+	}
+	return nil
+}
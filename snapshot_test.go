@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResumedSnapshotRewritesMissingFiles(t *testing.T) {
+	src := t.TempDir()
+	for name, body := range map[string]string{"a.txt": "alpha", "b.txt": "bravo"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backupDir := t.TempDir()
+	opts := archiveOptions{Project: "p", Format: "snapshot", Store: filepath.Join(backupDir, snapshotStoreDir), Workers: 1}
+	first := filepath.Join(backupDir, "p_backup_2024-01-01_12-00-00"+snapshotExtension)
+	if _, err := createBackup(src, first, opts); err != nil {
+		t.Fatal(err)
+	}
+
+	// Abgebrochenen Lauf nachstellen: Index wird zum Zwischenstand, eine Datei fehlt danach
+	index, err := os.ReadFile(filepath.Join(first, snapshotIndexName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(first, snapshotCheckpointName), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(first, snapshotIndexName))
+	if err := os.Remove(filepath.Join(first, "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	previous, checkpoint, err := findSnapshotCheckpoint(backupDir, "p")
+	if err != nil || previous != first {
+		t.Fatalf("Zwischenstand %q nicht gefunden: %v", previous, err)
+	}
+	second := filepath.Join(backupDir, "p_backup_2024-01-02_12-00-00"+snapshotExtension)
+	if err := os.Rename(first, second); err != nil {
+		t.Fatal(err)
+	}
+	opts.checkpoint = checkpoint
+	report, err := createBackup(src, second, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sums := map[string]string{}
+	for _, file := range report.Files {
+		sums[file.Path] = file.SHA256
+	}
+	for name, body := range map[string]string{"a.txt": "alpha", "b.txt": "bravo"} {
+		data, err := os.ReadFile(filepath.Join(second, name))
+		if err != nil || string(data) != body {
+			t.Errorf("%s = %q (%v), erwartet %q", name, data, err, body)
+		}
+		sum := sha256.Sum256([]byte(body))
+		if sums[name] != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: Prüfsumme im Manifest %q passt nicht zum Inhalt", name, sums[name])
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Ist das Backup-Ziel (externe Platte) nicht eingehängt, entsteht das Archiv in SpoolDir
+// und wird beim nächsten Lauf mit erreichbarem Ziel dorthin verschoben. Scheitert die
+// Übertragung auf Remote, merkt sich uploads.json im SpoolDir das Archiv und der nächste
+// Lauf holt sie nach. SpoolDir ist wie ein flaches Backup-Verzeichnis mit eigenem Katalog
+// aufgebaut.
+const uploadQueueName = "uploads.json"
+
+// queuedUpload ist eine noch ausstehende Übertragung auf das Remote-Ziel
+type queuedUpload struct {
+	Project string
+	Entry   CatalogEntry
+	Queued  time.Time
+}
+
+func loadUploadQueue(spoolDir string) ([]queuedUpload, error) {
+	var queue []queuedUpload
+	data, err := os.ReadFile(filepath.Join(spoolDir, uploadQueueName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &queue); err != nil {
+		return nil, fmt.Errorf("fehler beim Lesen von %s: %v", uploadQueueName, err)
+	}
+	return queue, nil
+}
+
+// updateUploadQueue lädt die Warteschlange, wendet change an und speichert sie unter Sperre
+func updateUploadQueue(spoolDir string, change func([]queuedUpload) []queuedUpload) error {
+	if err := os.MkdirAll(spoolDir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(spoolDir, uploadQueueName)
+	return withLock(path, func() error {
+		queue, err := loadUploadQueue(spoolDir)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(change(queue), "", "    ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(path+".tmp", data, 0644); err != nil {
+			return err
+		}
+		return os.Rename(path+".tmp", path)
+	})
+}
+
+// queueUpload vermerkt ein Archiv, dessen Übertragung beim nächsten Lauf nachgeholt wird
+func queueUpload(config *Config, project string, entry CatalogEntry) error {
+	return updateUploadQueue(config.SpoolDir, func(queue []queuedUpload) []queuedUpload {
+		return append(queue, queuedUpload{Project: project, Entry: entry, Queued: time.Now().UTC()})
+	})
+}
+
+// spoolBackupDir lenkt das Backup in SpoolDir um, wenn das Ziel die Vorabprüfung nicht
+// besteht; targetErr ist deren Fehler
+func spoolBackupDir(config *Config, projectName string, targetErr error) error {
+	if config.Format == "snapshot" || config.SpoolDir == "" {
+		// Hardlinks in den gemeinsamen Speicher lassen sich nicht auf ein anderes Laufwerk verschieben
+		return targetErr
+	}
+	logMessage(LogWarning, "%v; sichere in den Zwischenspeicher %s", targetErr, config.SpoolDir)
+	config.BackupDir = config.SpoolDir
+	config.backupRoot = config.SpoolDir
+	auditDir = config.SpoolDir
+	return preflight(config, projectName)
+}
+
+// flushSpool verschiebt zwischengespeicherte Backups des Projekts an das erreichbare Ziel
+// und holt ausstehende Übertragungen nach
+func flushSpool(config *Config, projectName string) {
+	if config.SpoolDir == "" {
+		return
+	}
+	if spool, err := loadCatalog(config.SpoolDir); err != nil {
+		logMessage(LogWarning, "Zwischenspeicher %s: %v", config.SpoolDir, err)
+	} else if entries := spool.forProject(projectName); len(entries) > 0 {
+		var moved []string
+		for _, entry := range entries {
+			if err := moveSpooled(config, entry); err != nil {
+				logMessage(LogWarning, "Backup %s bleibt im Zwischenspeicher: %v", entry.File, err)
+				break
+			}
+			moved = append(moved, entry.File)
+		}
+		if err := updateCatalog(config.SpoolDir, func(c *Catalog) {
+			for _, file := range moved {
+				c.remove(file)
+			}
+		}); err != nil {
+			logMessage(LogWarning, "Zwischenspeicher %s: %v", config.SpoolDir, err)
+		}
+		if len(moved) > 0 {
+			fmt.Fprintln(os.Stderr, colorize(colorGreen, fmt.Sprintf("✓ %d Backups aus dem Zwischenspeicher nach %s verschoben", len(moved), config.BackupDir)))
+		}
+	}
+
+	if config.Remote == "" {
+		return
+	}
+	queue, err := loadUploadQueue(config.SpoolDir)
+	if err != nil {
+		logMessage(LogWarning, "%v", err)
+		return
+	}
+	done := make(map[string]bool)
+	for _, upload := range queue {
+		if upload.Project != projectName {
+			continue
+		}
+		path := filepath.Join(config.BackupDir, upload.Entry.File)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			logMessage(LogInfo, "Ausstehende Übertragung von %s entfällt, das Archiv ist gelöscht", upload.Entry.File)
+			done[upload.Entry.File] = true
+			continue
+		}
+		if err := uploadBackup(config, path, upload.Entry); err != nil {
+			logMessage(LogWarning, "Remote-Ziel weiterhin nicht erreichbar, %s bleibt in der Warteschlange: %v", upload.Entry.File, err)
+			break
+		}
+		fmt.Fprintln(os.Stderr, colorize(colorGreen, "✓ Ausstehendes Backup "+upload.Entry.File+" nach "+config.Remote+" übertragen"))
+		done[upload.Entry.File] = true
+	}
+	if len(done) == 0 {
+		return
+	}
+	err = updateUploadQueue(config.SpoolDir, func(queue []queuedUpload) []queuedUpload {
+		kept := queue[:0]
+		for _, upload := range queue {
+			if upload.Project != projectName || !done[upload.Entry.File] {
+				kept = append(kept, upload)
+			}
+		}
+		return kept
+	})
+	if err != nil {
+		logMessage(LogWarning, "%v", err)
+	}
+}
+
+// moveSpooled verschiebt Archiv samt Begleitdateien und trägt das Backup im Ziel-Katalog ein
+func moveSpooled(config *Config, entry CatalogEntry) error {
+	if entry.SameAs == "" && entry.File != "" {
+		source, target := filepath.Join(config.SpoolDir, entry.File), filepath.Join(config.BackupDir, entry.File)
+		if err := moveFile(source, target); err != nil {
+			return err
+		}
+		// Begleitdateien folgen dem Archiv; fehlt eine, bleibt das Backup trotzdem gültig
+		for _, companion := range []struct {
+			label string
+			path  func(string) string
+		}{
+			{"Manifest", manifestPath},
+			{"Bestätigung", attestationPath},
+			{"Selbstentpacker", selfExtractingPath},
+		} {
+			if _, err := os.Stat(companion.path(source)); err != nil {
+				continue
+			}
+			if err := moveFile(companion.path(source), companion.path(target)); err != nil {
+				logMessage(LogWarning, "%s von %s nicht verschoben: %v", companion.label, entry.File, err)
+			}
+		}
+		audit("move", target, "aus dem Zwischenspeicher "+config.SpoolDir)
+	}
+	return updateCatalog(config.BackupDir, func(c *Catalog) {
+		c.add(entry)
+	})
+}
+
+// limitSpool hält SpoolDir unter SpoolMaxSize, indem die ältesten zwischengespeicherten
+// Backups des Projekts gelöscht werden; das neueste bleibt immer erhalten
+func limitSpool(config *Config, projectName string) error {
+	limit, err := parseSize(config.SpoolMaxSize)
+	if err != nil || limit == 0 {
+		return err
+	}
+	catalog, err := loadCatalog(config.SpoolDir)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, entry := range catalog.Backups {
+		total += entry.Size
+	}
+	entries := catalog.forProject(projectName)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Created.Before(entries[j].Created) })
+	var removed []string
+	for i := 0; total > limit && i < len(entries)-1; i++ {
+		if entries[i].SameAs != "" || entries[i].File == "" {
+			continue
+		}
+		removed = append(removed, entries[i].File)
+		total -= entries[i].Size
+	}
+	if len(removed) > 0 {
+		logMessage(LogWarning, "Zwischenspeicher über SpoolMaxSize %s, lösche %d ältere Backups, die das Ziel nie erreicht haben",
+			formatSize(limit), len(removed))
+		if err := deleteArchives(config.SpoolDir, removed, "SpoolMaxSize "+config.SpoolMaxSize); err != nil {
+			return err
+		}
+	}
+	if total > limit {
+		logMessage(LogWarning, "Zwischenspeicher belegt %s, mehr als SpoolMaxSize %s", formatSize(total), formatSize(limit))
+	}
+	return nil
+}
+
+// runSpool zeigt zwischengespeicherte Backups und ausstehende Übertragungen; mit --flush
+// werden sie sofort nachgeholt, z.B. nachdem die externe Platte wieder angeschlossen ist
+func runSpool(args []string) error {
+	flags := flag.NewFlagSet("spool", flag.ExitOnError)
+	flush := flags.Bool("flush", false, "zwischengespeicherte Backups jetzt an das Ziel verschieben und übertragen")
+	flags.Parse(args)
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	if config.SpoolDir == "" {
+		return fmt.Errorf("kein Zwischenspeicher konfiguriert (SpoolDir in config.json)")
+	}
+	if *flush {
+		if err := preflight(config, projectName); err != nil {
+			return fmt.Errorf("backup-Ziel nicht verfügbar: %v", err)
+		}
+		if err := os.MkdirAll(config.BackupDir, 0755); err != nil {
+			return err
+		}
+		flushSpool(config, projectName)
+	}
+
+	catalog, err := loadCatalog(config.SpoolDir)
+	if err != nil {
+		return err
+	}
+	queue, err := loadUploadQueue(config.SpoolDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range catalog.forProject(projectName) {
+		fmt.Printf("Zwischengespeichert  %s (%s)\n", entry.File, formatSize(entry.Size))
+	}
+	for _, upload := range queue {
+		if upload.Project == projectName {
+			fmt.Printf("Nicht übertragen     %s seit %s\n", upload.Entry.File, formatDateTime(upload.Queued))
+		}
+	}
+	return nil
+}
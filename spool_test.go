@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMoveSpooledTakesCompanions(t *testing.T) {
+	config := &Config{SpoolDir: t.TempDir(), BackupDir: t.TempDir()}
+	archive := filepath.Join(config.SpoolDir, "p_backup_2024-01-01_12-00-00.tar.gz")
+	for _, path := range []string{archive, manifestPath(archive), attestationPath(archive), selfExtractingPath(archive)} {
+		if err := os.WriteFile(path, []byte("inhalt"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := moveSpooled(config, CatalogEntry{Project: "p", File: filepath.Base(archive)}); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(config.BackupDir, filepath.Base(archive))
+	for _, path := range []string{moved, manifestPath(moved), attestationPath(moved), selfExtractingPath(moved)} {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s fehlt im Ziel: %v", filepath.Base(path), err)
+		}
+	}
+	left, _ := os.ReadDir(config.SpoolDir)
+	for _, file := range left {
+		t.Errorf("%s liegt noch im Zwischenspeicher", file.Name())
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	stateFileName = "state.json"
+	stateVersion  = 1
+)
+
+// RunState beschreibt den letzten Lauf eines Projekts. Das Schema ist für externe
+// Überwachung gedacht: Felder werden nur ergänzt, nie umbenannt.
+type RunState struct {
+	RunID    string    `json:",omitempty"`
+	Result   string    // "running", "success", "failed" oder "deferred" (geplanter Lauf ausgelassen)
+	Started  time.Time // UTC
+	Finished time.Time `json:",omitempty"`
+	Archive  string    `json:",omitempty"` // vollständiger Pfad des Archivs
+	Error    string    `json:",omitempty"`
+	Warnings []string  `json:",omitempty"`
+	PID      int       `json:",omitempty"` // Prozess des laufenden Backups, für pause und resume
+	Paused   time.Time `json:",omitempty"` // angehalten seit (UTC), leer wenn nicht angehalten
+}
+
+// State ist der Inhalt von state.json im Backup-Verzeichnis, ein Eintrag je Projekt
+type State struct {
+	Version  int
+	Projects map[string]RunState
+	// letzte Warnung, dass das Backup-Ziel bald voll ist; höchstens eine pro Tag
+	CapacityAlert time.Time `json:",omitempty"`
+}
+
+type runRecord struct {
+	backupDir string
+	project   string
+	state     RunState
+	notify    NotifyConfig
+	tracing   TracingConfig
+}
+
+// runID kennzeichnet den laufenden Backup-Vorgang in Logs, Manifest und state.json
+var runID string
+
+func newRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// activeRun ist der laufende Backup-Vorgang, dessen Ergebnis beim Beenden gespeichert wird.
+// Pause und Akkuüberwachung ändern ihn aus eigenen Goroutinen, daher gilt activeRunMu für
+// activeRun und seinen Zustand bis einschließlich des Speicherns.
+var (
+	activeRun   *runRecord
+	activeRunMu sync.Mutex
+)
+
+func loadState(backupDir string) (*State, error) {
+	state := &State{Version: stateVersion, Projects: make(map[string]RunState)}
+	data, err := os.ReadFile(filepath.Join(backupDir, stateFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("fehler beim Lesen von %s: %v", stateFileName, err)
+	}
+	if state.Projects == nil {
+		state.Projects = make(map[string]RunState)
+	}
+	return state, nil
+}
+
+func saveRunState(backupDir, project string, run RunState) error {
+	return updateState(backupDir, func(state *State) {
+		state.Projects[project] = run
+	})
+}
+
+// updateState lädt state.json, wendet change an und speichert die Datei unter Sperre
+func updateState(backupDir string, change func(*State)) error {
+	path := filepath.Join(backupDir, stateFileName)
+	return withLock(path, func() error {
+		state, err := loadState(backupDir)
+		if err != nil {
+			return err
+		}
+		state.Version = stateVersion
+		change(state)
+		data, err := json.MarshalIndent(state, "", "    ")
+		if err != nil {
+			return err
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return err
+		}
+		return os.Rename(tmp, path)
+	})
+}
+
+// startRun vermerkt den Beginn eines Backups, damit auch ein Absturz als "running" sichtbar bleibt
+func startRun(config *Config, project string) {
+	runID = newRunID()
+	logger = logger.With("run_id", runID)
+	logMessage(LogInfo, "Lauf %s", runID)
+	startTrace("backup", map[string]interface{}{"backup.project": project, "backup.run_id": runID})
+	activeRunMu.Lock()
+	defer activeRunMu.Unlock()
+	activeRun = &runRecord{config.BackupDir, project, RunState{RunID: runID, Result: "running", Started: time.Now().UTC(), PID: os.Getpid()},
+		config.Notify, config.Tracing}
+	if err := saveRunState(config.BackupDir, project, activeRun.state); err != nil {
+		logMessage(LogWarning, "Konnte %s nicht schreiben: %v", stateFileName, err)
+	}
+}
+
+// setRunPaused vermerkt in state.json, ob das laufende Backup angehalten ist
+func setRunPaused(paused bool) {
+	activeRunMu.Lock()
+	defer activeRunMu.Unlock()
+	run := activeRun
+	if run == nil {
+		return
+	}
+	run.state.Paused = time.Time{}
+	if paused {
+		run.state.Paused = time.Now().UTC()
+	}
+	if err := saveRunState(run.backupDir, run.project, run.state); err != nil {
+		logMessage(LogWarning, "Konnte %s nicht schreiben: %v", stateFileName, err)
+	}
+}
+
+// finishRun speichert das Ergebnis des laufenden Backups; ohne laufendes Backup passiert nichts
+func finishRun(archive string, runErr error) {
+	activeRunMu.Lock()
+	if activeRun == nil {
+		activeRunMu.Unlock()
+		return
+	}
+	run := activeRun
+	activeRun = nil
+	run.state.Finished = time.Now().UTC()
+	run.state.Paused = time.Time{}
+	run.state.Archive = archive
+	run.state.Warnings = runWarnings
+	run.state.Result = "success"
+	phase := "finished"
+	if runErr != nil {
+		run.state.Result = "failed"
+		run.state.Error = runErr.Error()
+		phase = "failed"
+	}
+	if err := saveRunState(run.backupDir, run.project, run.state); err != nil {
+		fmt.Fprintf(os.Stderr, "Konnte %s nicht schreiben: %v\n", stateFileName, err)
+	}
+	activeRunMu.Unlock()
+	events.phaseChange(phase)
+	if err := exportTrace(run.tracing, runErr); err != nil {
+		fmt.Fprintf(os.Stderr, "Trace konnte nicht gesendet werden: %v\n", err)
+	}
+	if run.notify.configured() && os.Getenv("BACKUP_NO_NOTIFY") == "" {
+		notifyRun(run)
+	}
+}
+
+// notifyRun meldet das Ergebnis eines einzelnen Backups
+func notifyRun(run *runRecord) {
+	var size int64
+	if info, err := os.Stat(run.state.Archive); err == nil {
+		size = info.Size()
+	}
+	data := newRunData(run.project, run.state.Archive, size, run.state.Finished.Sub(run.state.Started), "ok")
+	message := notification{
+		Subject: fmt.Sprintf("Backup %s erstellt (%s)", run.project, formatSize(size)),
+		Text:    run.state.Archive,
+		Event:   "success",
+		Payload: run.state,
+	}
+	if run.state.Result == "failed" {
+		data.Status, data.Error = "fehlgeschlagen", run.state.Error
+		message.Subject = fmt.Sprintf("Backup %s fehlgeschlagen", run.project)
+		message.Text = run.state.Error
+		message.Event, message.Failed = "failure", true
+	}
+	message.Data = data
+	if err := notify(run.notify, message); err != nil {
+		fmt.Fprintf(os.Stderr, "Nachricht konnte nicht verschickt werden: %v\n", err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPauseDuringFinishKeepsResult(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < 20; i++ {
+		activeRunMu.Lock()
+		activeRun = &runRecord{backupDir: dir, project: "p", state: RunState{RunID: "abcd", Result: "running", Started: time.Now().UTC()}}
+		activeRunMu.Unlock()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				setRunPaused(j%2 == 0)
+			}
+		}()
+		finishRun("", nil)
+		wg.Wait()
+
+		state, err := loadState(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run := state.Projects["p"]; run.Result != "success" || !run.Paused.IsZero() {
+			t.Fatalf("Durchlauf %d: Ergebnis %q, angehalten %v", i, run.Result, run.Paused)
+		}
+	}
+}
+
+func TestDeferRunKeepsRunningEntry(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{BackupDir: dir}
+	running := RunState{RunID: "abcd", Result: "running", Started: time.Now().UTC(), PID: 4711}
+	if err := saveRunState(dir, "p", running); err != nil {
+		t.Fatal(err)
+	}
+	deferRun(config, "p", "Akku schwach")
+	deferRun(config, "q", "Akku schwach")
+
+	state, err := loadState(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run := state.Projects["p"]; run.Result != "running" || run.PID != 4711 {
+		t.Errorf("laufendes Backup überschrieben: %+v", run)
+	}
+	if run := state.Projects["q"]; run.Result != "deferred" {
+		t.Errorf("zurückgestelltes Backup nicht vermerkt: %+v", run)
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runStats zeigt den Verlauf von Archivgröße und Dauer als Sparklines, das Wachstum
+// und wann das Backup-Ziel bei gleichbleibendem Wachstum voll ist
+func runStats(args []string) error {
+	flags := flag.NewFlagSet("stats", flag.ExitOnError)
+	all := flags.Bool("all", false, "alle Projekte im Backup-Verzeichnis statt nur des aktuellen")
+	last := flags.Int("last", 40, "Anzahl der Backups in den Verläufen")
+	flags.Parse(args)
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	catalog, err := statsCatalog(config, *all)
+	if err != nil {
+		return err
+	}
+	projects := []string{projectName}
+	if *all {
+		projects = catalog.projects()
+	}
+
+	for _, project := range projects {
+		entries := catalog.forProject(project)
+		var sizes, durations []float64
+		var first, latest time.Time
+		for _, entry := range entries {
+			if entry.SameAs != "" {
+				continue
+			}
+			if first.IsZero() {
+				first = entry.Created
+			}
+			latest = entry.Created
+			sizes = append(sizes, float64(entry.Size))
+			if entry.Duration > 0 {
+				durations = append(durations, entry.Duration.Seconds())
+			}
+		}
+		fmt.Printf("Projekt %s: %d Backups", project, len(entries))
+		if len(sizes) == 0 {
+			fmt.Println()
+			continue
+		}
+		fmt.Printf(" vom %s bis %s\n", formatDateTime(first), formatDateTime(latest))
+		sizes, durations = lastValues(sizes, *last), lastValues(durations, *last)
+		fmt.Printf("  Größe:    %s  %s → %s\n", sparkline(sizes),
+			formatSize(int64(sizes[0])), formatSize(int64(sizes[len(sizes)-1])))
+		if len(durations) > 0 {
+			fmt.Printf("  Dauer:    %s  %s → %s\n", sparkline(durations),
+				secondsString(durations[0]), secondsString(durations[len(durations)-1]))
+		}
+		if growth, ok := sizeGrowth(entries); ok {
+			fmt.Printf("  Wachstum: %s pro Tag\n", signedSize(growth))
+		}
+	}
+
+	forecast, err := forecastCapacity(config.backupRoot, catalog, retainedBackups(config))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("\nZiel %s: %s frei\n", config.backupRoot, formatSize(forecast.Free))
+	fmt.Printf("  Belegung wächst um %s pro Tag, %s\n", signedSize(forecast.Growth), forecast)
+	return nil
+}
+
+// statsCatalog lädt den Katalog des Projekts oder bei all den aller Projekte
+func statsCatalog(config *Config, all bool) (*Catalog, error) {
+	if all && config.Layout == "project" {
+		return loadLayoutCatalogs(config.backupRoot)
+	}
+	return loadCatalog(config.BackupDir)
+}
+
+// projects liefert die Namen aller Projekte im Katalog, sortiert
+func (c *Catalog) projects() []string {
+	seen := make(map[string]bool)
+	var projects []string
+	for _, entry := range c.Backups {
+		if !seen[entry.Project] {
+			seen[entry.Project] = true
+			projects = append(projects, entry.Project)
+		}
+	}
+	sort.Strings(projects)
+	return projects
+}
+
+func retainedBackups(config *Config) int {
+	if config.MaxBackups > 0 {
+		return config.MaxBackups
+	}
+	return defaultConfig.MaxBackups
+}
+
+// capacityForecast schätzt, wann das Backup-Ziel voll ist. Bei voller Aufbewahrung
+// wächst der belegte Platz je Projekt um das Wachstum der Archivgröße mal der Anzahl
+// aufbewahrter Backups.
+type capacityForecast struct {
+	Free   int64
+	Growth float64 // Bytes pro Tag
+	Days   float64 // Tage bis das Ziel voll ist; < 0 = nicht absehbar
+}
+
+func forecastCapacity(dir string, catalog *Catalog, keep int) (capacityForecast, error) {
+	free, err := freeSpace(dir)
+	if err != nil {
+		return capacityForecast{}, err
+	}
+	forecast := capacityForecast{Free: free, Days: -1}
+	for _, project := range catalog.projects() {
+		if growth, ok := sizeGrowth(catalog.forProject(project)); ok {
+			forecast.Growth += growth * float64(keep)
+		}
+	}
+	if forecast.Growth > 0 {
+		forecast.Days = float64(free) / forecast.Growth
+	}
+	return forecast, nil
+}
+
+func (f capacityForecast) String() string {
+	if f.Days < 0 {
+		return "kein Engpass absehbar"
+	}
+	full := time.Now().Add(time.Duration(f.Days * float64(24*time.Hour)))
+	return fmt.Sprintf("voll in etwa %.0f Tagen (um den %s)", math.Floor(f.Days), formatDate(full))
+}
+
+// sizeGrowth liefert den Anstieg der Archivgröße in Bytes pro Tag (lineare Regression)
+func sizeGrowth(entries []CatalogEntry) (float64, bool) {
+	var xs, ys []float64
+	for _, entry := range entries {
+		if entry.SameAs != "" || entry.Size == 0 {
+			continue
+		}
+		xs = append(xs, entry.Created.Sub(entries[0].Created).Hours()/24)
+		ys = append(ys, float64(entry.Size))
+	}
+	if len(xs) < 2 {
+		return 0, false
+	}
+	var meanX, meanY float64
+	for i := range xs {
+		meanX += xs[i]
+		meanY += ys[i]
+	}
+	meanX /= float64(len(xs))
+	meanY /= float64(len(ys))
+	var cov, variance float64
+	for i := range xs {
+		cov += (xs[i] - meanX) * (ys[i] - meanY)
+		variance += (xs[i] - meanX) * (xs[i] - meanX)
+	}
+	if variance == 0 {
+		return 0, false
+	}
+	return cov / variance, true
+}
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline stellt die Werte als Balken zwischen Minimum und Maximum dar
+func sparkline(values []float64) string {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if max > min {
+			i = int((v - min) / (max - min) * float64(len(sparkChars)-1))
+		}
+		b.WriteRune(sparkChars[i])
+	}
+	return b.String()
+}
+
+func lastValues(values []float64, n int) []float64 {
+	if n > 0 && len(values) > n {
+		return values[len(values)-n:]
+	}
+	return values
+}
+
+func secondsString(seconds float64) string {
+	d := time.Duration(seconds * float64(time.Second))
+	if d < 10*time.Second {
+		return d.Round(100 * time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
+
+func signedSize(bytes float64) string {
+	if bytes < 0 {
+		return "-" + formatSize(int64(-bytes))
+	}
+	return "+" + formatSize(int64(bytes))
+}
+
+const defaultCapacityWarningDays = 30
+
+// checkCapacity warnt, wenn das Backup-Ziel beim bisherigen Wachstum bald voll ist, und
+// verschickt dazu höchstens einmal am Tag eine Nachricht
+func checkCapacity(config *Config) {
+	days := config.CapacityWarningDays
+	if days < 0 {
+		return
+	}
+	if days == 0 {
+		days = defaultCapacityWarningDays
+	}
+	catalog, err := statsCatalog(config, true)
+	if err != nil {
+		return
+	}
+	forecast, err := forecastCapacity(config.backupRoot, catalog, retainedBackups(config))
+	if err != nil || forecast.Days < 0 || forecast.Days >= float64(days) {
+		return
+	}
+	subject := fmt.Sprintf("Backup-Ziel %s ist bald voll", config.backupRoot)
+	text := fmt.Sprintf("%s frei, die Belegung wächst um %s pro Tag: %s", formatSize(forecast.Free), signedSize(forecast.Growth), forecast)
+	logMessage(LogWarning, "%s: %s", subject, text)
+
+	if !config.Notify.configured() {
+		return
+	}
+	state, err := loadState(config.backupRoot)
+	if err != nil || time.Since(state.CapacityAlert) < 24*time.Hour {
+		return
+	}
+	err = notify(config.Notify, notification{
+		Subject: subject,
+		Text:    text,
+		Failed:  true,
+		Event:   "capacity",
+		Payload: forecast,
+		Data:    newRunData("", "", forecast.Free, 0, "fehlgeschlagen"),
+	})
+	if err != nil {
+		logMessage(LogWarning, "Warnung konnte nicht verschickt werden: %v", err)
+		return
+	}
+	updateState(config.backupRoot, func(s *State) { s.CapacityAlert = time.Now().UTC() })
+}
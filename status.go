@@ -0,0 +1,147 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// runStatus fasst den Zustand der Backups des Projekts zusammen: letztes Backup,
+// geplanter nächster Lauf, Aufbewahrung, Remote-Abgleich und Warnungen
+func runStatus(args []string) error {
+	flags := flag.NewFlagSet("status", flag.ExitOnError)
+	flags.Parse(args)
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	catalog, err := loadCatalog(config.BackupDir)
+	if err != nil {
+		return err
+	}
+	entries := catalog.forProject(projectName)
+
+	fmt.Printf("Projekt:         %s\n", projectName)
+	if len(entries) == 0 {
+		fmt.Println("Letztes Backup:  keines")
+	} else {
+		last := entries[len(entries)-1]
+		size := formatSize(last.Size)
+		if last.SameAs != "" {
+			size = "identisch mit " + last.SameAs
+		}
+		fmt.Printf("Letztes Backup:  %s, vor %s (%s)\n", formatDateTime(last.Created),
+			time.Since(last.Created).Round(time.Minute), size)
+		fmt.Printf("                 %s\n", filepath.Join(config.BackupDir, last.File))
+	}
+	state, err := loadState(config.BackupDir)
+	if err != nil {
+		return err
+	}
+	run, hasRun := state.Projects[projectName]
+	if hasRun {
+		switch run.Result {
+		case "failed":
+			fmt.Printf("Letzter Lauf:    FEHLGESCHLAGEN am %s: %s\n", formatDateTime(run.Finished), run.Error)
+		case "deferred":
+			fmt.Printf("Letzter Lauf:    zurückgestellt am %s: %s\n", formatDateTime(run.Finished), run.Error)
+		case "running":
+			fmt.Printf("Letzter Lauf:    gestartet am %s, nicht beendet\n", formatDateTime(run.Started))
+			if !run.Paused.IsZero() {
+				fmt.Printf("                 angehalten seit %s (fortsetzen mit \"backup-tool resume\")\n", formatDateTime(run.Paused))
+			}
+		default:
+			fmt.Printf("Letzter Lauf:    erfolgreich am %s\n", formatDateTime(run.Finished))
+		}
+	}
+	fmt.Printf("Nächster Lauf:   %s\n", nextScheduledRun())
+
+	archives, err := projectArchives(config.BackupDir, projectName)
+	if err != nil {
+		return err
+	}
+	maxBackups := config.MaxBackups
+	if maxBackups == 0 {
+		maxBackups = defaultConfig.MaxBackups
+	}
+	fmt.Printf("Aufbewahrt:      %d von höchstens %d Backups\n", len(archives), maxBackups)
+	fmt.Printf("Remote:          %s\n", remoteStatus(config, entries))
+	if catalog, err := statsCatalog(config, true); err == nil {
+		if forecast, err := forecastCapacity(config.backupRoot, catalog, maxBackups); err == nil {
+			fmt.Printf("Speicherplatz:   %s frei, %s\n", formatSize(forecast.Free), forecast)
+		}
+	}
+
+	// state.json kennt auch fehlgeschlagene Läufe, der Katalog nur erfolgreiche
+	var warnings []string
+	if hasRun {
+		warnings = run.Warnings
+	} else if len(entries) > 0 {
+		warnings = entries[len(entries)-1].Warnings
+	}
+	if len(warnings) == 0 {
+		fmt.Println("Warnungen:       keine")
+	} else {
+		fmt.Printf("Warnungen:       %d beim letzten Lauf\n", len(warnings))
+		for _, warning := range warnings {
+			fmt.Printf("  - %s\n", warning)
+		}
+	}
+	return nil
+}
+
+// remoteStatus vergleicht die lokal vorhandenen Backups mit dem Katalog des Remote-Ziels
+func remoteStatus(config *Config, local []CatalogEntry) string {
+	if config.Remote == "" {
+		return "nicht konfiguriert"
+	}
+	remote, err := openRemote(config)
+	if err != nil {
+		return err.Error()
+	}
+	remoteCatalog, err := loadCatalog(remote.root)
+	if err != nil {
+		return err.Error()
+	}
+	missing := 0
+	for _, entry := range local {
+		if entry.SameAs != "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(config.BackupDir, entry.File)); err != nil {
+			continue
+		}
+		if _, ok := remoteCatalog.find(entry.File); !ok {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return fmt.Sprintf("%s, %d Backups noch nicht übertragen", remote.root, missing)
+	}
+	return fmt.Sprintf("%s, alle Backups übertragen", remote.root)
+}
+
+// nextScheduledRun sucht einen systemd-Timer oder cron-Eintrag für das Backup
+func nextScheduledRun() string {
+	if out, err := exec.Command("systemctl", "--user", "list-timers", "--all", "--no-legend").Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if strings.Contains(line, "backup") {
+				return strings.Join(strings.Fields(line), " ")
+			}
+		}
+	}
+	if out, err := exec.Command("crontab", "-l").Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !strings.HasPrefix(line, "#") && strings.Contains(line, "backup") {
+				return "cron: " + line
+			}
+		}
+	}
+	return "kein Timer eingerichtet"
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// runData sind die Angaben eines Laufs, die in Hook-Befehlen, Webhook-Bodys und
+// E-Mail-Betreffs als {{.Project}}, {{.ArchivePath}} usw. verwendet werden können
+type runData struct {
+	Project     string
+	ArchivePath string
+	Size        int64
+	SizeHuman   string
+	Duration    time.Duration
+	Status      string // "läuft", "ok" oder "fehlgeschlagen"
+	RunID       string
+	Error       string // Fehlermeldung bei fehlgeschlagenen Läufen
+	Event       string // Anlass der Nachricht: "success", "failure", "summary" oder "capacity"
+	Subject     string // Standardbetreff der Nachricht
+	Text        string // Standardtext der Nachricht
+}
+
+func newRunData(project, archive string, size int64, duration time.Duration, status string) runData {
+	return runData{
+		Project:     project,
+		ArchivePath: archive,
+		Size:        size,
+		SizeHuman:   formatSize(size),
+		Duration:    duration.Round(time.Second),
+		Status:      status,
+		RunID:       runID,
+	}
+}
+
+var templateFuncs = template.FuncMap{
+	// json gibt einen Wert als JSON aus, z.B. für Texte in Webhook-Bodys: {{json .Text}}
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// shell quotet einen Wert für sh -c; in Hook-Befehlen geschieht das automatisch
+	"shell": func(v interface{}) string {
+		return shellQuote(fmt.Sprint(v))
+	},
+	// raw setzt einen Wert in Hook-Befehlen ungequotet ein: {{.Project | raw}}
+	"raw": func(v interface{}) string {
+		return fmt.Sprint(v)
+	},
+}
+
+func parseTemplate(text string) (*template.Template, error) {
+	return template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// renderTemplate setzt die Angaben des Laufs in text ein
+func renderTemplate(text string, data runData) (string, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderShellTemplate setzt die Angaben des Laufs in einen Befehl für sh -c ein. Jeder Wert
+// wird gequotet und bleibt so ein einzelnes Wort, auch wenn der Projektname Leerzeichen,
+// $, ; oder Anführungszeichen enthält. Im Befehl stehen die Variablen daher ohne eigene
+// Anführungszeichen: cp {{.ArchivePath}} /mnt/usb/
+func renderShellTemplate(text string, data runData) (string, error) {
+	tmpl, err := parseTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	quoteActions(tmpl.Tree.Root)
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// quoteActions hängt an jede Ausgabe des Templates "| shell" an, außer sie endet schon
+// mit shell oder raw
+func quoteActions(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			quoteActions(child)
+		}
+	case *parse.IfNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.RangeNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.WithNode:
+		quoteActions(n.List)
+		quoteActions(n.ElseList)
+	case *parse.ActionNode:
+		// {{$x := ...}} gibt nichts aus
+		if len(n.Pipe.Decl) > 0 {
+			return
+		}
+		last := n.Pipe.Cmds[len(n.Pipe.Cmds)-1]
+		if ident, ok := last.Args[0].(*parse.IdentifierNode); ok && (ident.Ident == "shell" || ident.Ident == "raw") {
+			return
+		}
+		quote := &parse.CommandNode{NodeType: parse.NodeCommand, Pos: n.Pos, Args: []parse.Node{parse.NewIdentifier("shell").SetPos(n.Pos)}}
+		n.Pipe.Cmds = append(n.Pipe.Cmds, quote)
+	}
+}
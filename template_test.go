@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestShellTemplateQuotesValues(t *testing.T) {
+	data := runData{Project: `mein "projekt"; touch pwned $(id) 'x'`, ArchivePath: "/backups/a b.tar.gz", Status: "ok"}
+	for _, tc := range []struct {
+		command string
+		want    string
+	}{
+		{`printf '%s|' {{.Project}}`, data.Project + "|"},
+		{`printf '%s|' {{printf "%s-%s" .Status .ArchivePath}}`, "ok-/backups/a b.tar.gz|"},
+		{`printf '%s|' {{if .Error}}{{.Error}}{{else}}{{.ArchivePath}}{{end}}`, "/backups/a b.tar.gz|"},
+		{`printf '%s|' {{.ArchivePath | shell}}`, "/backups/a b.tar.gz|"},
+		{`printf '%s|' {{.Status | raw}}`, "ok|"},
+	} {
+		command, err := renderShellTemplate(tc.command, data)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.command, err)
+		}
+		out, err := exec.Command("sh", "-c", command).Output()
+		if err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+		if string(out) != tc.want {
+			t.Errorf("%s: Ausgabe %q, erwartet %q", tc.command, out, tc.want)
+		}
+	}
+}
+
+func TestRenderTemplateUnquoted(t *testing.T) {
+	// Webhook-Bodys und Betreffs bleiben ungequotet
+	text, err := renderTemplate("[backup] {{.Project}} {{.Status}}", runData{Project: "a b", Status: "ok"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "[backup] a b ok" {
+		t.Errorf("Betreff %q", text)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Spotlight lässt Verzeichnisse mit dieser Datei aus
+const spotlightMarker = ".metadata_never_index"
+
+// excludeFromSystemBackup nimmt das Backup-Verzeichnis aus Time Machine und Spotlight
+// heraus, damit die Archive nicht ein zweites Mal gesichert und indiziert werden. Die
+// Markierung ist ein erweitertes Attribut am Verzeichnis und bleibt beim Verschieben
+// erhalten; die Datei für Spotlight zeigt, dass beides schon erledigt ist.
+func excludeFromSystemBackup(dir string) error {
+	marker := filepath.Join(dir, spotlightMarker)
+	if _, err := os.Stat(marker); err == nil {
+		return nil
+	}
+	if out, err := exec.Command("tmutil", "addexclusion", dir).CombinedOutput(); err != nil {
+		return fmt.Errorf("tmutil addexclusion: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		return err
+	}
+	logMessage(LogInfo, "%s von Time Machine und Spotlight ausgenommen", dir)
+	return nil
+}
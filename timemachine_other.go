@@ -0,0 +1,8 @@
+//go:build !darwin
+
+package main
+
+// Time Machine und Spotlight gibt es nur unter macOS
+func excludeFromSystemBackup(dir string) error {
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TracingConfig schickt je Lauf einen Trace per OTLP/HTTP (JSON) an einen Collector,
+// z.B. Jaeger, Tempo oder den OpenTelemetry Collector. Ohne Endpoint gelten die
+// Umgebungsvariablen OTEL_EXPORTER_OTLP_TRACES_ENDPOINT bzw. OTEL_EXPORTER_OTLP_ENDPOINT.
+type TracingConfig struct {
+	Endpoint string            // z.B. http://localhost:4318
+	Headers  map[string]string // z.B. für Authentifizierung
+}
+
+// span ist ein Abschnitt des Laufs; der erste Span ist die Wurzel des Traces
+type span struct {
+	name     string
+	id       string
+	parentID string
+	start    time.Time
+	end      time.Time
+	attrs    map[string]interface{}
+	err      error
+}
+
+// tracer sammelt die Spans des laufenden Backups; ohne startTrace bleibt er leer
+var tracer struct {
+	sync.Mutex
+	traceID string
+	root    *span
+	spans   []*span
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// startTrace beginnt den Trace eines Laufs mit dessen Wurzel-Span
+func startTrace(name string, attrs map[string]interface{}) {
+	tracer.Lock()
+	defer tracer.Unlock()
+	tracer.traceID = randomHex(16)
+	tracer.root = &span{name: name, id: randomHex(8), start: time.Now(), attrs: attrs}
+	tracer.spans = []*span{tracer.root}
+}
+
+// startSpan beginnt einen Abschnitt unterhalb von parent (nil = Wurzel)
+func startSpan(name string, parent *span) *span {
+	if parent == nil {
+		events.phaseChange(name)
+	}
+	tracer.Lock()
+	defer tracer.Unlock()
+	s := &span{name: name, id: randomHex(8), start: time.Now(), attrs: map[string]interface{}{}}
+	if parent == nil {
+		parent = tracer.root
+	}
+	if parent != nil {
+		s.parentID = parent.id
+	}
+	if tracer.root != nil {
+		tracer.spans = append(tracer.spans, s)
+	}
+	return s
+}
+
+// finish beendet den Span; err markiert ihn als fehlgeschlagen
+func (s *span) finish(err error) {
+	tracer.Lock()
+	defer tracer.Unlock()
+	s.end = time.Now()
+	s.err = err
+}
+
+func (s *span) set(key string, value interface{}) {
+	tracer.Lock()
+	defer tracer.Unlock()
+	s.attrs[key] = value
+}
+
+func tracesEndpoint(config TracingConfig) string {
+	if config.Endpoint != "" {
+		return strings.TrimSuffix(config.Endpoint, "/") + "/v1/traces"
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// exportTrace beendet den Trace und sendet ihn; ohne Endpoint passiert nichts
+func exportTrace(config TracingConfig, runErr error) error {
+	tracer.Lock()
+	root, spans, traceID := tracer.root, tracer.spans, tracer.traceID
+	tracer.root, tracer.spans = nil, nil
+	tracer.Unlock()
+	endpoint := tracesEndpoint(config)
+	if root == nil || endpoint == "" {
+		return nil
+	}
+	root.finish(runErr)
+
+	var otlpSpans []map[string]interface{}
+	for _, s := range spans {
+		end := s.end
+		if end.IsZero() {
+			// Abschnitte, die ein Fehler unterbrochen hat
+			end = root.end
+		}
+		status := map[string]interface{}{"code": 1}
+		if s.err != nil {
+			status = map[string]interface{}{"code": 2, "message": s.err.Error()}
+		}
+		otlpSpans = append(otlpSpans, map[string]interface{}{
+			"traceId":           traceID,
+			"spanId":            s.id,
+			"parentSpanId":      s.parentID,
+			"name":              s.name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            status,
+		})
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "backup-tool"
+	}
+	host, _ := os.Hostname()
+	body, err := json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": otlpAttributes(map[string]interface{}{"service.name": serviceName, "host.name": host}),
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "backup-tool"},
+				"spans": otlpSpans,
+			}},
+		}},
+	})
+	if err != nil {
+		return err
+	}
+	return postJSON(endpoint, body, config.Headers)
+}
+
+func otlpAttributes(attrs map[string]interface{}) []interface{} {
+	list := []interface{}{}
+	for key, value := range attrs {
+		var v map[string]interface{}
+		switch value := value.(type) {
+		case int:
+			v = map[string]interface{}{"intValue": strconv.Itoa(value)}
+		case int64:
+			v = map[string]interface{}{"intValue": strconv.FormatInt(value, 10)}
+		case bool:
+			v = map[string]interface{}{"boolValue": value}
+		default:
+			v = map[string]interface{}{"stringValue": fmt.Sprint(value)}
+		}
+		list = append(list, map[string]interface{}{"key": key, "value": v})
+	}
+	return list
+}
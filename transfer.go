@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const (
+	transferAttempts = 5
+	transferRetryMax = time.Minute
+)
+
+// throttledReader begrenzt die Lesegeschwindigkeit auf limit Bytes pro Sekunde
+type throttledReader struct {
+	r     io.Reader
+	limit int64
+	start time.Time
+	read  int64
+}
+
+func newThrottledReader(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	return &throttledReader{r: r, limit: limit, start: time.Now()}
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	// Kleine Häppchen, damit die Rate gleichmäßig bleibt
+	if chunk := t.limit / 10; chunk > 0 && int64(len(p)) > chunk {
+		p = p[:chunk]
+	}
+	n, err := t.r.Read(p)
+	t.read += int64(n)
+	expected := time.Duration(float64(t.read) / float64(t.limit) * float64(time.Second))
+	if wait := expected - time.Since(t.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
+
+// progressReader zeigt den Fortschritt einer Übertragung auf stderr an, wenn stderr ein
+// Terminal ist; in Logdateien und Pipes würden die Zeilen nur stören
+type progressReader struct {
+	r         io.Reader
+	hidden    bool
+	label     string
+	done      int64
+	total     int64
+	start     time.Time
+	startDone int64
+	last      time.Time
+}
+
+func newProgressReader(r io.Reader, label string, done, total int64) *progressReader {
+	return &progressReader{r: r, hidden: !isTerminal(os.Stderr), label: label, done: done, total: total,
+		start: time.Now(), startDone: done}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	if time.Since(p.last) > 200*time.Millisecond || err == io.EOF {
+		p.print()
+		p.last = time.Now()
+	}
+	return n, err
+}
+
+func (p *progressReader) print() {
+	if p.hidden {
+		return
+	}
+	percent := 100.0
+	if p.total > 0 {
+		percent = float64(p.done) / float64(p.total) * 100
+	}
+	rate := int64(0)
+	if elapsed := time.Since(p.start).Seconds(); elapsed > 0 {
+		rate = int64(float64(p.done-p.startDone) / elapsed)
+	}
+	fmt.Fprintf(os.Stderr, "\r%s: %5.1f%% %s / %s (%s/s)   ",
+		p.label, percent, formatSize(p.done), formatSize(p.total), formatSize(rate))
+}
+
+func (p *progressReader) finish() {
+	if p.hidden {
+		return
+	}
+	p.print()
+	fmt.Fprintln(os.Stderr)
+}
+
+// isTerminal meldet, ob f mit einem Terminal statt einer Datei oder Pipe verbunden ist
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// resumableCopy kopiert src nach dst über eine .part-Datei. Bricht die Verbindung ab,
+// wird nach einer Pause ab der bereits übertragenen Größe fortgesetzt. check prüft die
+// fertige Teildatei vor dem Umbenennen; scheitert die Prüfung, beginnt die Kopie neu.
+func resumableCopy(src, dst string, limit int64, check func(part string) error) error {
+	part := dst + ".part"
+	wait := 2 * time.Second
+	for attempt := 1; ; attempt++ {
+		err := copyFrom(src, part, limit)
+		if err == nil && check != nil {
+			if err = check(part); err != nil {
+				os.Remove(part)
+			}
+		}
+		if err == nil {
+			return os.Rename(part, dst)
+		}
+		if attempt == transferAttempts {
+			return fmt.Errorf("%v (nach %d Versuchen, Teildatei %s bleibt für einen späteren Versuch erhalten)", err, attempt, part)
+		}
+		logMessage(LogWarning, "Übertragung unterbrochen (%v), setze in %v fort...", err, wait)
+		time.Sleep(wait)
+		if wait *= 2; wait > transferRetryMax {
+			wait = transferRetryMax
+		}
+	}
+}
+
+func copyFrom(src, part string, limit int64) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(part, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	// Eine größere oder abweichende Teildatei stammt von einer anderen Quelle, also neu beginnen
+	if offset > 0 {
+		same, err := samePrefix(in, out, offset)
+		if err != nil {
+			return err
+		}
+		if offset > info.Size() || !same {
+			logMessage(LogWarning, "Teildatei %s passt nicht zur Quelle, beginne neu", part)
+			if err := out.Truncate(0); err != nil {
+				return err
+			}
+			offset, _ = out.Seek(0, io.SeekStart)
+		}
+	}
+	if offset > 0 {
+		logMessage(LogInfo, "Setze Übertragung bei %s fort", formatSize(offset))
+		if _, err := in.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	progress := newProgressReader(newThrottledReader(in, limit), "Übertragung", offset, info.Size())
+	_, err = io.Copy(out, progress)
+	progress.finish()
+	if err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if size, _ := out.Seek(0, io.SeekCurrent); size != info.Size() {
+		return fmt.Errorf("unvollständig übertragen: %d von %d Bytes", size, info.Size())
+	}
+	return nil
+}
+
+// samePrefix vergleicht Anfang und Ende der ersten size Bytes beider Dateien, bevor eine
+// Teildatei fortgesetzt wird. Den ganzen Anfang zu lesen würde die Übertragung wiederholen;
+// die vollständige Prüfung übernimmt check in resumableCopy.
+func samePrefix(a, b io.ReaderAt, size int64) (bool, error) {
+	bufA, bufB := make([]byte, verifySampleSize), make([]byte, verifySampleSize)
+	for _, offset := range []int64{0, max(0, size-verifySampleSize)} {
+		length := min(verifySampleSize, size-offset)
+		n, err := a.ReadAt(bufA[:length], offset)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		m, err := b.ReadAt(bufB[:length], offset)
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+		if n != m || !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCopyFromResumesMatchingPart(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "quelle")
+	data := bytes.Repeat([]byte("0123456789"), 20000)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	part := filepath.Join(dir, "ziel.part")
+	if err := os.WriteFile(part, data[:150000], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyFrom(src, part, 0); err != nil {
+		t.Fatal(err)
+	}
+	if copied, _ := os.ReadFile(part); !bytes.Equal(copied, data) {
+		t.Error("fortgesetzte Kopie weicht von der Quelle ab")
+	}
+}
+
+func TestCopyFromRestartsForeignPart(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "quelle")
+	data := bytes.Repeat([]byte("0123456789"), 20000)
+	if err := os.WriteFile(src, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Gleich lang wie ein Teil der Quelle, aber mit anderem Inhalt am Ende
+	foreign := append([]byte(nil), data[:150000]...)
+	copy(foreign[149990:], "xxxxxxxxxx")
+	part := filepath.Join(dir, "ziel.part")
+	if err := os.WriteFile(part, foreign, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := copyFrom(src, part, 0); err != nil {
+		t.Fatal(err)
+	}
+	if copied, _ := os.ReadFile(part); !bytes.Equal(copied, data) {
+		t.Error("fremde Teildatei wurde fortgesetzt statt neu begonnen")
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+type projectUsage struct {
+	Project  string
+	Archives int
+	Size     int64 // Archive und Manifeste
+}
+
+// runDu zeigt den Platzbedarf der Backups je Projekt und die Kapazität des Ziels
+func runDu(args []string) error {
+	flags := flag.NewFlagSet("du", flag.ExitOnError)
+	fromRemote := flags.Bool("remote", false, "Remote-Ziel statt des lokalen Backup-Verzeichnisses auswerten")
+	flags.Parse(args)
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	dir := config.backupRoot
+	if *fromRemote {
+		remote, err := openRemote(config)
+		if err != nil {
+			return err
+		}
+		dir = remote.root
+	}
+
+	usage, err := backupUsage(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Platzbedarf in %s:\n\n", dir)
+	var total int64
+	for _, u := range usage {
+		marker := " "
+		if u.Project == projectName {
+			marker = "*"
+		}
+		fmt.Printf("%s %-30s %4d Archive %12s\n", marker, u.Project, u.Archives, formatSize(u.Size))
+		total += u.Size
+	}
+	fmt.Printf("\n  %-30s %4d Projekte %11s\n", "Gesamt", len(usage), formatSize(total))
+
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err == nil {
+		capacity := int64(stat.Blocks) * int64(stat.Bsize)
+		available := int64(stat.Bavail) * int64(stat.Bsize)
+		fmt.Printf("\nDateisystem: %s von %s frei (%.0f%%)\n",
+			formatSize(available), formatSize(capacity), float64(available)/float64(capacity)*100)
+	}
+	return nil
+}
+
+// backupUsage summiert Archive und Manifeste je Projekt anhand der Dateinamen, auch in
+// den Projektverzeichnissen des Layouts "project"
+func backupUsage(dir string) ([]projectUsage, error) {
+	byProject := make(map[string]*projectUsage)
+	if err := addBackupUsage(dir, byProject, true); err != nil {
+		return nil, err
+	}
+
+	usage := make([]projectUsage, 0, len(byProject))
+	for _, u := range byProject {
+		usage = append(usage, *u)
+	}
+	sort.Slice(usage, func(i, j int) bool {
+		return usage[i].Size > usage[j].Size
+	})
+	return usage, nil
+}
+
+func addBackupUsage(dir string, byProject map[string]*projectUsage, subdirs bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			if subdirs {
+				addBackupUsage(filepath.Join(dir, name), byProject, false)
+			}
+			continue
+		}
+		i := strings.LastIndex(name, "_backup_")
+		if i <= 0 {
+			continue
+		}
+		isArchive := archiveExtension(name) != ""
+		if !isArchive && !strings.HasSuffix(name, ".manifest.json") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		project := name[:i]
+		u, ok := byProject[project]
+		if !ok {
+			u = &projectUsage{Project: project}
+			byProject[project] = u
+		}
+		u.Size += info.Size()
+		if isArchive {
+			u.Archives++
+		}
+	}
+	return nil
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runConfig behandelt "config validate [--check-remote]"
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return fmt.Errorf("verwendung: config validate [--check-remote]")
+	}
+	flags := flag.NewFlagSet("config validate", flag.ExitOnError)
+	checkRemote := flags.Bool("check-remote", false, "zusätzlich prüfen, ob das Remote-Ziel erreichbar ist")
+	flags.Parse(args[1:])
+
+	filename := configPath()
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		fmt.Fprintf(os.Stderr, "%s nicht vorhanden, es gelten die Standardeinstellungen\n", filename)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(filename)
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+
+	var problems []string
+	for _, key := range unknownConfigKeys(data) {
+		problems = append(problems, fmt.Sprintf("unbekannte Einstellung %q", key))
+	}
+	if err := mergeSharedProfiles(config); err != nil {
+		problems = append(problems, err.Error())
+	}
+	problems = append(problems, validateConfig(config)...)
+	if *checkRemote && config.Remote != "" {
+		if _, err := openRemote(config); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s enthält %d Fehler:%s", filename, len(problems), problemList(problems))
+	}
+	fmt.Fprintln(os.Stderr, colorize(colorGreen, "✓ "+filename+" ist gültig"))
+	return nil
+}
+
+// validateConfig prüft die Werte der Konfiguration und liefert alle Probleme auf einmal
+func validateConfig(config *Config) []string {
+	var problems []string
+	add := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	if config.MaxBackups < 0 {
+		add("MaxBackups darf nicht negativ sein (%d)", config.MaxBackups)
+	}
+	if config.Workers < 0 {
+		add("Workers darf nicht negativ sein (%d)", config.Workers)
+	}
+	if config.MaxThreads < 0 {
+		add("MaxThreads darf nicht negativ sein (%d)", config.MaxThreads)
+	}
+	if config.MinBattery < 0 || config.MinBattery > 100 {
+		add("MinBattery muss zwischen 0 und 100 liegen (%d)", config.MinBattery)
+	}
+	if config.ProjectWorkers < 0 {
+		add("ProjectWorkers darf nicht negativ sein (%d)", config.ProjectWorkers)
+	}
+	if config.Retention != "" {
+		if _, err := parseRetentionPolicy(config.Retention); err != nil {
+			add("Retention: %v", err)
+		}
+	}
+	if config.RemoteRetention != "" {
+		if _, err := parseRetentionPolicy(config.RemoteRetention); err != nil {
+			add("RemoteRetention: %v", err)
+		}
+	}
+	if config.CapacityWarningDays < -1 {
+		add("CapacityWarningDays muss mindestens -1 sein (%d)", config.CapacityWarningDays)
+	}
+	if config.MaxDepth < 0 {
+		add("MaxDepth darf nicht negativ sein (%d)", config.MaxDepth)
+	}
+	if config.MaxPathLength < 0 {
+		add("MaxPathLength darf nicht negativ sein (%d)", config.MaxPathLength)
+	}
+	checkChoice := func(name, value string, choices ...string) {
+		if value != "" && !containsString(choices, value) {
+			add("%s: ungültiger Wert %q (möglich: %s)", name, value, strings.Join(choices, ", "))
+		}
+	}
+	checkChoice("Duplicates", config.Duplicates, "keep", "skip", "marker")
+	checkChoice("SpecialFiles", config.SpecialFiles, "skip", "metadata", "fail")
+	checkChoice("UnreadableFiles", config.UnreadableFiles, "skip", "fail")
+	checkChoice("Format", config.Format, "tar", "zip", "snapshot")
+	checkChoice("RemoteVerify", config.RemoteVerify, "sample", "full", "off")
+	checkChoice("Layout", config.Layout, "flat", "project")
+	checkChoice("LogFormat", config.LogFormat, "text", "json")
+	checkChoice("NormalizeNames", strings.ToLower(config.NormalizeNames), normalizationForms...)
+	checkChoice("LogLevel", config.LogLevel, "debug", "info", "warn", "error")
+	checkChoice("DateFormat", strings.ToLower(config.DateFormat), "de", "iso", "us")
+	checkChoice("TimestampStyle", config.TimestampStyle, "legacy", "iso8601")
+	if zone := strings.ToLower(config.TimeZone); zone != "" && zone != "local" && zone != "utc" {
+		if _, err := time.LoadLocation(config.TimeZone); err != nil {
+			add("TimeZone: unbekannte Zeitzone %q", config.TimeZone)
+		}
+	}
+	for _, kind := range config.SkipContent {
+		checkChoice("SkipContent", kind, contentKinds...)
+	}
+	if len(config.FilterCommand) > 0 && config.FilterCommand[0] == "" {
+		add("FilterCommand: kein Programm angegeben")
+	}
+	if config.AttestationKey != "" {
+		if _, err := loadAttestationKey(config.AttestationKey); err != nil {
+			add("AttestationKey: %v", err)
+		}
+	}
+
+	checkSize := func(name, value string) {
+		if _, err := parseSize(value); err != nil {
+			add("%s: %v", name, err)
+		}
+	}
+	checkSize("MinFreeSpace", config.MinFreeSpace)
+	checkSize("MaxMemory", config.MaxMemory)
+	checkSize("SpoolMaxSize", config.SpoolMaxSize)
+	checkSize("BandwidthLimit", config.BandwidthLimit)
+	checkSize("SkipContentMinSize", config.SkipContentMinSize)
+
+	checkCompression := func(name, compression string, level int) {
+		format, err := compressionByName(compression)
+		if err != nil {
+			add("%s: %v", name, err)
+			return
+		}
+		if _, err := format.level(level); err != nil {
+			add("%s: %v", name, err)
+		}
+	}
+	checkCompression("Compression", config.Compression, config.CompressionLevel)
+	checkNice := func(name string, nice int) {
+		if nice < 0 || nice > 19 {
+			add("%s muss zwischen 0 und 19 liegen (%d)", name, nice)
+		}
+	}
+	checkNice("Nice", config.Nice)
+	for name, profile := range config.Profiles {
+		prefix := "Profiles." + name
+		if profile.Compression != "" || profile.CompressionLevel != 0 {
+			compression := profile.Compression
+			if compression == "" {
+				compression = config.Compression
+			}
+			checkCompression(prefix+".Compression", compression, profile.CompressionLevel)
+		}
+		checkSize(prefix+".BandwidthLimit", profile.BandwidthLimit)
+		checkNice(prefix+".Nice", profile.Nice)
+	}
+
+	checkPatterns := func(name string, patterns []string) {
+		for _, pattern := range patterns {
+			if _, err := path.Match(strings.TrimSuffix(strings.TrimPrefix(pattern, "**/"), "/"), ""); err != nil {
+				add("%s: ungültiges Muster %q", name, pattern)
+			}
+		}
+	}
+	checkPatterns("Excludes", config.Excludes)
+	for _, file := range config.ExcludesFrom {
+		patterns, err := readPatternFile(file)
+		if err != nil {
+			add("ExcludesFrom: %v", err)
+			continue
+		}
+		checkPatterns(file, patterns)
+	}
+	for _, source := range config.Sources {
+		if _, err := filepath.Match(source, ""); err != nil {
+			add("Sources: ungültiges Muster %q", source)
+		}
+	}
+	for name, text := range map[string]string{
+		"Notify.WebhookBody":  config.Notify.WebhookBody,
+		"Notify.EmailSubject": config.Notify.EmailSubject,
+	} {
+		if _, err := parseTemplate(text); err != nil {
+			add("%s: ungültiges Template: %v", name, err)
+		}
+	}
+	notifyEvents := []string{"success", "failure", "summary", "capacity"}
+	for name, events := range map[string][]string{
+		"Notify.Events":          config.Notify.Events,
+		"Notify.Slack.Events":    config.Notify.Slack.Events,
+		"Notify.Telegram.Events": config.Notify.Telegram.Events,
+		"Notify.Matrix.Events":   config.Notify.Matrix.Events,
+		"Notify.Ntfy.Events":     config.Notify.Ntfy.Events,
+		"Notify.MQTT.Events":     config.Notify.MQTT.Events,
+	} {
+		for _, event := range events {
+			checkChoice(name, event, notifyEvents...)
+		}
+	}
+	for event, text := range config.Notify.Messages {
+		checkChoice("Notify.Messages", event, notifyEvents...)
+		if _, err := parseTemplate(text); err != nil {
+			add("Notify.Messages.%s: ungültiges Template: %v", event, err)
+		}
+	}
+	if config.Notify.Slack.Token != "" && config.Notify.Slack.Channel == "" {
+		add("Notify.Slack: Channel fehlt für den Versand mit Token")
+	}
+	if config.Notify.Telegram.Token != "" && config.Notify.Telegram.ChatID == "" {
+		add("Notify.Telegram: ChatID fehlt")
+	}
+	if _, ok := ntfyPriorities[config.Notify.Ntfy.Priority]; config.Notify.Ntfy.Priority != "" && !ok {
+		add("Notify.Ntfy.Priority: ungültiger Wert %q (möglich: min, low, default, high, max oder 1-5)", config.Notify.Ntfy.Priority)
+	}
+	if config.Notify.MQTT.QoS < 0 || config.Notify.MQTT.QoS > 1 {
+		add("Notify.MQTT.QoS muss 0 oder 1 sein (%d)", config.Notify.MQTT.QoS)
+	}
+	if config.Notify.MQTT.Password != "" && config.Notify.MQTT.Username == "" {
+		add("Notify.MQTT: Password nur zusammen mit Username möglich (MQTT 3.1.1)")
+	}
+	if config.Notify.Matrix.Homeserver != "" && (config.Notify.Matrix.AccessToken == "" || config.Notify.Matrix.RoomID == "") {
+		add("Notify.Matrix: AccessToken und RoomID werden benötigt")
+	}
+	problems = append(problems, validateHooks("PreHooks", config.PreHooks)...)
+	problems = append(problems, validateHooks("PostHooks", config.PostHooks)...)
+	if config.ProjectID != "" && (strings.ContainsAny(config.ProjectID, `/\`) || strings.Contains(config.ProjectID, "_backup_")) {
+		add("ProjectID %q darf weder / noch _backup_ enthalten", config.ProjectID)
+	}
+	return problems
+}
+
+// unknownConfigKeys liefert Schlüssel der JSON-Datei, die keinem Feld der Konfiguration
+// entsprechen, z.B. Tippfehler wie "MaxBackps"
+func unknownConfigKeys(data []byte) []string {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+	keys := unknownKeys(raw, reflect.TypeOf(Config{}), "")
+	sort.Strings(keys)
+	return keys
+}
+
+func unknownKeys(raw interface{}, t reflect.Type, prefix string) []string {
+	var keys []string
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range object {
+			field, ok := configField(t, key)
+			if !ok {
+				keys = append(keys, prefix+key)
+				continue
+			}
+			keys = append(keys, unknownKeys(value, field.Type, prefix+key+".")...)
+		}
+	case reflect.Map:
+		object, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for key, value := range object {
+			keys = append(keys, unknownKeys(value, t.Elem(), prefix+key+".")...)
+		}
+	}
+	return keys
+}
+
+// configField sucht das Feld so, wie encoding/json es zuordnet (Groß-/Kleinschreibung egal)
+func configField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag != "" {
+			name = tag
+		}
+		if strings.EqualFold(name, key) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+func problemList(problems []string) string {
+	var b strings.Builder
+	for _, problem := range problems {
+		b.WriteString("\n  - " + problem)
+	}
+	return b.String()
+}
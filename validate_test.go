@@ -0,0 +1,44 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateMQTTPasswordAndQoS(t *testing.T) {
+	config := &Config{}
+	config.Notify.MQTT = MQTTConfig{Broker: "tcp://localhost:1883", Password: "geheim", QoS: 2}
+	problems := strings.Join(validateConfig(config), "\n")
+	if !strings.Contains(problems, "Password nur zusammen mit Username") {
+		t.Errorf("Passwort ohne Username nicht gemeldet: %s", problems)
+	}
+	if !strings.Contains(problems, "QoS muss 0 oder 1 sein") {
+		t.Errorf("QoS 2 nicht gemeldet: %s", problems)
+	}
+	if _, err := dialMQTT(config.Notify.MQTT); err == nil {
+		t.Error("Verbindung mit Passwort ohne Username aufgebaut")
+	}
+}
+
+func TestLoadConfigDefaultsAreCopied(t *testing.T) {
+	dir := t.TempDir()
+	config, err := loadConfig(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.BackupDir = "/anderswo"
+	config.Excludes[0] = "geändert"
+	if defaultConfig.BackupDir != "" || defaultConfig.Excludes[0] == "geändert" {
+		t.Error("Änderungen an der Konfiguration verändern defaultConfig")
+	}
+
+	broken := filepath.Join(dir, "kaputt.json")
+	if err := os.WriteFile(broken, []byte(`{"BackupDir": "/backup",`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(broken); err == nil {
+		t.Error("fehlerhafte config.json ohne Fehler geladen")
+	}
+}
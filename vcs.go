@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// GitInfo hält fest, auf welchem Stand des Repositorys ein Backup entstanden ist
+type GitInfo struct {
+	Branch  string
+	Commit  string // gekürzter Hash
+	Subject string // erste Zeile der Commit-Nachricht
+	Dirty   bool   `json:",omitempty"` // nicht eingecheckte Änderungen vorhanden
+}
+
+// readGitInfo liest Branch und letzten Commit des Repositorys in dir
+func readGitInfo(dir string) (*GitInfo, error) {
+	git := func(args ...string) (string, error) {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	head, err := git("log", "-1", "--format=%h%x00%s")
+	if err != nil {
+		return nil, fmt.Errorf("kein Git-Repository oder noch kein Commit: %v", err)
+	}
+	info := &GitInfo{}
+	info.Commit, info.Subject, _ = strings.Cut(head, "\x00")
+	info.Branch, _ = git("rev-parse", "--abbrev-ref", "HEAD")
+	if info.Branch == "HEAD" {
+		info.Branch = "" // losgelöster HEAD, z.B. beim Auschecken eines Tags
+	}
+	if status, err := git("status", "--porcelain", "--untracked-files=no"); err == nil && status != "" {
+		info.Dirty = true
+	}
+	return info, nil
+}
+
+func (g *GitInfo) String() string {
+	var b strings.Builder
+	if g.Branch != "" {
+		b.WriteString(g.Branch + "@")
+	}
+	b.WriteString(g.Commit)
+	if g.Dirty {
+		b.WriteString("+")
+	}
+	subject := []rune(g.Subject)
+	if len(subject) > 60 {
+		subject = append(subject[:59], '…')
+	}
+	return fmt.Sprintf("%s: %s", b.String(), string(subject))
+}
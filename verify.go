@@ -0,0 +1,93 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// runVerify prüft ein Backup gegen den Hash-Baum seines Manifests. Mit --path werden nur
+// die Dateien unterhalb eines Verzeichnisses gehasht; dass sie zum ganzen Backup gehören,
+// belegen die Prüfsummen der übrigen Verzeichnisse und die Wurzel im Katalog. Nur zip und
+// Snapshots lesen dabei gezielt diese Dateien, ein tar-Strom wird trotzdem ganz entpackt.
+func runVerify(args []string) error {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	prefixFlag := flags.String("path", "", "nur diese Datei oder dieses Verzeichnis prüfen, z.B. src/")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Verwendung: backup-tool verify [--path PFAD] [BACKUP]")
+		flags.PrintDefaults()
+		fmt.Fprintln(os.Stderr, "\nMit --path werden nur die Dateien unter PFAD gehasht. Zip-Archive und Snapshots")
+		fmt.Fprintln(os.Stderr, "lesen nur diese Dateien; tar-Archive werden trotzdem vollständig entpackt.")
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return fmt.Errorf("höchstens ein Backup angeben")
+	}
+
+	config, _, projectName, err := loadProject()
+	if err != nil {
+		return err
+	}
+	backupPath, err := selectBackup(config.BackupDir, projectName, "", flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	manifest, err := loadManifest(backupPath)
+	if err != nil {
+		return fmt.Errorf("manifest von %s nicht lesbar: %v", filepath.Base(backupPath), err)
+	}
+	catalog, err := loadCatalog(config.BackupDir)
+	if err != nil {
+		return err
+	}
+	root := ""
+	if entry, ok := catalog.find(filepath.Base(backupPath)); ok {
+		root = entry.TreeRoot
+	}
+	if root == "" {
+		root = manifest.Tree[""]
+		logMessage(LogWarning, "Keine Wurzel im Katalog, das Manifest wird nur mit sich selbst verglichen")
+	}
+	prefix := cleanArchivePath(*prefixFlag)
+
+	actual := make(map[string]string)
+	var read int64
+	err = walkArchive(backupPath, func(header *tar.Header, r io.Reader) error {
+		name := cleanArchivePath(header.Name)
+		if header.Typeflag != tar.TypeReg || !underTreePrefix(name, prefix) {
+			return nil
+		}
+		hash := sha256.New()
+		n, err := io.Copy(hash, r)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		read += n
+		actual[name] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	checked := len(actual)
+	if err := verifyTree(manifest, prefix, actual, root); err != nil {
+		return fmt.Errorf("%s: %v", filepath.Base(backupPath), err)
+	}
+
+	var total int64
+	for _, file := range manifest.Files {
+		total += file.Size
+	}
+	scope := fmt.Sprintf("alle %d Dateien", checked)
+	if prefix != "" {
+		scope = fmt.Sprintf("%s: %d von %d Dateien, %s von %s gehasht", prefix, checked, len(manifest.Files), formatSize(read), formatSize(total))
+	}
+	fmt.Printf("✓ %s geprüft (%s), Wurzel %s\n", filepath.Base(backupPath), scope, shortSum(root))
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// runVerifyDir prüft alle Archive eines Backup-Verzeichnisses gegen ihre Manifeste. Der
+// Befehl braucht weder config.json noch tar und läuft daher auch in einem minimalen
+// Container direkt auf dem NAS (siehe Dockerfile). Fehlt das Programm für eine
+// Kompression, gilt das Archiv als nicht prüfbar, nicht als fehlerhaft.
+func runVerifyDir(args []string) error {
+	flags := flag.NewFlagSet("verify-dir", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Verwendung: backup-tool verify-dir <backup-verzeichnis>")
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("kein Verzeichnis angegeben")
+	}
+	root := flags.Arg(0)
+
+	var archives []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && archiveExtension(path) != "" && backupFileProject(d.Name()) != "" {
+			archives = append(archives, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(archives)
+	if len(archives) == 0 {
+		return fmt.Errorf("keine Archive in %s gefunden", root)
+	}
+
+	failed, unchecked, uncheckable := 0, 0, 0
+	for _, archive := range archives {
+		rel, _ := filepath.Rel(root, archive)
+		if err := decompressorAvailable(archive); err != nil {
+			uncheckable++
+			fmt.Printf("NICHT PRÜFBAR  %s: %v\n", rel, err)
+			continue
+		}
+		checked, err := verifyArchiveManifest(archive)
+		switch {
+		case err != nil:
+			failed++
+			fmt.Printf("FEHLER  %s: %v\n", rel, err)
+		case !checked:
+			unchecked++
+			fmt.Printf("OK      %s (ohne Manifest, nur lesbar)\n", rel)
+		default:
+			fmt.Printf("OK      %s\n", rel)
+		}
+	}
+	fmt.Printf("\n%d Archive geprüft, %d fehlerhaft, %d ohne Manifest, %d nicht prüfbar\n",
+		len(archives)-uncheckable, failed, unchecked, uncheckable)
+	if failed > 0 {
+		return fmt.Errorf("%d von %d Archiven fehlerhaft", failed, len(archives))
+	}
+	return nil
+}
+
+// decompressorAvailable meldet, wenn das Programm zum Entpacken eines tar-Archivs fehlt
+func decompressorAvailable(archivePath string) error {
+	if archiveExtension(archivePath) == zipExtension {
+		return nil
+	}
+	format, err := fileCompression(archivePath)
+	if err != nil {
+		// Unbekanntes Format: verifyArchiveManifest meldet den Fehler
+		return nil
+	}
+	return format.available()
+}
+
+// verifyArchiveManifest liest das Archiv vollständig und vergleicht die Prüfsummen mit dem
+// Manifest. Ohne Manifest wird nur die Lesbarkeit geprüft; checked ist dann false.
+func verifyArchiveManifest(archivePath string) (checked bool, err error) {
+	manifest, err := loadManifest(archivePath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	expected := make(map[string]string)
+	if manifest != nil {
+		for _, file := range manifest.Files {
+			expected[file.name()] = file.SHA256
+		}
+	}
+
+	err = walkArchive(archivePath, func(header *tar.Header, r io.Reader) error {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, r); err != nil {
+			return err
+		}
+		want, ok := expected[header.Name]
+		if !ok || header.Typeflag != tar.TypeReg {
+			return nil
+		}
+		delete(expected, header.Name)
+		if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+			return fmt.Errorf("prüfsumme von %s weicht vom Manifest ab", header.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if len(expected) > 0 {
+		return false, fmt.Errorf("%d Dateien aus dem Manifest fehlen im Archiv", len(expected))
+	}
+	return manifest != nil, nil
+}
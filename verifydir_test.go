@@ -0,0 +1,27 @@
+package main
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestVerifyDirReportsMissingDecompressor(t *testing.T) {
+	dir := t.TempDir()
+	writeTestArchive(t, dir, []testEntry{{header: tar.Header{Name: "a.txt", Typeflag: tar.TypeReg}, body: "inhalt"}})
+	// zstd-Kennung, das Programm fehlt im leeren PATH
+	zst := filepath.Join(dir, "test_backup_2024-01-02_12-00-00.tar.zst")
+	if err := os.WriteFile(zst, []byte{0x28, 0xb5, 0x2f, 0xfd, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", t.TempDir())
+
+	if err := decompressorAvailable(zst); err == nil || !strings.Contains(err.Error(), "zstd") {
+		t.Errorf("fehlendes zstd nicht erkannt: %v", err)
+	}
+	if err := runVerifyDir([]string{dir}); err != nil {
+		t.Errorf("nicht prüfbares Archiv als fehlerhaft gemeldet: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"os"
+	"strings"
+)
+
+const zipExtension = ".zip"
+
+var (
+	zipMagic          = []byte("PK\x03\x04")
+	errZipUnsupported = errors.New("eintragstyp wird von zip nicht unterstützt")
+)
+
+// entryWriter ist die gemeinsame Schnittstelle der Archivformate beim Schreiben;
+// tar.Writer erfüllt sie direkt, zip wird über zipWriter angepasst
+type entryWriter interface {
+	WriteHeader(header *tar.Header) error
+	io.Writer
+	Close() error
+}
+
+// entryReader ist das Gegenstück beim Lesen; tar.Reader erfüllt sie direkt
+type entryReader interface {
+	Next() (*tar.Header, error)
+	io.Reader
+}
+
+// zipWriter schreibt tar-Header als zip-Einträge. zip64 wird bei Bedarf automatisch
+// verwendet; Hardlinks und Spezialdateien kennt das Format nicht. Bereits komprimierte
+// Dateien (Bilder, Videos, Archive) werden unverändert gespeichert: Deflate spart bei
+// ihnen kaum Platz, kostet aber die meiste Zeit.
+type zipWriter struct {
+	zw      *zip.Writer
+	current io.Writer
+	pending *zip.FileHeader // Datei, deren Methode erst mit den ersten Daten feststeht
+	Stored  int             // unkomprimiert gespeicherte Dateien
+}
+
+func newZipWriter(w io.Writer, level int) *zipWriter {
+	zw := zip.NewWriter(w)
+	zw.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(out, level)
+	})
+	return &zipWriter{zw: zw}
+}
+
+func (z *zipWriter) WriteHeader(header *tar.Header) error {
+	if err := z.createPending(nil); err != nil {
+		return err
+	}
+	fh := &zip.FileHeader{
+		Name:     strings.TrimPrefix(header.Name, "./"),
+		Modified: header.ModTime,
+		Method:   zip.Deflate,
+	}
+	fh.SetMode(header.FileInfo().Mode())
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if !strings.HasSuffix(fh.Name, "/") {
+			fh.Name += "/"
+		}
+		fh.Method = zip.Store
+	case tar.TypeSymlink:
+		fh.Method = zip.Store
+	case tar.TypeReg:
+		if header.Size > 0 {
+			z.pending = fh
+			return nil
+		}
+	default:
+		return &os.PathError{Op: "zip", Path: header.Name, Err: errZipUnsupported}
+	}
+
+	w, err := z.zw.CreateHeader(fh)
+	if err != nil {
+		return err
+	}
+	z.current = w
+	// Symlinks speichern ihr Ziel als Inhalt, wie Info-ZIP es auch tut
+	if header.Typeflag == tar.TypeSymlink {
+		_, err = io.WriteString(w, header.Linkname)
+	}
+	return err
+}
+
+func (z *zipWriter) Write(p []byte) (int, error) {
+	if err := z.createPending(p); err != nil {
+		return 0, err
+	}
+	return z.current.Write(p)
+}
+
+// createPending legt den zurückgestellten Eintrag an; head ist der Anfang seines Inhalts
+func (z *zipWriter) createPending(head []byte) error {
+	if z.pending == nil {
+		return nil
+	}
+	fh := z.pending
+	z.pending = nil
+	if isCompressedContent(head) {
+		fh.Method = zip.Store
+		z.Stored++
+	}
+	w, err := z.zw.CreateHeader(fh)
+	z.current = w
+	return err
+}
+
+func (z *zipWriter) Close() error {
+	if err := z.createPending(nil); err != nil {
+		return err
+	}
+	return z.zw.Close()
+}
+
+// zipReader liefert die Einträge eines zip-Archivs als tar-Header, damit Vorschau,
+// Wiederherstellung und Verifizierung für beide Formate gleich funktionieren
+type zipReader struct {
+	archive *zip.ReadCloser
+	next    int
+	current io.ReadCloser
+}
+
+func openZip(archivePath string) (*zipReader, error) {
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, err
+	}
+	return &zipReader{archive: archive}, nil
+}
+
+func (z *zipReader) Next() (*tar.Header, error) {
+	if z.current != nil {
+		z.current.Close()
+		z.current = nil
+	}
+	if z.next >= len(z.archive.File) {
+		return nil, io.EOF
+	}
+	f := z.archive.File[z.next]
+	z.next++
+
+	info := f.FileInfo()
+	header := &tar.Header{
+		Name:     f.Name,
+		Mode:     int64(info.Mode().Perm()),
+		ModTime:  f.Modified,
+		Typeflag: tar.TypeReg,
+		Size:     int64(f.UncompressedSize64),
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case info.IsDir():
+		header.Typeflag = tar.TypeDir
+		header.Size = 0
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, err
+		}
+		header.Typeflag = tar.TypeSymlink
+		header.Linkname = string(target)
+		header.Size = 0
+		r = io.NopCloser(bytes.NewReader(nil))
+	}
+	z.current = r
+	return header, nil
+}
+
+func (z *zipReader) Read(p []byte) (int, error) {
+	if z.current == nil {
+		return 0, io.EOF
+	}
+	return z.current.Read(p)
+}
+
+func (z *zipReader) Close() error {
+	if z.current != nil {
+		z.current.Close()
+	}
+	return z.archive.Close()
+}
+
+// isZipFile erkennt zip-Archive an ihrer Kennung
+func isZipFile(archivePath string) bool {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(zipMagic))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false
+	}
+	return bytes.Equal(head, zipMagic)
+}